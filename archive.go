@@ -0,0 +1,410 @@
+package bloby
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Name of manifest entry, manifest is the first entry of archive
+	archiveManifestName = "manifest.json"
+	// Prefix of content entries, followed by original node reference
+	archiveContentPrefix = "content/"
+	archiveFormat        = "bloby"
+	archiveVersion       = 1
+)
+
+type archiveManifest struct {
+	Format  string         `json:"format"`
+	Version int            `json:"version"`
+	Created time.Time      `json:"created"`
+	Nodes   []archiveEntry `json:"nodes"`
+}
+
+// Exported node, attributes of StatNode and Verifiable nodes are included when available
+type archiveEntry struct {
+	Reference   string      `json:"reference"`
+	Name        string      `json:"name"`
+	Metadata    interface{} `json:"metadata"`
+	ContentType string      `json:"content_type,omitempty"`
+	CreatedAt   *time.Time  `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time  `json:"updated_at,omitempty"`
+	SHA256      string      `json:"sha256,omitempty"`
+}
+
+// Write all nodes of storage into tar stream
+func Export(storage Storage, w io.Writer) error {
+	return ExportBy(storage, w, "", "")
+}
+
+// Write nodes matching name prefix and postfix into tar stream.
+//
+// Archive starts with manifest listing nodes with their names and metadata, followed by content of nodes having content.
+// Content of ChecksumSeekReadable nodes is opened together with its checksum while manifest is built, so content written during export is not exported.
+// Content written during export fails export with ErrChecksumMismatch for other Verifiable nodes, so archive is never inconsistent with its manifest.
+func ExportBy(storage Storage, w io.Writer, namePrefix string, namePostfix string) error {
+	nodes, err := storage.ListBy(namePrefix, namePostfix)
+	if err != nil {
+		return err
+	}
+
+	// Content opened with checksum, nil for nodes opened on export of content
+	readers := make([]io.ReadSeekCloser, len(nodes))
+	defer func() {
+		for _, reader := range readers {
+			if reader != nil {
+				reader.Close()
+			}
+		}
+	}()
+
+	manifest := archiveManifest{
+		Format:  archiveFormat,
+		Version: archiveVersion,
+		Created: time.Now(),
+		Nodes:   make([]archiveEntry, 0, len(nodes)),
+	}
+
+	for index, node := range nodes {
+		entry := archiveEntry{
+			Reference: node.GetReference(),
+			Name:      node.GetName(),
+			Metadata:  node.GetMetadata(),
+		}
+
+		if stat, ok := node.(StatNode); ok {
+			createdAt := stat.GetCreatedAt()
+			updatedAt := stat.GetUpdatedAt()
+
+			entry.ContentType = stat.GetContentType()
+			entry.CreatedAt = &createdAt
+			entry.UpdatedAt = &updatedAt
+		}
+
+		if checksumSeekReadable, ok := node.(ChecksumSeekReadable); ok {
+			reader, checksum, err := checksumSeekReadable.GetSeekReaderWithChecksum()
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+
+			if err == nil {
+				readers[index] = reader
+				entry.SHA256 = checksum.SHA256
+			}
+		} else if verifiable, ok := node.(Verifiable); ok {
+			checksum, err := verifiable.GetChecksum()
+			if err == nil {
+				entry.SHA256 = checksum.SHA256
+			} else if !errors.Is(err, ErrNoChecksum) {
+				return err
+			}
+		}
+
+		manifest.Nodes = append(manifest.Nodes, entry)
+	}
+
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewWriter(w)
+
+	err = archive.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     archiveManifestName,
+		Mode:     0644,
+		Size:     int64(len(manifestBytes)),
+		ModTime:  manifest.Created,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = archive.Write(manifestBytes)
+	if err != nil {
+		return err
+	}
+
+	for index, node := range nodes {
+		if _, ok := node.(ChecksumSeekReadable); ok {
+			err = exportReader(archive, readers[index], manifest.Nodes[index])
+		} else {
+			err = exportContent(archive, node, manifest.Nodes[index])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// Open node content with known size, returns nil reader for node without content
+func openExportContent(node Node) (io.ReadSeekCloser, error) {
+	if seekReadable, ok := node.(SeekReadable); ok {
+		reader, err := seekReadable.GetSeekReader()
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+
+		return reader, err
+	}
+
+	readable, ok := node.(Readable)
+	if !ok {
+		return nil, fmt.Errorf("node is not readable: %w", errors.ErrUnsupported)
+	}
+
+	reader, err := readable.GetReader()
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// Size of streamed content is not known before it is read
+	file, err := os.CreateTemp("", "bloby-export-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name())
+
+	_, err = io.Copy(file, reader)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func exportContent(archive *tar.Writer, node Node, entry archiveEntry) error {
+	reader, err := openExportContent(node)
+	if err != nil {
+		return err
+	}
+
+	if reader == nil {
+		return nil
+	}
+	defer reader.Close()
+
+	return exportReader(archive, reader, entry)
+}
+
+// Write content entry, nil reader is node without content
+func exportReader(archive *tar.Writer, reader io.ReadSeeker, entry archiveEntry) error {
+	if reader == nil {
+		return nil
+	}
+
+	size, err := reader.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = reader.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	modTime := time.Now()
+	if entry.UpdatedAt != nil && !entry.UpdatedAt.IsZero() {
+		modTime = *entry.UpdatedAt
+	}
+
+	err = archive.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     archiveContentPrefix + entry.Reference,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(archive, hash), reader)
+	if err != nil {
+		return err
+	}
+
+	if entry.SHA256 != "" && hex.EncodeToString(hash.Sum(nil)) != entry.SHA256 {
+		return &StorageError{Op: "export", Reference: entry.Reference, Err: ErrChecksumMismatch}
+	}
+
+	return nil
+}
+
+// Restore nodes from tar stream written by Export into storage.
+//
+// Nodes get new references, returned map translates exported references into references of imported nodes.
+// Creation and modification times are restored for TimesMutable nodes.
+// Import is not atomic, nodes imported before failure are left in storage and listed in returned map.
+func Import(storage Storage, r io.Reader) (map[string]string, error) {
+	references := make(map[string]string)
+	archive := tar.NewReader(r)
+
+	header, err := archive.Next()
+	if err == io.EOF || (err == nil && header.Name != archiveManifestName) {
+		return references, fmt.Errorf("%w: manifest is missing", ErrInvalidArchive)
+	}
+	if err != nil {
+		return references, err
+	}
+
+	var manifest archiveManifest
+
+	err = json.NewDecoder(archive).Decode(&manifest)
+	if err != nil {
+		return references, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+
+	if manifest.Format != archiveFormat || manifest.Version != archiveVersion {
+		return references, fmt.Errorf("%w: unsupported format %q version %d", ErrInvalidArchive, manifest.Format, manifest.Version)
+	}
+
+	entries := make(map[string]archiveEntry, len(manifest.Nodes))
+	nodes := make(map[string]Node, len(manifest.Nodes))
+
+	for _, entry := range manifest.Nodes {
+		if _, ok := entries[entry.Reference]; ok {
+			return references, fmt.Errorf("%w: duplicate node %s", ErrInvalidArchive, entry.Reference)
+		}
+
+		node, err := storage.Create(entry.Name, entry.Metadata)
+		if err != nil {
+			return references, err
+		}
+
+		references[entry.Reference] = node.GetReference()
+		entries[entry.Reference] = entry
+		nodes[entry.Reference] = node
+
+		if entry.ContentType == "" {
+			continue
+		}
+
+		if contentTypeMutable, ok := node.(ContentTypeMutable); ok {
+			err = contentTypeMutable.SetContentType(entry.ContentType)
+			if err != nil {
+				return references, err
+			}
+		}
+	}
+
+	imported := make(map[string]bool)
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return references, err
+		}
+
+		reference, ok := strings.CutPrefix(header.Name, archiveContentPrefix)
+		if !ok || imported[reference] {
+			return references, fmt.Errorf("%w: unexpected entry %s", ErrInvalidArchive, header.Name)
+		}
+
+		node, ok := nodes[reference]
+		if !ok {
+			return references, fmt.Errorf("%w: content of unknown node %s", ErrInvalidArchive, reference)
+		}
+
+		err = importContent(node, archive, entries[reference].SHA256)
+		if err != nil {
+			return references, err
+		}
+
+		imported[reference] = true
+	}
+
+	// Times are restored after content is written, since writes update modification time
+	for _, entry := range manifest.Nodes {
+		if entry.CreatedAt == nil && entry.UpdatedAt == nil {
+			continue
+		}
+
+		timesMutable, ok := nodes[entry.Reference].(TimesMutable)
+		if !ok {
+			continue
+		}
+
+		var createdAt, updatedAt time.Time
+		if entry.CreatedAt != nil {
+			createdAt = *entry.CreatedAt
+		}
+		if entry.UpdatedAt != nil {
+			updatedAt = *entry.UpdatedAt
+		}
+
+		err = timesMutable.SetTimes(createdAt, updatedAt)
+		if err != nil {
+			return references, err
+		}
+	}
+
+	return references, nil
+}
+
+// Write node content, content not matching checksum is not committed, since writer that can not be aborted is left unclosed
+func importContent(node Node, reader io.Reader, checksum string) error {
+	var writer io.Writer
+	var err error
+
+	if closeWritable, ok := node.(CloseWritable); ok {
+		writer, err = closeWritable.GetWriteCloser()
+	} else if writable, ok := node.(Writable); ok {
+		writer, err = writable.GetWriter()
+	} else {
+		return fmt.Errorf("node is not writable: %w", errors.ErrUnsupported)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(writer, hash), reader)
+	if err == nil && checksum != "" && hex.EncodeToString(hash.Sum(nil)) != checksum {
+		err = &StorageError{Op: "import", Reference: node.GetReference(), Err: ErrChecksumMismatch}
+	}
+
+	if err != nil {
+		if abortable, ok := writer.(Abortable); ok {
+			abortable.Abort()
+		}
+
+		return err
+	}
+
+	if closer, ok := writer.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
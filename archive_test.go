@@ -0,0 +1,145 @@
+package bloby
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	testDirName := "test-file-storage-TestExportImport"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: true})
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, content string) {
+		writer, err := node.(*FileNode).GetWriteCloser()
+		assert.NoError(t, err)
+
+		writer.Write([]byte(content))
+		assert.NoError(t, writer.Close())
+	}
+
+	tom, err := storage.Create("cats/tom", map[string]interface{}{"color": "gray"})
+	assert.NoError(t, err)
+	write(tom, "meow")
+	assert.NoError(t, tom.(*FileNode).SetContentType("text/plain"))
+
+	kitty, err := storage.Create("cats/kitty", nil)
+	assert.NoError(t, err)
+	write(kitty, "meow")
+
+	empty, err := storage.Create("cats/empty", nil)
+	assert.NoError(t, err)
+
+	_, err = storage.Create("dogs/rex", nil)
+	assert.NoError(t, err)
+
+	var archive bytes.Buffer
+
+	err = ExportBy(storage, &archive, "cats/", "")
+	assert.NoError(t, err)
+
+	exported := archive.Bytes()
+
+	// Import into other backend
+	memory := NewMemoryStorage()
+	assert.NoError(t, memory.Open())
+
+	references, err := Import(memory, bytes.NewReader(exported))
+	assert.NoError(t, err)
+	assert.Len(t, references, 3)
+
+	imported, err := memory.GetByReference(references[tom.GetReference()])
+	assert.NoError(t, err)
+	assert.NotNil(t, imported)
+	assert.Equal(t, "cats/tom", imported.GetName())
+	assert.Equal(t, map[string]interface{}{"color": "gray"}, imported.GetMetadata())
+	assert.Equal(t, "text/plain", imported.(StatNode).GetContentType())
+	assert.True(t, imported.(StatNode).GetCreatedAt().Equal(tom.(StatNode).GetCreatedAt()))
+	assert.True(t, imported.(StatNode).GetUpdatedAt().Equal(tom.(StatNode).GetUpdatedAt()))
+
+	reader, err := imported.(*MemoryNode).GetReader()
+	assert.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", string(content))
+
+	imported, err = memory.GetByReference(references[empty.GetReference()])
+	assert.NoError(t, err)
+	_, err = imported.(*MemoryNode).GetReader()
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	exists, err := memory.ExistsByName("dogs/rex")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Tampered content is rejected
+	tampered := bytes.Replace(exported, []byte("meow"), []byte("woof"), 1)
+
+	_, err = Import(openMemoryStorage(t), bytes.NewReader(tampered))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// Archive without manifest
+	var invalid bytes.Buffer
+	writer := tar.NewWriter(&invalid)
+	assert.NoError(t, writer.WriteHeader(&tar.Header{Name: "content/cats", Mode: 0644}))
+	assert.NoError(t, writer.Close())
+
+	_, err = Import(memory, &invalid)
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+
+	_, err = Import(memory, bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+
+	// Content written after manifest is built is not exported
+	var concurrent bytes.Buffer
+	rewrite := func(p []byte) (int, error) {
+		if concurrent.Len() == 0 {
+			write(kitty, "purr")
+		}
+
+		return concurrent.Write(p)
+	}
+
+	err = ExportBy(storage, writerFunc(rewrite), "cats/kitty", "")
+	assert.NoError(t, err)
+
+	references, err = Import(openMemoryStorage(t), &concurrent)
+	assert.NoError(t, err)
+	assert.Len(t, references, 1)
+
+	// Corrupted content fails export
+	assert.NoError(t, os.WriteFile(tom.(*FileNode).GetPath(), []byte("purr"), 0644))
+
+	err = Export(storage, io.Discard)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	err = Export(storage, io.Discard)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) {
+	return fn(p)
+}
+
+func openMemoryStorage(t *testing.T) *MemoryStorage {
+	storage := NewMemoryStorage()
+	assert.NoError(t, storage.Open())
+
+	return storage
+}
@@ -0,0 +1,212 @@
+package bloby
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+func (storage *FileStorage) getSnapshotsDir() string {
+	return filepath.Join(storage.path, "snapshots")
+}
+
+func (storage *FileStorage) Backup(destPath string) error {
+	return storage.BackupContext(context.Background(), destPath)
+}
+
+// Write consistent copy of storage into new directory destPath while storage stays open.
+//
+// Metadata database is copied with VACUUM INTO and content files are hard linked into snapshot inside storage directory, while commits of writers wait.
+// Content files are never modified in place, so linked files keep content of snapshot.
+// Snapshot is moved into destPath, or copied if destPath is on another filesystem.
+//
+// Backup opens with the same options as storage.
+func (storage *FileStorage) BackupContext(ctx context.Context, destPath string) error {
+	checkStorageIsNil(storage)
+
+	destPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return wrapError("backup", "", err)
+	}
+
+	if _, err := os.Lstat(destPath); err == nil {
+		return wrapError("backup", "", &os.PathError{Op: "backup", Path: destPath, Err: os.ErrExist})
+	}
+
+	snapshotPath, err := storage.snapshot(ctx)
+	if err != nil {
+		return wrapError("backup", "", err)
+	}
+
+	err = os.Rename(snapshotPath, destPath)
+	if err == nil {
+		return nil
+	}
+
+	err = copyDirectory(ctx, snapshotPath, destPath)
+	os.RemoveAll(snapshotPath)
+
+	if err != nil {
+		os.RemoveAll(destPath)
+		return wrapError("backup", "", err)
+	}
+
+	return nil
+}
+
+// Write snapshot into new directory under snapshots/ and return its path
+func (storage *FileStorage) snapshot(ctx context.Context) (string, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return "", ErrClosed
+	}
+
+	snapshotPath := filepath.Join(storage.getSnapshotsDir(), randomHexString(16))
+
+	err := os.MkdirAll(snapshotPath, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	completed := false
+	defer func() {
+		if !completed {
+			os.RemoveAll(snapshotPath)
+		}
+	}()
+
+	// In shared lock mode transaction holds write lock, so writers of other processes wait too
+	tx, err := storage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = storage.db.ExecContext(ctx, "vacuum into ?", filepath.Join(snapshotPath, "metadata.db"))
+	if err != nil {
+		return "", err
+	}
+
+	var paths []string
+
+	if storage.options.ContentAddressed {
+		hashes, err := storage.queryStrings(ctx, tx, "select distinct blob from metadata where blob is not null")
+		if err != nil {
+			return "", err
+		}
+
+		for _, hash := range hashes {
+			paths = append(paths, storage.getPathByBlob(hash))
+		}
+	} else {
+		references, err := storage.queryStrings(ctx, tx, "select reference from metadata")
+		if err != nil {
+			return "", err
+		}
+
+		for _, reference := range references {
+			paths = append(paths, storage.getPathByReference(reference))
+		}
+	}
+
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		destPath := filepath.Join(snapshotPath, storage.relativePath(path))
+
+		err = os.MkdirAll(filepath.Dir(destPath), 0755)
+		if err != nil {
+			return "", err
+		}
+
+		err = os.Link(path, destPath)
+
+		// Nodes without content have no file
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		// Filesystem without hard links
+		if err != nil {
+			err = copyFile(path, destPath)
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	completed = true
+
+	return snapshotPath, nil
+}
+
+// Copy regular file keeping its mode and modification time
+func copyFile(sourcePath string, destPath string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	dest, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dest, source)
+	if err == nil {
+		err = dest.Sync()
+	}
+
+	closeErr := dest.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(destPath, info.ModTime(), info.ModTime())
+}
+
+// Copy directory tree of regular files into new directory
+func copyDirectory(ctx context.Context, sourcePath string, destPath string) error {
+	return filepath.WalkDir(sourcePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(destPath, relativePath), 0755)
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		return copyFile(path, filepath.Join(destPath, relativePath))
+	})
+}
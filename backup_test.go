@@ -0,0 +1,134 @@
+package bloby
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup(t *testing.T) {
+	testDirName := "test-file-storage-TestBackup"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	for _, options := range []FileStorageOptions{{}, {ContentAddressed: true}, {LockMode: LockShared}} {
+		os.RemoveAll(testDirName)
+		assert.NoError(t, os.MkdirAll(testDirName, 0755))
+
+		storage := NewFileStorageWithOptions(filepath.Join(testDirName, "storage"), options)
+		err := storage.Open()
+		assert.NoError(t, err)
+
+		write := func(node Node, content string) {
+			writer, err := node.(*FileNode).GetWriteCloser()
+			assert.NoError(t, err)
+
+			writer.Write([]byte(content))
+			assert.NoError(t, writer.Close())
+		}
+
+		read := func(node Node) string {
+			reader, err := node.(*FileNode).GetVerifyingReader()
+			assert.NoError(t, err)
+			defer reader.Close()
+
+			content, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+
+			return string(content)
+		}
+
+		cats, err := storage.Create("cats", map[string]interface{}{"color": "gray"})
+		assert.NoError(t, err)
+		write(cats, "meow")
+
+		dogs, err := storage.Create("dogs", nil)
+		assert.NoError(t, err)
+		write(dogs, "woof")
+
+		_, err = storage.Create("empty", nil)
+		assert.NoError(t, err)
+
+		backupPath := filepath.Join(testDirName, "backup")
+
+		err = storage.Backup(backupPath)
+		assert.NoError(t, err)
+
+		// Changes after backup do not affect backup
+		write(cats, "purr")
+		assert.NoError(t, storage.Delete(dogs.GetReference()))
+
+		err = storage.Backup(backupPath)
+		assert.ErrorIs(t, err, os.ErrExist)
+
+		entries, err := os.ReadDir(storage.getSnapshotsDir())
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		err = storage.Close()
+		assert.NoError(t, err)
+
+		backup := NewFileStorageWithOptions(backupPath, options)
+		err = backup.Open()
+		assert.NoError(t, err)
+
+		references, err := backup.ListReferences("", "")
+		assert.NoError(t, err)
+		assert.Len(t, references, 3)
+
+		node, err := backup.GetByName("cats")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"color": "gray"}, node.GetMetadata())
+		assert.Equal(t, "meow", read(node))
+
+		node, err = backup.GetByName("dogs")
+		assert.NoError(t, err)
+		assert.Equal(t, "woof", read(node))
+
+		report, err := backup.Check()
+		assert.NoError(t, err)
+		assert.Empty(t, report.OrphanFiles)
+		assert.Empty(t, report.MissingBlobs)
+		assert.Empty(t, report.BadRefcounts)
+		assert.Len(t, report.MissingContent, 1)
+
+		err = backup.Close()
+		assert.NoError(t, err)
+
+		err = storage.Backup(filepath.Join(testDirName, "closed"))
+		assert.ErrorIs(t, err, ErrClosed)
+	}
+}
+
+func TestCopyDirectory(t *testing.T) {
+	testDirName := "test-file-storage-TestCopyDirectory"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	sourcePath := filepath.Join(testDirName, "source")
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourcePath, "a", "b"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(sourcePath, "a", "b", "cats"), []byte("meow"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(sourcePath, "dogs"), []byte("woof"), 0644))
+
+	destPath := filepath.Join(testDirName, "dest")
+	assert.NoError(t, copyDirectory(context.Background(), sourcePath, destPath))
+
+	content, err := os.ReadFile(filepath.Join(destPath, "a", "b", "cats"))
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", string(content))
+
+	content, err = os.ReadFile(filepath.Join(destPath, "dogs"))
+	assert.NoError(t, err)
+	assert.Equal(t, "woof", string(content))
+
+	// Existing files are not overwritten
+	assert.ErrorIs(t, copyDirectory(context.Background(), sourcePath, destPath), os.ErrExist)
+}
@@ -1,6 +1,9 @@
 package bloby
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
 type Storage interface {
 	GetByReference(reference string) (Node, error)
@@ -16,6 +19,26 @@ type Storage interface {
 	Close() error
 }
 
+// Storage with cancellable operations
+type StorageContext interface {
+	GetByReferenceContext(ctx context.Context, reference string) (Node, error)
+	GetByNameContext(ctx context.Context, name string) (Node, error)
+	CreateContext(ctx context.Context, name string, metadata interface{}) (Node, error)
+	DeleteContext(ctx context.Context, reference string) error
+	DeleteByContext(ctx context.Context, namePrefix string, namePostfix string) error
+	ExistsByNameContext(ctx context.Context, name string) (bool, error)
+	ExistsByReferenceContext(ctx context.Context, reference string) (bool, error)
+	ListByContext(ctx context.Context, namePrefix string, namePostfix string) ([]Node, error)
+	ListReferencesContext(ctx context.Context, namePrefix string, namePostfix string) ([]string, error)
+}
+
+// Storage with upsert by name
+type Replaceable interface {
+	// Replace metadata of existing node with given name keeping its reference and content, or create new node
+	CreateOrReplace(name string, metadata interface{}) (Node, error)
+	CreateOrReplaceContext(ctx context.Context, name string, metadata interface{}) (Node, error)
+}
+
 type Node interface {
 	GetReference() string
 	GetName() string
@@ -27,6 +50,11 @@ type Mutable interface {
 	SetName(name string) error
 }
 
+type MutableContext interface {
+	SetMetadataContext(ctx context.Context, metadata interface{}) error
+	SetNameContext(ctx context.Context, name string) error
+}
+
 type Pathable interface {
 	GetPath() string
 }
@@ -35,6 +63,16 @@ type Readable interface {
 	GetReader() (io.Reader, error)
 }
 
+type ReadSeekCloserAt interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+// Readable with random access, suitable for http.ServeContent
+type SeekReadable interface {
+	GetSeekReader() (ReadSeekCloserAt, error)
+}
+
 type Writable interface {
 	GetWriter() (io.Writer, error)
 }
@@ -42,3 +80,16 @@ type Writable interface {
 type FlagWritable interface {
 	GetFlagWriter(flag int) (io.Writer, error)
 }
+
+type CloseWritable interface {
+	GetWriteCloser() (io.WriteCloser, error)
+}
+
+type FlagCloseWritable interface {
+	GetFlagWriteCloser(flag int) (io.WriteCloser, error)
+}
+
+// Writer that can discard written content instead of committing it on Close
+type Abortable interface {
+	Abort() error
+}
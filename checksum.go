@@ -0,0 +1,371 @@
+package bloby
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+// Content checksum recorded on write
+type Checksum struct {
+	// Hex encoded SHA-256 of content
+	SHA256 string
+	// Content size in bytes, -1 if unknown
+	Size int64
+}
+
+// Node with content integrity check
+type Verifiable interface {
+	// Get checksum recorded on last write, returns ErrNoChecksum if node has no recorded checksum
+	GetChecksum() (Checksum, error)
+	// Get reader returning ErrChecksumMismatch instead of io.EOF if content does not match recorded checksum
+	GetVerifyingReader() (io.ReadCloser, error)
+}
+
+// Node opening content together with checksum of the same write, suitable for serving content with ETag
+type ChecksumSeekReadable interface {
+	// Get reader and checksum of content it reads, checksum is empty if node has no recorded checksum
+	GetSeekReaderWithChecksum() (ReadSeekCloserAt, Checksum, error)
+}
+
+type verifyingReader struct {
+	reader    io.ReadCloser
+	reference string
+	checksum  Checksum
+	hash      hash.Hash
+	size      int64
+}
+
+func newVerifyingReader(reader io.ReadCloser, reference string, checksum Checksum) *verifyingReader {
+	return &verifyingReader{
+		reader:    reader,
+		reference: reference,
+		checksum:  checksum,
+		hash:      sha256.New(),
+	}
+}
+
+func (reader *verifyingReader) mismatch() error {
+	return &StorageError{
+		Op:        "verify",
+		Reference: reader.reference,
+		Err:       ErrChecksumMismatch,
+	}
+}
+
+func (reader *verifyingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+
+	reader.hash.Write(p[:n])
+	reader.size += int64(n)
+
+	if reader.checksum.Size >= 0 && reader.size > reader.checksum.Size {
+		return n, reader.mismatch()
+	}
+
+	if err == io.EOF {
+		if reader.checksum.Size >= 0 && reader.size != reader.checksum.Size {
+			return n, reader.mismatch()
+		}
+
+		if hex.EncodeToString(reader.hash.Sum(nil)) != reader.checksum.SHA256 {
+			return n, reader.mismatch()
+		}
+	}
+
+	return n, err
+}
+
+func (reader *verifyingReader) Close() error {
+	return reader.reader.Close()
+}
+
+// Query recorded checksum, in content addressed mode blob hash is used for content written before checksums were recorded
+func (storage *FileStorage) queryChecksum(ctx context.Context, reference string) (Checksum, error) {
+	var resultChecksum sql.NullString
+	var resultSize sql.NullInt64
+
+	err := storage.db.QueryRowContext(ctx, "select coalesce(checksum, blob), size from metadata where reference = ?", reference).Scan(&resultChecksum, &resultSize)
+	if err == sql.ErrNoRows {
+		return Checksum{}, ErrNotFound
+	}
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	if !resultChecksum.Valid {
+		return Checksum{}, ErrNoChecksum
+	}
+
+	checksum := Checksum{
+		SHA256: resultChecksum.String,
+		Size:   -1,
+	}
+
+	if resultSize.Valid {
+		checksum.Size = resultSize.Int64
+	}
+
+	return checksum, nil
+}
+
+func (node *FileNode) GetChecksum() (Checksum, error) {
+	checkNodeIsNil(node)
+
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return Checksum{}, ErrClosed
+	}
+
+	checksum, err := node.storage.queryChecksum(context.Background(), node.reference)
+	if err != nil {
+		return Checksum{}, wrapError("checksum", node.reference, err)
+	}
+
+	return checksum, nil
+}
+
+func (node *FileNode) GetVerifyingReader() (io.ReadCloser, error) {
+	checkNodeIsNil(node)
+
+	reader, checksum, err := node.openChecksumReader(true)
+	if err != nil {
+		return nil, err
+	}
+
+	return newVerifyingReader(reader, node.reference, checksum), nil
+}
+
+func (node *FileNode) GetSeekReaderWithChecksum() (ReadSeekCloserAt, Checksum, error) {
+	checkNodeIsNil(node)
+
+	return node.openChecksumReader(false)
+}
+
+// Query checksum and open content under one lock hold, so content committed in between is not paired with checksum of previous content.
+// Returns ErrNoChecksum if checksum is required and not recorded, otherwise missing checksum is returned empty.
+func (node *FileNode) openChecksumReader(requireChecksum bool) (ReadSeekCloserAt, Checksum, error) {
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return nil, Checksum{}, ErrClosed
+	}
+
+	checksum, err := node.storage.queryChecksum(context.Background(), node.reference)
+	if errors.Is(err, ErrNoChecksum) && !requireChecksum {
+		checksum, err = Checksum{Size: -1}, nil
+	}
+	if err != nil {
+		return nil, Checksum{}, wrapError("checksum", node.reference, err)
+	}
+
+	reader, err := node.openReaderLocked()
+	if err != nil {
+		return nil, Checksum{}, err
+	}
+
+	return reader, checksum, nil
+}
+
+// Read whole file and compare its decompressed content with checksum
+func verifyFile(path string, reference string, codec Codec, checksum Checksum) error {
+	file, err := openContent(path, codec, checksum.Size)
+	if err != nil {
+		return err
+	}
+
+	reader := newVerifyingReader(file, reference, checksum)
+	defer reader.Close()
+
+	_, err = io.Copy(io.Discard, reader)
+
+	return err
+}
+
+type ScrubReport struct {
+	// Amount of nodes with content matching recorded checksum
+	Verified int
+	// References of nodes with content not matching recorded checksum or with missing content file
+	Corrupted []string
+	// References of nodes with content written before checksums were recorded
+	Unverified []string
+}
+
+// Amount of nodes loaded by Scrub at once
+const scrubBatchSize = 1000
+
+type scrubEntry struct {
+	reference string
+	path      string
+	codec     Codec
+	checksum  Checksum
+	// Checksum is recorded
+	hasChecksum bool
+}
+
+// Load next batch of nodes ordered by reference
+func (storage *FileStorage) scrubBatch(ctx context.Context, after string) ([]scrubEntry, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return storage.queryScrubEntries(ctx, "where reference > ? order by reference limit ?", after, scrubBatchSize)
+}
+
+// Columns scanned by queryScrubEntries
+const scrubColumns = "reference, blob, coalesce(checksum, blob), size, codec"
+
+func (storage *FileStorage) queryScrubEntries(ctx context.Context, condition string, args ...interface{}) ([]scrubEntry, error) {
+	rows, err := storage.db.QueryContext(ctx, "select "+scrubColumns+" from metadata "+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]scrubEntry, 0)
+
+	for rows.Next() {
+		var resultReference string
+		var resultBlob sql.NullString
+		var resultChecksum sql.NullString
+		var resultSize sql.NullInt64
+		var resultCodec Codec
+
+		err = rows.Scan(&resultReference, &resultBlob, &resultChecksum, &resultSize, &resultCodec)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := scrubEntry{
+			reference:   resultReference,
+			codec:       resultCodec,
+			hasChecksum: resultChecksum.Valid,
+			checksum: Checksum{
+				SHA256: resultChecksum.String,
+				Size:   -1,
+			},
+		}
+
+		if resultSize.Valid {
+			entry.checksum.Size = resultSize.Int64
+		}
+
+		if !storage.options.ContentAddressed {
+			entry.path = storage.getPathByReference(resultReference)
+		} else if resultBlob.Valid {
+			entry.path = storage.getPathByBlob(resultBlob.String)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (storage *FileStorage) Scrub() (ScrubReport, error) {
+	return storage.ScrubContext(context.Background())
+}
+
+// Verify content of all nodes against recorded checksums.
+//
+// Storage is locked only while nodes are loaded, so nodes may be used concurrently. Content rewritten during verification is verified again.
+func (storage *FileStorage) ScrubContext(ctx context.Context) (ScrubReport, error) {
+	checkStorageIsNil(storage)
+
+	report := ScrubReport{
+		Corrupted:  make([]string, 0),
+		Unverified: make([]string, 0),
+	}
+
+	// Shared blobs are verified once
+	verifiedBlobs := make(map[string]error)
+
+	after := ""
+
+	for {
+		entries, err := storage.scrubBatch(ctx, after)
+		if err != nil {
+			return report, wrapError("scrub", "", err)
+		}
+
+		if len(entries) == 0 {
+			return report, nil
+		}
+
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+
+			if !entry.hasChecksum {
+				if _, err := os.Stat(entry.path); entry.path != "" && err == nil {
+					report.Unverified = append(report.Unverified, entry.reference)
+				}
+
+				continue
+			}
+
+			verifyErr, verified := verifiedBlobs[entry.path]
+			if !verified {
+				verifyErr = verifyFile(entry.path, entry.reference, entry.codec, entry.checksum)
+				if storage.options.ContentAddressed {
+					verifiedBlobs[entry.path] = verifyErr
+				}
+			}
+
+			if verifyErr != nil {
+				// Node may be rewritten or deleted after batch was loaded
+				current, recheckErr := storage.recheckEntry(ctx, entry.reference)
+				if errors.Is(recheckErr, ErrNotFound) {
+					continue
+				}
+
+				if recheckErr == nil && current.hasChecksum && (current.checksum != entry.checksum || current.path != entry.path || current.codec != entry.codec) {
+					verifyErr = verifyFile(current.path, entry.reference, current.codec, current.checksum)
+				}
+			}
+
+			switch {
+			case verifyErr == nil:
+				report.Verified++
+			case errors.Is(verifyErr, ErrChecksumMismatch) || errors.Is(verifyErr, os.ErrNotExist):
+				report.Corrupted = append(report.Corrupted, entry.reference)
+			default:
+				return report, wrapError("scrub", entry.reference, verifyErr)
+			}
+		}
+
+		after = entries[len(entries)-1].reference
+	}
+}
+
+func (storage *FileStorage) recheckEntry(ctx context.Context, reference string) (scrubEntry, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return scrubEntry{}, ErrClosed
+	}
+
+	entries, err := storage.queryScrubEntries(ctx, "where reference = ?", reference)
+	if err != nil {
+		return scrubEntry{}, err
+	}
+
+	if len(entries) == 0 {
+		return scrubEntry{}, ErrNotFound
+	}
+
+	return entries[0], nil
+}
@@ -0,0 +1,192 @@
+package bloby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksum(t *testing.T) {
+	testDirName := "test-file-storage-TestChecksum"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorage(testDirName)
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, flag int, content string) {
+		writer, err := node.(*FileNode).GetFlagWriteCloser(flag)
+		assert.NoError(t, err)
+
+		writer.Write([]byte(content))
+		assert.NoError(t, writer.Close())
+	}
+
+	verify := func(node Node) (string, error) {
+		reader, err := node.(*FileNode).GetVerifyingReader()
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+
+		content, err := io.ReadAll(reader)
+
+		return string(content), err
+	}
+
+	sum := func(content string) string {
+		hash := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(hash[:])
+	}
+
+	node, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	// Node without content
+	_, err = node.(*FileNode).GetChecksum()
+	assert.ErrorIs(t, err, ErrNoChecksum)
+
+	write(node, os.O_RDWR|os.O_CREATE|os.O_TRUNC, "meow")
+
+	checksum, err := node.(*FileNode).GetChecksum()
+	assert.NoError(t, err)
+	assert.Equal(t, Checksum{SHA256: sum("meow"), Size: 4}, checksum)
+
+	// Append and overwrite keep checksum of whole content
+	write(node, os.O_RDWR|os.O_APPEND, " meow")
+
+	checksum, err = node.(*FileNode).GetChecksum()
+	assert.NoError(t, err)
+	assert.Equal(t, Checksum{SHA256: sum("meow meow"), Size: 9}, checksum)
+
+	write(node, os.O_RDWR, "MEOW")
+
+	checksum, err = node.(*FileNode).GetChecksum()
+	assert.NoError(t, err)
+	assert.Equal(t, Checksum{SHA256: sum("MEOW meow"), Size: 9}, checksum)
+
+	content, err := verify(node)
+	assert.NoError(t, err)
+	assert.Equal(t, "MEOW meow", content)
+
+	// Reader opened with checksum keeps reading content of the same write
+	reader, checksum, err := node.(*FileNode).GetSeekReaderWithChecksum()
+	assert.NoError(t, err)
+	assert.Equal(t, Checksum{SHA256: sum("MEOW meow"), Size: 9}, checksum)
+
+	write(node, os.O_RDWR|os.O_CREATE|os.O_TRUNC, "purr")
+
+	result, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, checksum.SHA256, sum(string(result)))
+	assert.NoError(t, reader.Close())
+
+	write(node, os.O_RDWR|os.O_CREATE|os.O_TRUNC, "MEOW meow")
+
+	// Bit rot
+	assert.NoError(t, os.WriteFile(node.(*FileNode).GetPath(), []byte("MEOW meoW"), 0644))
+
+	_, err = verify(node)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// Truncated and extended content
+	assert.NoError(t, os.WriteFile(node.(*FileNode).GetPath(), []byte("MEOW"), 0644))
+
+	_, err = verify(node)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	assert.NoError(t, os.WriteFile(node.(*FileNode).GetPath(), []byte("MEOW meow meow"), 0644))
+
+	_, err = verify(node)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// Scrub
+	healthy, err := storage.Create("healthy", nil)
+	assert.NoError(t, err)
+	write(healthy, os.O_RDWR|os.O_CREATE|os.O_TRUNC, "purr")
+
+	legacy, err := storage.Create("legacy", nil)
+	assert.NoError(t, err)
+	write(legacy, os.O_RDWR|os.O_CREATE|os.O_TRUNC, "hiss")
+
+	_, err = storage.db.Exec("update metadata set checksum = null, size = null where reference = ?", legacy.GetReference())
+	assert.NoError(t, err)
+
+	_, err = storage.Create("empty", nil)
+	assert.NoError(t, err)
+
+	report, err := storage.Scrub()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Verified)
+	assert.Equal(t, []string{node.GetReference()}, report.Corrupted)
+	assert.Equal(t, []string{legacy.GetReference()}, report.Unverified)
+
+	// Rewrite records checksum again
+	write(node, os.O_RDWR|os.O_CREATE|os.O_TRUNC, "meow")
+
+	report, err = storage.Scrub()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Verified)
+	assert.Empty(t, report.Corrupted)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	_, err = storage.Scrub()
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestChecksumContentAddressed(t *testing.T) {
+	testDirName := "test-file-storage-TestChecksumContentAddressed"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: true})
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, content string) {
+		writer, err := node.(*FileNode).GetWriteCloser()
+		assert.NoError(t, err)
+
+		writer.Write([]byte(content))
+		assert.NoError(t, writer.Close())
+	}
+
+	node1, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+	write(node1, "meow")
+
+	node2, err := storage.Create("more cats", nil)
+	assert.NoError(t, err)
+	write(node2, "meow")
+
+	checksum, err := node2.(*FileNode).GetChecksum()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), checksum.Size)
+	assert.Equal(t, node2.(*FileNode).GetPath(), storage.getPathByBlob(checksum.SHA256))
+
+	report, err := storage.Scrub()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Verified)
+
+	// Corrupted blob affects all nodes sharing it
+	assert.NoError(t, os.WriteFile(node1.(*FileNode).GetPath(), []byte("woof"), 0644))
+
+	report, err = storage.Scrub()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Verified)
+	assert.ElementsMatch(t, []string{node1.GetReference(), node2.GetReference()}, report.Corrupted)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bitrate16/bloby"
+)
+
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	namePrefix := flags.String("prefix", "", "export nodes with name prefix")
+	namePostfix := flags.String("postfix", "", "export nodes with name postfix")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby export [flags] <storage path> <archive>")
+		fmt.Fprintln(os.Stderr, "archive is written to standard output if archive is -")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	if flags.Arg(1) == "-" {
+		err = bloby.ExportBy(storage, os.Stdout, *namePrefix, *namePostfix)
+		if err != nil {
+			return fail(err)
+		}
+
+		return 0
+	}
+
+	file, err := os.Create(flags.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	err = bloby.ExportBy(storage, file, *namePrefix, *namePostfix)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	// Incomplete archive is removed
+	if err != nil {
+		os.Remove(flags.Arg(1))
+		return fail(err)
+	}
+
+	return 0
+}
+
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	create := flags.Bool("create", false, "create storage if it does not exist")
+	verbose := flags.Bool("v", false, "print exported and imported reference of each node")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby import [flags] <storage path> <archive>")
+		fmt.Fprintln(os.Stderr, "archive is read from standard input if archive is -")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	var reader io.Reader = os.Stdin
+	if flags.Arg(1) != "-" {
+		file, err := os.Open(flags.Arg(1))
+		if err != nil {
+			return fail(err)
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	var storage *bloby.FileStorage
+	var err error
+
+	if *create {
+		storage = bloby.NewFileStorageWithOptions(flags.Arg(0), storageFlags.options())
+		err = storage.Open()
+	} else {
+		storage, err = openStorage(flags.Arg(0), storageFlags.options())
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	references, err := bloby.Import(storage, reader)
+
+	if *verbose {
+		for exported, imported := range references {
+			fmt.Println(exported, imported)
+		}
+	}
+
+	if err != nil {
+		return fail(fmt.Errorf("%w, %d nodes imported", err, len(references)))
+	}
+
+	fmt.Printf("%d nodes imported\n", len(references))
+
+	return 0
+}
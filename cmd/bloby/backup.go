@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runBackup(args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby backup [flags] <storage path> <backup path>")
+		fmt.Fprintln(os.Stderr, "backup path must not exist, use -shared to back up storage used by running service")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	err = storage.Backup(flags.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
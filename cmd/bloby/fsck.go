@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bitrate16/bloby"
+)
+
+func runFsck(args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	repair := flags.Bool("repair", false, "remove orphan files, stale temporary files and fix blob records")
+	quarantine := flags.Bool("quarantine", false, "move orphan files into quarantine/ instead of removing them")
+	deleteMissing := flags.Bool("delete-missing", false, "delete nodes without content")
+	tempFileAge := flags.Duration("temp-age", bloby.DefaultTempFileAge, "minimal age of temporary files to remove")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby fsck [flags] <storage path>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer storage.Close()
+
+	var report bloby.CheckReport
+
+	if *repair || *deleteMissing {
+		report, err = storage.Repair(bloby.RepairOptions{
+			Quarantine:           *quarantine,
+			DeleteMissingContent: *deleteMissing,
+			TempFileAge:          *tempFileAge,
+		})
+	} else {
+		report, err = storage.Check()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, path := range report.OrphanFiles {
+		fmt.Println("orphan file:", path)
+	}
+
+	for _, path := range report.TempFiles {
+		fmt.Println("temporary file:", path)
+	}
+
+	for _, hash := range report.MissingBlobs {
+		fmt.Println("missing blob:", hash)
+	}
+
+	for _, hash := range report.BadRefcounts {
+		fmt.Println("bad refcount:", hash)
+	}
+
+	for _, reference := range report.MissingContent {
+		fmt.Println("no content:", reference)
+	}
+
+	fmt.Printf(
+		"%d orphan files, %d temporary files, %d missing blobs, %d bad refcounts, %d nodes without content\n",
+		len(report.OrphanFiles),
+		len(report.TempFiles),
+		len(report.MissingBlobs),
+		len(report.BadRefcounts),
+		len(report.MissingContent),
+	)
+
+	if *repair || *deleteMissing {
+		fmt.Println("repaired")
+		return 0
+	}
+
+	// Nodes without content are not reported as failure, since nodes may be created without writes
+	if len(report.OrphanFiles)+len(report.TempFiles)+len(report.MissingBlobs)+len(report.BadRefcounts) > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitrate16/bloby"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFsck(t *testing.T) {
+	path := t.TempDir()
+	createTestStorage(t, path, bloby.FileStorageOptions{}, map[string]string{"cats": "meow", "dogs": "woof"})
+
+	status, stdout, _ := runCommand(t, runFsck, path)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, stdout, "0 orphan files, 0 temporary files, 0 missing blobs, 0 bad refcounts, 0 nodes without content")
+
+	// Orphan file is reported and removed by repair
+	orphan := filepath.Join(path, "tree", "ab", "ab", "ab", strings.Repeat("ab", 25))
+	require.NoError(t, os.MkdirAll(filepath.Dir(orphan), 0755))
+	require.NoError(t, os.WriteFile(orphan, []byte("junk"), 0644))
+
+	status, stdout, _ = runCommand(t, runFsck, path)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stdout, "orphan file: "+filepath.Join("tree", "ab", "ab", "ab", strings.Repeat("ab", 25)))
+
+	status, stdout, _ = runCommand(t, runFsck, "-repair", path)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, stdout, "repaired")
+	assert.NoFileExists(t, orphan)
+
+	status, _, _ = runCommand(t, runFsck, path)
+	assert.Equal(t, 0, status)
+
+	// Missing storage is not created
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	status, _, stderr := runCommand(t, runFsck, missing)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "is not a storage")
+	assert.NoDirExists(t, missing)
+}
+
+func TestFsckContentAddressed(t *testing.T) {
+	path := t.TempDir()
+	options := bloby.FileStorageOptions{ContentAddressed: true}
+	createTestStorage(t, path, options, map[string]string{"cats": "meow", "more cats": "meow", "dogs": "woof"})
+
+	status, stdout, _ := runCommand(t, runFsck, "-content-addressed", path)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, stdout, "0 nodes without content")
+
+	// Storage opened without mode it was created with is left untouched
+	for _, args := range [][]string{{path}, {"-delete-missing", path}, {"-repair", path}} {
+		status, stdout, stderr := runCommand(t, runFsck, args...)
+		assert.Equal(t, 1, status, "fsck %v", args)
+		assert.Empty(t, stdout)
+		assert.Contains(t, stderr, bloby.ErrOptionsMismatch.Error())
+	}
+
+	assert.ElementsMatch(t, []string{"cats", "more cats", "dogs"}, listTestStorage(t, path, options))
+
+	status, _, _ = runCommand(t, runFsck, "-content-addressed", "-delete-missing", path)
+	assert.Equal(t, 0, status)
+	assert.ElementsMatch(t, []string{"cats", "more cats", "dogs"}, listTestStorage(t, path, options))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bitrate16/bloby"
+)
+
+func runGet(args []string) int {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	verify := flags.Bool("verify", false, "fail if content does not match recorded checksum")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby get [flags] <storage path> <reference or name> <file>")
+		fmt.Fprintln(os.Stderr, "content is written to standard output if file is -")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 3 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	node, err := findNode(storage, flags.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	if flags.Arg(2) == "-" {
+		return copyContent(node, os.Stdout, *verify)
+	}
+
+	// Partial file is removed on failure
+	file, err := os.Create(flags.Arg(2))
+	if err != nil {
+		return fail(err)
+	}
+
+	status := copyContent(node, file, *verify)
+
+	err = file.Close()
+	if status == 0 && err != nil {
+		status = fail(err)
+	}
+
+	if status != 0 {
+		os.Remove(flags.Arg(2))
+	}
+
+	return status
+}
+
+func runCat(args []string) int {
+	flags := flag.NewFlagSet("cat", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	verify := flags.Bool("verify", false, "fail if content does not match recorded checksum")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby cat [flags] <storage path> <reference or name>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	node, err := findNode(storage, flags.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	return copyContent(node, os.Stdout, *verify)
+}
+
+func copyContent(node *bloby.FileNode, writer io.Writer, verify bool) int {
+	var reader io.ReadCloser
+	var err error
+
+	if verify {
+		reader, err = node.GetVerifyingReader()
+	} else {
+		reader, err = node.GetSeekReader()
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(writer, reader)
+	if err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bitrate16/bloby"
+)
+
+func runLs(args []string) int {
+	flags := flag.NewFlagSet("ls", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	namePrefix := flags.String("prefix", "", "list nodes with name prefix")
+	namePostfix := flags.String("postfix", "", "list nodes with name postfix")
+	long := flags.Bool("l", false, "print size, modification time and content type")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby ls [flags] <storage path>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	options := bloby.ListOptions{
+		NamePrefix:  *namePrefix,
+		NamePostfix: *namePostfix,
+		Order:       bloby.OrderByName,
+		Limit:       1000,
+	}
+
+	err = storage.Walk(options, func(node bloby.Node) error {
+		fileNode := node.(*bloby.FileNode)
+
+		if *long {
+			fmt.Printf(
+				"%s %12d %s %-24s %s\n",
+				fileNode.GetReference(),
+				fileNode.GetSize(),
+				formatTime(fileNode.GetUpdatedAt()),
+				formatContentType(fileNode.GetContentType()),
+				fileNode.GetName(),
+			)
+		} else {
+			fmt.Printf("%s %s\n", fileNode.GetReference(), fileNode.GetName())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
+
+// Format time in local zone, unknown time is printed as dash
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format(time.DateTime)
+}
+
+func formatContentType(contentType string) string {
+	if contentType == "" {
+		return "-"
+	}
+
+	return contentType
+}
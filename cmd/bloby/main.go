@@ -0,0 +1,142 @@
+// Command bloby provides maintenance tools for FileStorage directories.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bitrate16/bloby"
+)
+
+type command struct {
+	description string
+	run         func(args []string) int
+}
+
+var commands = map[string]command{
+	"fsck":       {"check storage consistency and optionally repair it", runFsck},
+	"scrub":      {"verify content of all nodes against recorded checksums", runScrub},
+	"ls":         {"list nodes by name prefix and postfix", runLs},
+	"put":        {"create node from file or standard input", runPut},
+	"get":        {"write node content into file", runGet},
+	"cat":        {"write node content to standard output", runCat},
+	"rm":         {"delete nodes", runRm},
+	"mv":         {"rename node", runMv},
+	"meta":       {"print or replace node metadata", runMeta},
+	"stat":       {"print node attributes", runStat},
+	"path":       {"print path of node content file", runPath},
+	"export":     {"write nodes into tar archive", runExport},
+	"import":     {"restore nodes from tar archive written by export", runImport},
+	"backup":     {"write consistent copy of storage while it is in use", runBackup},
+	"rotate-key": {"encrypt content and metadata of encrypted storage with new key", runRotateKey},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bloby <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].description)
+	}
+}
+
+// Flags selecting how storage is opened, shared by all commands
+type storageFlags struct {
+	contentAddressed *bool
+	uniqueNames      *bool
+	shared           *bool
+	compression      *string
+}
+
+func addStorageFlags(flags *flag.FlagSet) storageFlags {
+	return storageFlags{
+		contentAddressed: flags.Bool("content-addressed", false, "storage uses content addressed mode, must match mode storage was created with"),
+		uniqueNames:      flags.Bool("unique-names", false, "enforce unique node names, constraint is kept by later opens without this flag"),
+		shared:           flags.Bool("shared", false, "open storage in shared lock mode instead of exclusive"),
+		compression:      flags.String("compression", "", "codec for written content: gzip, or empty to store content uncompressed"),
+	}
+}
+
+func (storageFlags storageFlags) options() bloby.FileStorageOptions {
+	options := bloby.FileStorageOptions{
+		ContentAddressed: *storageFlags.contentAddressed,
+		UniqueNames:      *storageFlags.uniqueNames,
+		LockMode:         bloby.LockExclusive,
+		Compression:      bloby.Codec(*storageFlags.compression),
+	}
+	if *storageFlags.shared {
+		options.LockMode = bloby.LockShared
+	}
+
+	return options
+}
+
+// Open existing storage, FileStorage.Open would create missing storage
+func openStorage(path string, options bloby.FileStorageOptions) (*bloby.FileStorage, error) {
+	_, err := os.Stat(filepath.Join(path, "metadata.db"))
+	if err != nil {
+		return nil, fmt.Errorf("bloby: %s is not a storage: %w", path, err)
+	}
+
+	storage := bloby.NewFileStorageWithOptions(path, options)
+
+	err = storage.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// Find node by reference or, if there is no such reference, by name
+func findNode(storage *bloby.FileStorage, key string) (*bloby.FileNode, error) {
+	node, err := storage.GetByReference(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if node == nil {
+		node, err = storage.GetByName(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if node == nil {
+		return nil, fmt.Errorf("bloby: node %q: %w", key, bloby.ErrNotFound)
+	}
+
+	return node.(*bloby.FileNode), nil
+}
+
+// Print error and return failure exit code
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "bloby: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(command.run(os.Args[2:]))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/bitrate16/bloby"
+	"github.com/stretchr/testify/require"
+)
+
+// Run command with standard output and error captured, returns exit status, output and error output
+func runCommand(t *testing.T, run func(args []string) int, args ...string) (int, string, string) {
+	t.Helper()
+
+	capture := func(file **os.File) func() string {
+		reader, writer, err := os.Pipe()
+		require.NoError(t, err)
+
+		original := *file
+		*file = writer
+
+		output := make(chan string)
+		go func() {
+			data, _ := io.ReadAll(reader)
+			reader.Close()
+			output <- string(data)
+		}()
+
+		return func() string {
+			*file = original
+			writer.Close()
+			return <-output
+		}
+	}
+
+	stdout := capture(&os.Stdout)
+	stderr := capture(&os.Stderr)
+
+	status := run(args)
+
+	return status, stdout(), stderr()
+}
+
+// Create storage holding nodes with given names and content
+func createTestStorage(t *testing.T, path string, options bloby.FileStorageOptions, nodes map[string]string) {
+	t.Helper()
+
+	storage := bloby.NewFileStorageWithOptions(path, options)
+	require.NoError(t, storage.Open())
+	defer storage.Close()
+
+	for name, content := range nodes {
+		node, err := storage.Create(name, nil)
+		require.NoError(t, err)
+
+		writer, err := node.(*bloby.FileNode).GetWriteCloser()
+		require.NoError(t, err)
+
+		_, err = writer.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+	}
+}
+
+// Get names of all nodes in storage
+func listTestStorage(t *testing.T, path string, options bloby.FileStorageOptions) []string {
+	t.Helper()
+
+	storage := bloby.NewFileStorageWithOptions(path, options)
+	require.NoError(t, storage.Open())
+	defer storage.Close()
+
+	nodes, err := storage.ListBy("", "")
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.GetName())
+	}
+
+	return names
+}
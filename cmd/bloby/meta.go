@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runMeta(args []string) int {
+	flags := flag.NewFlagSet("meta", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby meta [flags] get <storage path> <reference or name>")
+		fmt.Fprintln(os.Stderr, "       bloby meta [flags] set <storage path> <reference or name> <metadata JSON>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	set := flags.Arg(0) == "set"
+
+	switch {
+	case flags.Arg(0) == "get" && flags.NArg() == 3:
+	case set && flags.NArg() == 4:
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	var metadata interface{}
+	if set {
+		err := json.Unmarshal([]byte(flags.Arg(3)), &metadata)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bloby: invalid metadata:", err)
+			return 2
+		}
+	}
+
+	storage, err := openStorage(flags.Arg(1), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	node, err := findNode(storage, flags.Arg(2))
+	if err != nil {
+		return fail(err)
+	}
+
+	if set {
+		err = node.SetMetadata(metadata)
+		if err != nil {
+			return fail(err)
+		}
+
+		return 0
+	}
+
+	metadataBytes, err := json.Marshal(node.GetMetadata())
+	if err != nil {
+		return fail(err)
+	}
+
+	fmt.Println(string(metadataBytes))
+
+	return 0
+}
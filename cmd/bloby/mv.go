@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runMv(args []string) int {
+	flags := flag.NewFlagSet("mv", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby mv [flags] <storage path> <reference or name> <new name>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 3 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	node, err := findNode(storage, flags.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	err = node.SetName(flags.Arg(2))
+	if err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrate16/bloby"
+)
+
+func runPut(args []string) int {
+	flags := flag.NewFlagSet("put", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	name := flags.String("name", "", "node name, defaults to file name")
+	metadataJson := flags.String("metadata", "", "node metadata in JSON form")
+	contentType := flags.String("content-type", "", "node content type")
+	replace := flags.Bool("replace", false, "replace content and metadata of existing node with same name")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby put [flags] <storage path> <file>")
+		fmt.Fprintln(os.Stderr, "content is read from standard input if file is -")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	source := flags.Arg(1)
+
+	if *name == "" {
+		if source == "-" {
+			fmt.Fprintln(os.Stderr, "bloby: -name is required for standard input")
+			return 2
+		}
+
+		*name = filepath.Base(source)
+	}
+
+	var metadata interface{}
+	if *metadataJson != "" {
+		err := json.Unmarshal([]byte(*metadataJson), &metadata)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bloby: invalid metadata:", err)
+			return 2
+		}
+	}
+
+	var reader io.Reader = os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return fail(err)
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	// Existing node is replaced by writing content first, so failed write leaves both content and metadata unchanged
+	var node bloby.Node
+	created := false
+
+	if *replace {
+		node, err = storage.GetByName(*name)
+	}
+
+	if !*replace || errors.Is(err, bloby.ErrNotFound) {
+		node, err = storage.Create(*name, metadata)
+		created = true
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	fileNode := node.(*bloby.FileNode)
+
+	err = writeContent(fileNode, reader)
+	if err != nil {
+		// New node without content is not left behind
+		if created {
+			storage.Delete(fileNode.GetReference())
+		}
+
+		return fail(err)
+	}
+
+	if !created {
+		err = fileNode.SetMetadata(metadata)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	if *contentType != "" {
+		err = fileNode.SetContentType(*contentType)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	fmt.Println(fileNode.GetReference())
+
+	return 0
+}
+
+// Replace node content, content is left unchanged on read error
+func writeContent(node *bloby.FileNode, reader io.Reader) error {
+	writer, err := node.GetWriteCloser()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, reader)
+	if err != nil {
+		writer.(bloby.Abortable).Abort()
+		return err
+	}
+
+	return writer.Close()
+}
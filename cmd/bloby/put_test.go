@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitrate16/bloby"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutGet(t *testing.T) {
+	for _, contentAddressed := range []bool{false, true} {
+		path := t.TempDir()
+		options := bloby.FileStorageOptions{ContentAddressed: contentAddressed}
+		createTestStorage(t, path, options, nil)
+
+		var modeFlags []string
+		if contentAddressed {
+			modeFlags = []string{"-content-addressed"}
+		}
+
+		source := filepath.Join(t.TempDir(), "cats.txt")
+		require.NoError(t, os.WriteFile(source, []byte("meow"), 0644))
+
+		status, stdout, _ := runCommand(t, runPut, append(modeFlags, "-metadata", `{"color": "gray"}`, "-content-type", "text/plain", path, source)...)
+		require.Equal(t, 0, status)
+		reference := strings.TrimSpace(stdout)
+
+		// Node is found by name and by reference
+		target := filepath.Join(t.TempDir(), "result")
+
+		status, _, _ = runCommand(t, runGet, append(modeFlags, "-verify", path, "cats.txt", target)...)
+		assert.Equal(t, 0, status)
+
+		content, err := os.ReadFile(target)
+		assert.NoError(t, err)
+		assert.Equal(t, "meow", string(content))
+
+		status, stdout, _ = runCommand(t, runCat, append(modeFlags, path, reference)...)
+		assert.Equal(t, 0, status)
+		assert.Equal(t, "meow", stdout)
+
+		status, stdout, _ = runCommand(t, runGet, append(modeFlags, path, reference, "-")...)
+		assert.Equal(t, 0, status)
+		assert.Equal(t, "meow", stdout)
+
+		// Replace keeps reference
+		require.NoError(t, os.WriteFile(source, []byte("purr"), 0644))
+
+		status, stdout, _ = runCommand(t, runPut, append(modeFlags, "-replace", path, source)...)
+		assert.Equal(t, 0, status)
+		assert.Equal(t, reference, strings.TrimSpace(stdout))
+
+		status, stdout, _ = runCommand(t, runCat, append(modeFlags, path, "cats.txt")...)
+		assert.Equal(t, 0, status)
+		assert.Equal(t, "purr", stdout)
+
+		// Missing node fails without creating target
+		missing := filepath.Join(t.TempDir(), "missing")
+
+		status, _, stderr := runCommand(t, runGet, append(modeFlags, path, "dogs", missing)...)
+		assert.Equal(t, 1, status)
+		assert.Contains(t, stderr, bloby.ErrNotFound.Error())
+		assert.NoFileExists(t, missing)
+
+		// Opening storage with other mode fails before writing
+		otherModeFlags := []string{"-content-addressed"}
+		if contentAddressed {
+			otherModeFlags = nil
+		}
+
+		status, _, stderr = runCommand(t, runPut, append(otherModeFlags, "-name", "dogs", path, source)...)
+		assert.Equal(t, 1, status)
+		assert.Contains(t, stderr, bloby.ErrOptionsMismatch.Error())
+
+		status, _, stderr = runCommand(t, runCat, append(otherModeFlags, path, "cats.txt")...)
+		assert.Equal(t, 1, status)
+		assert.Contains(t, stderr, bloby.ErrOptionsMismatch.Error())
+
+		assert.Equal(t, []string{"cats.txt"}, listTestStorage(t, path, options))
+
+		if contentAddressed {
+			assert.NoDirExists(t, filepath.Join(path, "tree"))
+		} else {
+			assert.NoDirExists(t, filepath.Join(path, "blobs"))
+		}
+	}
+}
+
+func TestPutUniqueNames(t *testing.T) {
+	path := t.TempDir()
+	createTestStorage(t, path, bloby.FileStorageOptions{}, nil)
+
+	source := filepath.Join(t.TempDir(), "cats")
+	require.NoError(t, os.WriteFile(source, []byte("meow"), 0644))
+
+	status, _, _ := runCommand(t, runPut, "-unique-names", path, source)
+	assert.Equal(t, 0, status)
+
+	// Constraint is kept without flag
+	status, _, stderr := runCommand(t, runPut, path, source)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, bloby.ErrNameConflict.Error())
+
+	status, _, _ = runCommand(t, runPut, "-replace", path, source)
+	assert.Equal(t, 0, status)
+
+	assert.Equal(t, []string{"cats"}, listTestStorage(t, path, bloby.FileStorageOptions{}))
+}
+
+func TestPutReplaceFailure(t *testing.T) {
+	path := t.TempDir()
+	createTestStorage(t, path, bloby.FileStorageOptions{}, map[string]string{"cats": "meow"})
+
+	// Directory is opened, but can not be read
+	source := filepath.Join(t.TempDir(), "cats")
+	require.NoError(t, os.Mkdir(source, 0755))
+
+	status, _, _ := runCommand(t, runPut, "-replace", "-metadata", `{"color": "gray"}`, path, source)
+	assert.Equal(t, 1, status)
+
+	status, stdout, _ := runCommand(t, runCat, path, "cats")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "meow", stdout)
+
+	storage := bloby.NewFileStorage(path)
+	require.NoError(t, storage.Open())
+	defer storage.Close()
+
+	node, err := storage.GetByName("cats")
+	require.NoError(t, err)
+	assert.Nil(t, node.GetMetadata())
+}
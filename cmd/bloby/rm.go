@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runRm(args []string) int {
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	namePrefix := flags.String("prefix", "", "delete all nodes with name prefix")
+	namePostfix := flags.String("postfix", "", "delete all nodes with name postfix")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby rm [flags] <storage path> [reference or name...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// Nodes are deleted either by name prefix and postfix or by given references and names
+	byName := *namePrefix != "" || *namePostfix != ""
+
+	if flags.NArg() < 1 || (byName && flags.NArg() != 1) || (!byName && flags.NArg() == 1) {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	if byName {
+		err = storage.DeleteBy(*namePrefix, *namePostfix)
+		if err != nil {
+			return fail(err)
+		}
+
+		return 0
+	}
+
+	status := 0
+
+	for _, key := range flags.Args()[1:] {
+		node, err := findNode(storage, key)
+		if err == nil {
+			err = storage.Delete(node.GetReference())
+		}
+
+		if err != nil {
+			status = fail(err)
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bitrate16/bloby"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRm(t *testing.T) {
+	path := t.TempDir()
+	createTestStorage(t, path, bloby.FileStorageOptions{}, map[string]string{
+		"cats/tom":     "meow",
+		"cats/felix":   "meow",
+		"dogs/rex":     "woof",
+		"birds/tweety": "tweet",
+	})
+
+	// By name and by prefix
+	status, _, _ := runCommand(t, runRm, path, "dogs/rex")
+	assert.Equal(t, 0, status)
+	assert.ElementsMatch(t, []string{"cats/tom", "cats/felix", "birds/tweety"}, listTestStorage(t, path, bloby.FileStorageOptions{}))
+
+	status, _, _ = runCommand(t, runRm, "-prefix", "cats/", path)
+	assert.Equal(t, 0, status)
+	assert.ElementsMatch(t, []string{"birds/tweety"}, listTestStorage(t, path, bloby.FileStorageOptions{}))
+
+	// Missing nodes fail, other nodes are deleted
+	status, _, stderr := runCommand(t, runRm, path, "missing", "birds/tweety")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, bloby.ErrNotFound.Error())
+	assert.Empty(t, listTestStorage(t, path, bloby.FileStorageOptions{}))
+
+	// Usage errors
+	status, _, stderr = runCommand(t, runRm, path)
+	assert.Equal(t, 2, status)
+	assert.True(t, strings.HasPrefix(stderr, "usage:"))
+
+	status, _, _ = runCommand(t, runRm, "-prefix", "cats/", path, "cats/tom")
+	assert.Equal(t, 2, status)
+}
+
+func TestRmContentAddressed(t *testing.T) {
+	path := t.TempDir()
+	options := bloby.FileStorageOptions{ContentAddressed: true}
+	createTestStorage(t, path, options, map[string]string{"cats": "meow", "dogs": "woof"})
+
+	// Storage opened without mode it was created with is left untouched
+	status, _, stderr := runCommand(t, runRm, "-prefix", "c", path)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, bloby.ErrOptionsMismatch.Error())
+	assert.ElementsMatch(t, []string{"cats", "dogs"}, listTestStorage(t, path, options))
+
+	status, _, _ = runCommand(t, runRm, "-content-addressed", path, "cats")
+	assert.Equal(t, 0, status)
+	assert.ElementsMatch(t, []string{"dogs"}, listTestStorage(t, path, options))
+}
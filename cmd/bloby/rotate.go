@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bitrate16/bloby"
+)
+
+// Keys read from -keys file
+type keyFile struct {
+	// ID of key to encrypt with
+	Current string `json:"current"`
+	// Base64 encoded 32 bytes AES-256 keys by ID
+	Keys map[string]string `json:"keys"`
+}
+
+// Load key provider from key file, current key is taken from key file unless keyID is set
+func loadKeys(path string, keyID string) (*bloby.StaticKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyFile
+
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("bloby: invalid key file %s: %w", path, err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("bloby: invalid key %q in %s: %w", id, path, err)
+		}
+
+		keys[id] = key
+	}
+
+	if keyID == "" {
+		keyID = file.Current
+	}
+
+	return bloby.NewStaticKeyProvider(keyID, keys), nil
+}
+
+func runRotateKey(args []string) int {
+	flags := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	keysPath := flags.String("keys", "", "JSON key file {\"current\": id, \"keys\": {id: base64 key}} holding new and previous keys")
+	keyID := flags.String("key-id", "", "ID of key to encrypt with, defaults to current key of key file")
+	encryptMetadata := flags.Bool("encrypt-metadata", false, "encrypt metadata stored unencrypted")
+	verbose := flags.Bool("v", false, "print reference of each rotated node")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby rotate-key [flags] <storage path>")
+		fmt.Fprintln(os.Stderr, "nodes encrypted with new key already are skipped, so interrupted rotation is resumed by running it again")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *keysPath == "" {
+		flags.Usage()
+		return 2
+	}
+
+	keys, err := loadKeys(*keysPath, *keyID)
+	if err != nil {
+		return fail(err)
+	}
+
+	fileStorage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer fileStorage.Close()
+
+	storage := bloby.NewEncryptedStorageWithOptions(fileStorage, keys, bloby.EncryptedStorageOptions{EncryptMetadata: *encryptMetadata})
+
+	report, err := storage.RotateKeys(bloby.RotateOptions{
+		Progress: func(progress bloby.RotateProgress) {
+			if *verbose && progress.Rotated {
+				fmt.Println(progress.Reference)
+			}
+
+			if progress.Done%1000 == 0 || progress.Done == progress.Total {
+				fmt.Fprintf(os.Stderr, "%d/%d nodes processed\n", progress.Done, progress.Total)
+			}
+		},
+	})
+
+	if err != nil {
+		return fail(fmt.Errorf("%w, %d nodes rotated", err, report.Rotated))
+	}
+
+	fmt.Printf("%d rotated, %d skipped\n", report.Rotated, report.Skipped)
+
+	return 0
+}
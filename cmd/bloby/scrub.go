@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runScrub(args []string) int {
+	flags := flag.NewFlagSet("scrub", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby scrub [flags] <storage path>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer storage.Close()
+
+	report, err := storage.Scrub()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, reference := range report.Corrupted {
+		fmt.Println("corrupted:", reference)
+	}
+
+	for _, reference := range report.Unverified {
+		fmt.Println("unverified:", reference)
+	}
+
+	fmt.Printf("%d verified, %d corrupted, %d unverified\n", report.Verified, len(report.Corrupted), len(report.Unverified))
+
+	if len(report.Corrupted) > 0 {
+		return 1
+	}
+
+	return 0
+}
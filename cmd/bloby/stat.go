@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bitrate16/bloby"
+)
+
+func runStat(args []string) int {
+	flags := flag.NewFlagSet("stat", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby stat [flags] <storage path> <reference or name>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	node, err := findNode(storage, flags.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	checksum := "-"
+	if nodeChecksum, err := node.GetChecksum(); err == nil {
+		checksum = nodeChecksum.SHA256
+	} else if !errors.Is(err, bloby.ErrNoChecksum) {
+		return fail(err)
+	}
+
+	codec := string(node.GetCodec())
+	if codec == "" {
+		codec = "none"
+	}
+
+	metadataBytes, err := json.Marshal(node.GetMetadata())
+	if err != nil {
+		return fail(err)
+	}
+
+	fmt.Println("reference:   ", node.GetReference())
+	fmt.Println("name:        ", node.GetName())
+	fmt.Println("size:        ", node.GetSize())
+	fmt.Println("created:     ", formatTime(node.GetCreatedAt()))
+	fmt.Println("updated:     ", formatTime(node.GetUpdatedAt()))
+	fmt.Println("content type:", formatContentType(node.GetContentType()))
+	fmt.Println("sha256:      ", checksum)
+	fmt.Println("codec:       ", codec)
+	fmt.Println("path:        ", node.GetPath())
+	fmt.Println("metadata:    ", string(metadataBytes))
+
+	return 0
+}
+
+func runPath(args []string) int {
+	flags := flag.NewFlagSet("path", flag.ExitOnError)
+	storageFlags := addStorageFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bloby path [flags] <storage path> <reference or name>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := openStorage(flags.Arg(0), storageFlags.options())
+	if err != nil {
+		return fail(err)
+	}
+	defer storage.Close()
+
+	node, err := findNode(storage, flags.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	path := node.GetPath()
+	if path == "" {
+		return fail(fmt.Errorf("bloby: node %s has no content", node.GetReference()))
+	}
+
+	fmt.Println(path)
+
+	return 0
+}
@@ -0,0 +1,217 @@
+package bloby
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// Encoding of node content on disk, recorded per node
+type Codec string
+
+const (
+	// Content is stored as written
+	CodecNone Codec = ""
+	// Content is stored compressed with gzip
+	CodecGzip Codec = "gzip"
+)
+
+// Check that codec is supported, unknown codecs are reported as errors.ErrUnsupported
+func checkCodec(codec Codec) error {
+	switch codec {
+	case CodecNone, CodecGzip:
+		return nil
+	}
+
+	return fmt.Errorf("codec %q: %w", codec, errors.ErrUnsupported)
+}
+
+// Blob name of content with given hash, compressed content is stored in separate blob from uncompressed one
+func blobName(hash string, codec Codec) string {
+	if codec == CodecNone {
+		return hash
+	}
+
+	return hash + "." + string(codec)
+}
+
+// Get writer compressing content into w, Close flushes compressed stream without closing w
+func newEncoder(codec Codec, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case CodecGzip:
+		return gzip.NewWriter(w), nil
+	}
+
+	return nil, checkCodec(codec)
+}
+
+// Get reader decompressing content from r
+func newDecoder(codec Codec, r io.Reader) (io.Reader, error) {
+	switch codec {
+	case CodecGzip:
+		return gzip.NewReader(r)
+	}
+
+	return nil, checkCodec(codec)
+}
+
+// Open content file, compressed content is decompressed with size being size of decompressed content
+func openContent(path string, codec Codec, size int64) (ReadSeekCloserAt, error) {
+	err := checkCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if codec == CodecNone {
+		return file, nil
+	}
+
+	return &decodingReader{
+		file:  file,
+		codec: codec,
+		size:  size,
+	}, nil
+}
+
+// Reader of compressed content file.
+//
+// Compressed stream can be read only sequentially, so seeking backwards restarts decompression and seeking forward discards content.
+// ReadAt keeps its own stream, so ascending ReadAt calls continue decompression and do not affect Read.
+type decodingReader struct {
+	file  *os.File
+	codec Codec
+	size  int64
+	// Decompressed stream and its position, nil until first Read
+	decoder io.Reader
+	offset  int64
+	// Position set by Seek
+	position int64
+	// Decompressed stream of ReadAt and its position, nil until first ReadAt, guarded by lock for parallel ReadAt calls
+	lock      sync.Mutex
+	atDecoder io.Reader
+	atOffset  int64
+}
+
+// Report malformed compressed stream as ErrChecksumMismatch, keeping decoder error in chain
+func decodeError(err error) error {
+	var corruptInputError flate.CorruptInputError
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.As(err, &corruptInputError) {
+		return fmt.Errorf("%w: %w", ErrChecksumMismatch, err)
+	}
+
+	return err
+}
+
+// Start decompression from the start of file
+func (reader *decodingReader) open() (io.Reader, error) {
+	decoder, err := newDecoder(reader.codec, io.NewSectionReader(reader.file, 0, math.MaxInt64))
+	if err == io.EOF {
+		// Compressed stream has header even for empty content
+		err = io.ErrUnexpectedEOF
+	}
+
+	return decoder, decodeError(err)
+}
+
+func (reader *decodingReader) Read(p []byte) (int, error) {
+	if reader.decoder == nil || reader.position < reader.offset {
+		decoder, err := reader.open()
+		if err != nil {
+			return 0, err
+		}
+
+		reader.decoder = decoder
+		reader.offset = 0
+	}
+
+	if reader.position > reader.offset {
+		n, err := io.CopyN(io.Discard, reader.decoder, reader.position-reader.offset)
+		reader.offset += n
+		if err != nil {
+			return 0, decodeError(err)
+		}
+	}
+
+	n, err := reader.decoder.Read(p)
+	reader.offset += int64(n)
+	reader.position = reader.offset
+
+	return n, decodeError(err)
+}
+
+func (reader *decodingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.position
+	case io.SeekEnd:
+		offset += reader.size
+	default:
+		return 0, errors.New("bloby: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("bloby: negative position")
+	}
+
+	reader.position = offset
+
+	return offset, nil
+}
+
+func (reader *decodingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("bloby: negative offset")
+	}
+
+	reader.lock.Lock()
+	defer reader.lock.Unlock()
+
+	if reader.atDecoder == nil || off < reader.atOffset {
+		decoder, err := reader.open()
+		if err != nil {
+			return 0, err
+		}
+
+		reader.atDecoder = decoder
+		reader.atOffset = 0
+	}
+
+	skipped, err := io.CopyN(io.Discard, reader.atDecoder, off-reader.atOffset)
+	reader.atOffset += skipped
+	if err == io.EOF {
+		return 0, io.EOF
+	}
+	if err != nil {
+		reader.atDecoder = nil
+		return 0, decodeError(err)
+	}
+
+	n, err := io.ReadFull(reader.atDecoder, p)
+	reader.atOffset += int64(n)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		reader.atDecoder = nil
+	}
+
+	if err == io.ErrUnexpectedEOF && off+int64(n) >= reader.size {
+		// Short read at the end of content, truncated stream is reported by decoder the same way
+		err = io.EOF
+	}
+
+	return n, decodeError(err)
+}
+
+func (reader *decodingReader) Close() error {
+	return reader.file.Close()
+}
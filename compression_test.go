@@ -0,0 +1,256 @@
+package bloby
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *testing.T) {
+	testDirName := "test-file-storage-TestCompression"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{Compression: CodecGzip})
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, flag int, codec Codec, content string) {
+		writer, err := node.(*FileNode).GetFlagWriteCloserWithCodec(flag, codec)
+		assert.NoError(t, err)
+
+		writer.Write([]byte(content))
+		assert.NoError(t, writer.Close())
+	}
+
+	read := func(node Node) string {
+		reader, err := node.(*FileNode).GetVerifyingReader()
+		assert.NoError(t, err)
+		defer reader.Close()
+
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+
+		return string(content)
+	}
+
+	logs := strings.Repeat("{\"level\":\"info\",\"message\":\"meow\"}\n", 1000)
+
+	node, err := storage.Create("logs", nil)
+	assert.NoError(t, err)
+
+	writer, err := node.(*FileNode).GetWriteCloser()
+	assert.NoError(t, err)
+	writer.Write([]byte(logs))
+	assert.NoError(t, writer.Close())
+
+	assert.Equal(t, CodecGzip, node.(*FileNode).GetCodec())
+	assert.Equal(t, int64(len(logs)), node.(*FileNode).GetSize())
+	assert.Equal(t, logs, read(node))
+
+	// Content is compressed on disk
+	stored, err := os.ReadFile(node.(*FileNode).GetPath())
+	assert.NoError(t, err)
+	assert.Less(t, len(stored), len(logs)/10)
+	assert.Equal(t, []byte{0x1f, 0x8b}, stored[:2])
+
+	checksum, err := node.(*FileNode).GetChecksum()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(logs)), checksum.Size)
+
+	// Random access to decompressed content
+	reader, err := node.(*FileNode).GetSeekReader()
+	assert.NoError(t, err)
+
+	size, err := reader.Seek(0, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(logs)), size)
+
+	buffer := make([]byte, 5)
+
+	_, err = reader.Seek(int64(len(logs))-5, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(reader, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, logs[len(logs)-5:], string(buffer))
+
+	_, err = reader.Seek(1, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(reader, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"leve", string(buffer))
+
+	n, err := reader.ReadAt(buffer, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, logs[10:15], string(buffer[:n]))
+
+	n, err = reader.ReadAt(buffer, int64(len(logs))-2)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "}\n", string(buffer[:n]))
+
+	// ReadAt restarts after reading backwards and does not move position of Read
+	for _, offset := range []int{1, 100, 100, 20} {
+		n, err = reader.ReadAt(buffer, int64(offset))
+		assert.NoError(t, err)
+		assert.Equal(t, logs[offset:offset+5], string(buffer[:n]))
+	}
+
+	_, err = io.ReadFull(reader, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, logs[6:11], string(buffer))
+
+	assert.NoError(t, reader.Close())
+
+	// Append and overwrite decompress existing content
+	write(node, os.O_RDWR|os.O_APPEND, CodecGzip, "purr")
+	assert.Equal(t, logs+"purr", read(node))
+
+	write(node, os.O_RDWR, CodecGzip, "[")
+	assert.Equal(t, "["+logs[1:]+"purr", read(node))
+
+	// Codec chosen per node, existing content is stored again with new codec
+	write(node, os.O_RDWR|os.O_APPEND, CodecNone, "!")
+	assert.Equal(t, CodecNone, node.(*FileNode).GetCodec())
+	assert.Equal(t, "["+logs[1:]+"purr!", read(node))
+
+	stored, err = os.ReadFile(node.(*FileNode).GetPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "["+logs[1:]+"purr!", string(stored))
+
+	plain, err := storage.Create("plain", nil)
+	assert.NoError(t, err)
+	write(plain, os.O_RDWR|os.O_CREATE|os.O_TRUNC, CodecNone, "meow")
+
+	compressed, err := storage.Create("compressed", nil)
+	assert.NoError(t, err)
+	write(compressed, os.O_RDWR|os.O_CREATE|os.O_TRUNC, CodecGzip, "")
+	assert.Equal(t, "", read(compressed))
+
+	_, err = plain.(*FileNode).GetFlagWriteCloserWithCodec(os.O_RDWR, Codec("lz4"))
+	assert.True(t, errors.Is(err, errors.ErrUnsupported))
+
+	report, err := storage.Scrub()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Verified)
+
+	// Corrupted compressed content
+	write(compressed, os.O_RDWR|os.O_CREATE|os.O_TRUNC, CodecGzip, logs)
+
+	stored, err = os.ReadFile(compressed.(*FileNode).GetPath())
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(compressed.(*FileNode).GetPath(), stored[:len(stored)/2], 0644))
+
+	report, err = storage.Scrub()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{compressed.GetReference()}, report.Corrupted)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Codec is recorded per node, so compressed content is readable with compression disabled
+	storage = NewFileStorage(testDirName)
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	node, err = storage.GetByName("logs")
+	assert.NoError(t, err)
+	assert.Equal(t, CodecNone, node.(*FileNode).GetCodec())
+
+	write(node, os.O_RDWR|os.O_CREATE|os.O_TRUNC, CodecGzip, logs)
+
+	node, err = storage.GetByName("logs")
+	assert.NoError(t, err)
+	assert.Equal(t, CodecGzip, node.(*FileNode).GetCodec())
+	assert.Equal(t, logs, read(node))
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	storage = NewFileStorageWithOptions(testDirName, FileStorageOptions{Compression: Codec("lz4")})
+	err = storage.Open()
+	assert.True(t, errors.Is(err, errors.ErrUnsupported))
+}
+
+func TestCompressionContentAddressed(t *testing.T) {
+	testDirName := "test-file-storage-TestCompressionContentAddressed"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: true})
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, codec Codec, content string) {
+		writer, err := node.(*FileNode).GetFlagWriteCloserWithCodec(os.O_RDWR|os.O_CREATE|os.O_TRUNC, codec)
+		assert.NoError(t, err)
+
+		writer.Write([]byte(content))
+		assert.NoError(t, writer.Close())
+	}
+
+	content := bytes.Repeat([]byte("meow "), 100)
+
+	node1, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+	write(node1, CodecGzip, string(content))
+
+	node2, err := storage.Create("more cats", nil)
+	assert.NoError(t, err)
+	write(node2, CodecGzip, string(content))
+
+	node3, err := storage.Create("plain cats", nil)
+	assert.NoError(t, err)
+	write(node3, CodecNone, string(content))
+
+	// Compressed and uncompressed content is stored in separate blobs with same checksum
+	assert.Equal(t, node1.(*FileNode).GetPath(), node2.(*FileNode).GetPath())
+	assert.NotEqual(t, node1.(*FileNode).GetPath(), node3.(*FileNode).GetPath())
+
+	checksum1, err := node1.(*FileNode).GetChecksum()
+	assert.NoError(t, err)
+	checksum3, err := node3.(*FileNode).GetChecksum()
+	assert.NoError(t, err)
+	assert.Equal(t, checksum1, checksum3)
+
+	for _, node := range []Node{node1, node2, node3} {
+		reader, err := node.(*FileNode).GetReader()
+		assert.NoError(t, err)
+
+		read, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, content, read)
+
+		reader.(io.Closer).Close()
+	}
+
+	report, err := storage.Check()
+	assert.NoError(t, err)
+	assert.Empty(t, report.OrphanFiles)
+	assert.Empty(t, report.MissingBlobs)
+	assert.Empty(t, report.BadRefcounts)
+
+	scrubReport, err := storage.Scrub()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, scrubReport.Verified)
+
+	// Blob is removed with last node referencing it
+	path := node1.(*FileNode).GetPath()
+
+	assert.NoError(t, storage.Delete(node1.GetReference()))
+	assert.FileExists(t, path)
+
+	assert.NoError(t, storage.Delete(node2.GetReference()))
+	assert.NoFileExists(t, path)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
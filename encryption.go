@@ -0,0 +1,1356 @@
+package bloby
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Source of keys for EncryptedStorage.
+//
+// Keys are looked up by ID recorded in encrypted content and metadata, so previous keys must stay available until nodes are re-encrypted.
+type KeyProvider interface {
+	// Get ID of key used to encrypt new content and metadata
+	CurrentKeyID() (string, error)
+	// Get 32 bytes AES-256 key, returns ErrUnknownKey for unknown ID
+	GetKey(keyID string) ([]byte, error)
+}
+
+// Key provider holding keys in memory
+type StaticKeyProvider struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+func NewStaticKeyProvider(currentKeyID string, keys map[string][]byte) *StaticKeyProvider {
+	provider := &StaticKeyProvider{
+		currentKeyID: currentKeyID,
+		keys:         make(map[string][]byte, len(keys)),
+	}
+
+	for keyID, key := range keys {
+		provider.keys[keyID] = append([]byte(nil), key...)
+	}
+
+	return provider
+}
+
+func (provider *StaticKeyProvider) CurrentKeyID() (string, error) {
+	if _, ok := provider.keys[provider.currentKeyID]; !ok {
+		return "", fmt.Errorf("key %q: %w", provider.currentKeyID, ErrUnknownKey)
+	}
+
+	return provider.currentKeyID, nil
+}
+
+func (provider *StaticKeyProvider) GetKey(keyID string) ([]byte, error) {
+	key, ok := provider.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q: %w", keyID, ErrUnknownKey)
+	}
+
+	return key, nil
+}
+
+// Encrypted content layout.
+//
+// Header holds magic, format version, key ID length, key ID padded to MaxKeyIDLength and random data key encrypted with key from KeyProvider.
+// Data key is authenticated together with preceding header fields and node reference, so content moved to another node fails authentication.
+// Header is followed by chunks of encryptionChunkSize plaintext bytes encrypted with data key by AES-GCM, the last chunk may be shorter or empty.
+// Chunk nonce holds chunk index and last chunk flag, so reordered, dropped and truncated chunks fail authentication.
+const (
+	encryptionMagic   = "BLBE"
+	encryptionVersion = 1
+
+	// Maximum length of key ID, header has fixed size so that plaintext size is known from content size
+	MaxKeyIDLength = 64
+
+	encryptionKeySize   = 32
+	encryptionNonceSize = 12
+	encryptionTagSize   = 16
+	encryptionChunkSize = 64 * 1024
+	// Magic, version and key ID length precede key ID
+	encryptionKeyIDOffset   = 4 + 2
+	encryptionDataKeyOffset = encryptionKeyIDOffset + MaxKeyIDLength
+	encryptionHeaderSize    = encryptionDataKeyOffset + encryptionNonceSize + encryptionKeySize + encryptionTagSize
+)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("bloby: encryption key must be %d bytes, got %d", encryptionKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	result := make([]byte, n)
+
+	_, err := rand.Read(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Nonce of content chunk, data key is unique per content, so nonces are never reused
+func chunkNonce(index int64, last bool) []byte {
+	nonce := make([]byte, encryptionNonceSize)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+
+	if last {
+		nonce[8] = 1
+	}
+
+	return nonce
+}
+
+// Get amount of chunks and plaintext size of encrypted content of given size
+func encryptedLayout(size int64) (int64, int64, error) {
+	body := size - encryptionHeaderSize
+	if body < encryptionTagSize {
+		return 0, 0, fmt.Errorf("%w: content is truncated", ErrDecryptionFailed)
+	}
+
+	chunks := (body + encryptionChunkSize + encryptionTagSize - 1) / (encryptionChunkSize + encryptionTagSize)
+
+	last := body - (chunks-1)*(encryptionChunkSize+encryptionTagSize)
+	if last < encryptionTagSize {
+		return 0, 0, fmt.Errorf("%w: content is truncated", ErrDecryptionFailed)
+	}
+
+	return chunks, body - chunks*encryptionTagSize, nil
+}
+
+// Get key ID recorded in content header
+func parseHeaderKeyID(header []byte) (string, error) {
+	if len(header) < encryptionHeaderSize || string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return "", fmt.Errorf("%w: content is not encrypted", ErrDecryptionFailed)
+	}
+
+	if header[len(encryptionMagic)] != encryptionVersion {
+		return "", fmt.Errorf("%w: unsupported format version %d", ErrDecryptionFailed, header[len(encryptionMagic)])
+	}
+
+	length := int(header[len(encryptionMagic)+1])
+	if length > MaxKeyIDLength {
+		return "", fmt.Errorf("%w: invalid header", ErrDecryptionFailed)
+	}
+
+	return string(header[encryptionKeyIDOffset : encryptionKeyIDOffset+length]), nil
+}
+
+type EncryptedStorageOptions struct {
+	// Encrypt node metadata, encrypted metadata can not be used in Query conditions and metadata indexes.
+	// Metadata encrypted before is decrypted regardless of this option.
+	EncryptMetadata bool
+}
+
+// Storage wrapper encrypting node content and, optionally, metadata with keys from KeyProvider.
+//
+// Names, content types and timestamps are stored unencrypted. Nodes of wrapped storage must support
+// GetSeekReader or GetReader for reading and GetWriteCloser or GetFlagWriteCloser for writing.
+//
+// Encrypted content and metadata are bound to node reference, so they can not be decrypted once copied to another node,
+// nodes imported into wrapped storage get new references and must be exported and imported through EncryptedStorage, which archives decrypted content.
+type EncryptedStorage struct {
+	storage Storage
+	keys    KeyProvider
+	options EncryptedStorageOptions
+}
+
+func NewEncryptedStorage(storage Storage, keys KeyProvider) *EncryptedStorage {
+	return NewEncryptedStorageWithOptions(storage, keys, EncryptedStorageOptions{})
+}
+
+func NewEncryptedStorageWithOptions(storage Storage, keys KeyProvider, options EncryptedStorageOptions) *EncryptedStorage {
+	if storage == nil {
+		panic("storage is nil")
+	}
+
+	if keys == nil {
+		panic("key provider is nil")
+	}
+
+	return &EncryptedStorage{
+		storage: storage,
+		keys:    keys,
+		options: options,
+	}
+}
+
+func checkEncryptedStorageIsNil(storage *EncryptedStorage) {
+	if storage == nil {
+		panic("storage is nil")
+	}
+}
+
+func checkEncryptedNodeIsNil(node *EncryptedNode) {
+	if node == nil {
+		panic("node is nil")
+	}
+}
+
+// Get key ID and cipher of current key
+func (storage *EncryptedStorage) currentKey() (string, cipher.AEAD, error) {
+	keyID, err := storage.keys.CurrentKeyID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if keyID == "" || len(keyID) > MaxKeyIDLength {
+		return "", nil, fmt.Errorf("bloby: key ID %q must be 1 to %d bytes long", keyID, MaxKeyIDLength)
+	}
+
+	aead, err := storage.getKey(keyID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return keyID, aead, nil
+}
+
+func (storage *EncryptedStorage) getKey(keyID string) (cipher.AEAD, error) {
+	key, err := storage.keys.GetKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAEAD(key)
+}
+
+// Additional data of data key, binds content to node reference
+func headerAAD(header []byte, reference string) []byte {
+	return append(append([]byte(nil), header[:encryptionDataKeyOffset]...), reference...)
+}
+
+// Build content header of node with new data key encrypted by current key, returns header and cipher of data key
+func (storage *EncryptedStorage) newHeader(reference string) ([]byte, cipher.AEAD, error) {
+	keyID, aead, err := storage.currentKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey, err := randomBytes(encryptionKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce, err := randomBytes(encryptionNonceSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, encryptionDataKeyOffset, encryptionHeaderSize)
+	copy(header, encryptionMagic)
+	header[len(encryptionMagic)] = encryptionVersion
+	header[len(encryptionMagic)+1] = byte(len(keyID))
+	copy(header[encryptionKeyIDOffset:], keyID)
+
+	header = append(header, nonce...)
+	header = aead.Seal(header, nonce, dataKey, headerAAD(header, reference))
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header, dataAEAD, nil
+}
+
+// Decrypt data key from content header of node
+func (storage *EncryptedStorage) openHeader(header []byte, reference string) (cipher.AEAD, error) {
+	keyID, err := parseHeaderKeyID(header)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := storage.getKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := header[encryptionDataKeyOffset : encryptionDataKeyOffset+encryptionNonceSize]
+
+	dataKey, err := aead.Open(nil, nonce, header[encryptionDataKeyOffset+encryptionNonceSize:encryptionHeaderSize], headerAAD(header, reference))
+	if err != nil {
+		return nil, fmt.Errorf("%w: content header: %w", ErrDecryptionFailed, err)
+	}
+
+	return newAEAD(dataKey)
+}
+
+const (
+	// Marker of encrypted metadata, only metadata with exactly these format and version is decrypted
+	encryptedMetadataFormat  = "bloby-encrypted-metadata"
+	encryptedMetadataVersion = 1
+)
+
+// Encrypted metadata as stored in wrapped storage
+type encryptedMetadata struct {
+	Format  string `json:"bloby_format"`
+	Version int    `json:"bloby_version"`
+	KeyID   string `json:"key_id"`
+	Data    []byte `json:"data"`
+}
+
+// Detect encrypted metadata, metadata loaded from FileStorage is decoded from JSON.
+// Metadata is encrypted only if it has exactly the fields of encryptedMetadata with known format and version, so plain metadata is not mistaken for ciphertext.
+func parseEncryptedMetadata(metadata interface{}) (encryptedMetadata, bool) {
+	switch value := metadata.(type) {
+	case encryptedMetadata:
+		return value, value.Format == encryptedMetadataFormat && value.Version == encryptedMetadataVersion
+	case map[string]interface{}:
+		if len(value) != 4 {
+			return encryptedMetadata{}, false
+		}
+
+		format, ok := value["bloby_format"].(string)
+		if !ok || format != encryptedMetadataFormat {
+			return encryptedMetadata{}, false
+		}
+
+		version, ok := value["bloby_version"].(float64)
+		if !ok || version != encryptedMetadataVersion {
+			return encryptedMetadata{}, false
+		}
+
+		keyID, ok := value["key_id"].(string)
+		if !ok {
+			return encryptedMetadata{}, false
+		}
+
+		encoded, ok := value["data"].(string)
+		if !ok {
+			return encryptedMetadata{}, false
+		}
+
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return encryptedMetadata{}, false
+		}
+
+		return encryptedMetadata{
+			Format:  format,
+			Version: encryptedMetadataVersion,
+			KeyID:   keyID,
+			Data:    data,
+		}, true
+	}
+
+	return encryptedMetadata{}, false
+}
+
+// Additional data of metadata, binds metadata to key ID and node reference
+func metadataAAD(keyID string, reference string) []byte {
+	return append(append([]byte{byte(len(keyID))}, keyID...), reference...)
+}
+
+// Encrypt metadata of node with current key if metadata encryption is enabled
+func (storage *EncryptedStorage) encryptMetadata(metadata interface{}, reference string) (interface{}, error) {
+	if !storage.options.EncryptMetadata {
+		return metadata, nil
+	}
+
+	return storage.encryptMetadataWith(metadata, reference)
+}
+
+func (storage *EncryptedStorage) encryptMetadataWith(metadata interface{}, reference string) (encryptedMetadata, error) {
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return encryptedMetadata{}, err
+	}
+
+	keyID, aead, err := storage.currentKey()
+	if err != nil {
+		return encryptedMetadata{}, err
+	}
+
+	nonce, err := randomBytes(encryptionNonceSize)
+	if err != nil {
+		return encryptedMetadata{}, err
+	}
+
+	return encryptedMetadata{
+		Format:  encryptedMetadataFormat,
+		Version: encryptedMetadataVersion,
+		KeyID:   keyID,
+		Data:    aead.Seal(nonce, nonce, metadataBytes, metadataAAD(keyID, reference)),
+	}, nil
+}
+
+// Decrypt metadata of node, returns metadata and key ID it was encrypted with, unencrypted metadata is returned as is with empty key ID
+func (storage *EncryptedStorage) decryptMetadata(metadata interface{}, reference string) (interface{}, string, error) {
+	encrypted, ok := parseEncryptedMetadata(metadata)
+	if !ok {
+		return metadata, "", nil
+	}
+
+	aead, err := storage.getKey(encrypted.KeyID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(encrypted.Data) < encryptionNonceSize {
+		return nil, "", fmt.Errorf("%w: metadata is truncated", ErrDecryptionFailed)
+	}
+
+	metadataBytes, err := aead.Open(nil, encrypted.Data[:encryptionNonceSize], encrypted.Data[encryptionNonceSize:], metadataAAD(encrypted.KeyID, reference))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: metadata: %w", ErrDecryptionFailed, err)
+	}
+
+	var result interface{}
+
+	err = json.Unmarshal(metadataBytes, &result)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return result, encrypted.KeyID, nil
+}
+
+func (storage *EncryptedStorage) wrapNode(node Node) (Node, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	metadata, keyID, err := storage.decryptMetadata(node.GetMetadata(), node.GetReference())
+	if err != nil {
+		return nil, fmt.Errorf("bloby: node %s: %w", node.GetReference(), err)
+	}
+
+	return &EncryptedNode{
+		storage:       storage,
+		node:          node,
+		metadata:      metadata,
+		metadataKeyID: keyID,
+	}, nil
+}
+
+func (storage *EncryptedStorage) wrapNodes(nodes []Node) ([]Node, error) {
+	encryptedNodes := make([]Node, 0, len(nodes))
+
+	for _, node := range nodes {
+		encryptedNode, err := storage.wrapNode(node)
+		if err != nil {
+			return nil, err
+		}
+
+		encryptedNodes = append(encryptedNodes, encryptedNode)
+	}
+
+	return encryptedNodes, nil
+}
+
+// Get wrapped storage
+func (storage *EncryptedStorage) Unwrap() Storage {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.storage
+}
+
+func (storage *EncryptedStorage) GetByReference(reference string) (Node, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	node, err := storage.storage.GetByReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.wrapNode(node)
+}
+
+func (storage *EncryptedStorage) GetByName(name string) (Node, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	node, err := storage.storage.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.wrapNode(node)
+}
+
+func (storage *EncryptedStorage) Create(name string, metadata interface{}) (Node, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.create(name, metadata, false)
+}
+
+func (storage *EncryptedStorage) CreateOrReplace(name string, metadata interface{}) (Node, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	if _, ok := storage.storage.(Replaceable); !ok {
+		return nil, fmt.Errorf("storage is not replaceable: %w", errors.ErrUnsupported)
+	}
+
+	return storage.create(name, metadata, true)
+}
+
+func (storage *EncryptedStorage) CreateOrReplaceContext(ctx context.Context, name string, metadata interface{}) (Node, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return storage.CreateOrReplace(name, metadata)
+}
+
+// Create node, or replace metadata of node with given name.
+//
+// Encrypted metadata is bound to reference assigned by wrapped storage, so it is set after node is created,
+// in the same transaction if wrapped storage is Transactional. Otherwise node created with empty metadata is deleted if metadata can not be set.
+func (storage *EncryptedStorage) create(name string, metadata interface{}, replace bool) (Node, error) {
+	var node Node
+	var err error
+
+	if !storage.options.EncryptMetadata {
+		if replace {
+			node, err = storage.storage.(Replaceable).CreateOrReplace(name, metadata)
+		} else {
+			node, err = storage.storage.Create(name, metadata)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return storage.newNode(node, metadata, metadata), nil
+	}
+
+	var encrypted encryptedMetadata
+
+	if transactional, ok := storage.storage.(Transactional); ok {
+		err = transactional.Transaction(func(tx Tx) error {
+			var err error
+
+			if replace {
+				node, err = tx.CreateOrReplace(name, nil)
+			} else {
+				node, err = tx.Create(name, nil)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			encrypted, err = storage.encryptMetadataWith(metadata, node.GetReference())
+			if err != nil {
+				return err
+			}
+
+			return tx.SetMetadata(node.GetReference(), encrypted)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return storage.newNode(node, metadata, encrypted), nil
+	}
+
+	created := false
+
+	// Metadata of existing node is replaced in place, so it is never left empty
+	if replace {
+		node, err = storage.storage.GetByName(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if node == nil {
+		node, err = storage.storage.Create(name, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		created = true
+	}
+
+	encrypted, err = storage.encryptMetadataWith(metadata, node.GetReference())
+	if err == nil {
+		mutable, ok := node.(Mutable)
+		if !ok {
+			err = fmt.Errorf("node is not mutable: %w", errors.ErrUnsupported)
+		} else {
+			err = mutable.SetMetadata(encrypted)
+		}
+	}
+
+	if err != nil {
+		if created {
+			storage.storage.Delete(node.GetReference())
+		}
+
+		return nil, err
+	}
+
+	return storage.newNode(node, metadata, encrypted), nil
+}
+
+// Wrap node created with given metadata
+func (storage *EncryptedStorage) newNode(node Node, metadata interface{}, encrypted interface{}) *EncryptedNode {
+	encryptedNode := &EncryptedNode{
+		storage:  storage,
+		node:     node,
+		metadata: metadata,
+	}
+
+	if value, ok := encrypted.(encryptedMetadata); ok {
+		encryptedNode.metadataKeyID = value.KeyID
+	}
+
+	return encryptedNode
+}
+
+func (storage *EncryptedStorage) Delete(reference string) error {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.storage.Delete(reference)
+}
+
+func (storage *EncryptedStorage) DeleteBy(namePrefix string, namePostfix string) error {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.storage.DeleteBy(namePrefix, namePostfix)
+}
+
+func (storage *EncryptedStorage) ExistsByName(name string) (bool, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.storage.ExistsByName(name)
+}
+
+func (storage *EncryptedStorage) ExistsByReference(reference string) (bool, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.storage.ExistsByReference(reference)
+}
+
+func (storage *EncryptedStorage) ListBy(namePrefix string, namePostfix string) ([]Node, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	nodes, err := storage.storage.ListBy(namePrefix, namePostfix)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.wrapNodes(nodes)
+}
+
+func (storage *EncryptedStorage) ListReferences(namePrefix string, namePostfix string) ([]string, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.storage.ListReferences(namePrefix, namePostfix)
+}
+
+func (storage *EncryptedStorage) Open() error {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.storage.Open()
+}
+
+func (storage *EncryptedStorage) Close() error {
+	checkEncryptedStorageIsNil(storage)
+
+	return storage.storage.Close()
+}
+
+type EncryptedNode struct {
+	storage  *EncryptedStorage
+	node     Node
+	metadata interface{}
+	// Key ID of stored metadata, empty if metadata is not encrypted
+	metadataKeyID string
+}
+
+// Get wrapped node
+func (node *EncryptedNode) Unwrap() Node {
+	checkEncryptedNodeIsNil(node)
+
+	return node.node
+}
+
+func (node *EncryptedNode) GetReference() string {
+	checkEncryptedNodeIsNil(node)
+
+	return node.node.GetReference()
+}
+
+func (node *EncryptedNode) GetName() string {
+	checkEncryptedNodeIsNil(node)
+
+	return node.node.GetName()
+}
+
+func (node *EncryptedNode) GetMetadata() interface{} {
+	checkEncryptedNodeIsNil(node)
+
+	return node.metadata
+}
+
+func (node *EncryptedNode) SetName(name string) error {
+	checkEncryptedNodeIsNil(node)
+
+	mutable, ok := node.node.(Mutable)
+	if !ok {
+		return fmt.Errorf("node is not mutable: %w", errors.ErrUnsupported)
+	}
+
+	return mutable.SetName(name)
+}
+
+func (node *EncryptedNode) SetMetadata(metadata interface{}) error {
+	checkEncryptedNodeIsNil(node)
+
+	encrypted, err := node.storage.encryptMetadata(metadata, node.GetReference())
+	if err != nil {
+		return err
+	}
+
+	return node.setMetadata(metadata, encrypted)
+}
+
+// Store metadata encrypted by caller
+func (node *EncryptedNode) setMetadata(metadata interface{}, encrypted interface{}) error {
+	mutable, ok := node.node.(Mutable)
+	if !ok {
+		return fmt.Errorf("node is not mutable: %w", errors.ErrUnsupported)
+	}
+
+	err := mutable.SetMetadata(encrypted)
+	if err != nil {
+		return err
+	}
+
+	node.metadata = metadata
+	node.metadataKeyID = ""
+
+	if value, ok := encrypted.(encryptedMetadata); ok {
+		node.metadataKeyID = value.KeyID
+	}
+
+	return nil
+}
+
+// Get key ID of stored metadata, empty string if metadata is not encrypted
+func (node *EncryptedNode) GetMetadataKeyID() string {
+	checkEncryptedNodeIsNil(node)
+
+	return node.metadataKeyID
+}
+
+// Get key ID of stored content, empty string if node has no content
+func (node *EncryptedNode) GetContentKeyID() (string, error) {
+	checkEncryptedNodeIsNil(node)
+
+	reader, err := node.openCiphertext()
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	header := make([]byte, encryptionHeaderSize)
+
+	_, err = io.ReadFull(reader, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("%w: content is truncated", ErrDecryptionFailed)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return parseHeaderKeyID(header)
+}
+
+// Open reader of stored content
+func (node *EncryptedNode) openCiphertext() (io.ReadCloser, error) {
+	readable, ok := node.node.(Readable)
+	if !ok {
+		return nil, fmt.Errorf("node is not readable: %w", errors.ErrUnsupported)
+	}
+
+	reader, err := readable.GetReader()
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := reader.(io.ReadCloser); ok {
+		return closer, nil
+	}
+
+	return io.NopCloser(reader), nil
+}
+
+// Get reader decrypting content, returns ErrDecryptionFailed instead of io.EOF if content was modified or truncated
+func (node *EncryptedNode) GetReader() (io.Reader, error) {
+	checkEncryptedNodeIsNil(node)
+
+	if _, ok := node.node.(SeekReadable); ok {
+		return node.GetSeekReader()
+	}
+
+	reader, err := node.openCiphertext()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, encryptionHeaderSize)
+
+	_, err = io.ReadFull(reader, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("%w: content is truncated", ErrDecryptionFailed)
+	}
+
+	var aead cipher.AEAD
+	if err == nil {
+		aead, err = node.storage.openHeader(header, node.GetReference())
+	}
+
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return &decryptingReader{
+		reader: bufio.NewReaderSize(reader, encryptionChunkSize+encryptionTagSize),
+		closer: reader,
+		aead:   aead,
+		chunk:  make([]byte, encryptionChunkSize+encryptionTagSize),
+	}, nil
+}
+
+func (node *EncryptedNode) GetSeekReader() (ReadSeekCloserAt, error) {
+	checkEncryptedNodeIsNil(node)
+
+	seekReadable, ok := node.node.(SeekReadable)
+	if !ok {
+		return nil, fmt.Errorf("node is not seek readable: %w", errors.ErrUnsupported)
+	}
+
+	reader, err := seekReadable.GetSeekReader()
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := reader.Seek(0, io.SeekEnd)
+
+	var chunks int64
+	var plaintextSize int64
+	if err == nil {
+		chunks, plaintextSize, err = encryptedLayout(size)
+	}
+
+	header := make([]byte, encryptionHeaderSize)
+	if err == nil {
+		_, err = reader.ReadAt(header, 0)
+	}
+
+	var aead cipher.AEAD
+	if err == nil {
+		aead, err = node.storage.openHeader(header, node.GetReference())
+	}
+
+	seekReader := &seekDecryptingReader{
+		reader:      reader,
+		aead:        aead,
+		size:        size,
+		chunks:      chunks,
+		plaintext:   plaintextSize,
+		cachedIndex: -1,
+		buffer:      make([]byte, encryptionChunkSize+encryptionTagSize),
+	}
+
+	// Content truncated at chunk boundary is detected only by the last chunk flag, so the last chunk is authenticated before any read
+	if err == nil {
+		seekReader.cached, err = seekReader.readChunk(chunks-1, seekReader.buffer)
+		seekReader.cachedIndex = chunks - 1
+	}
+
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return seekReader, nil
+}
+
+func (node *EncryptedNode) GetWriter() (io.Writer, error) {
+	checkEncryptedNodeIsNil(node)
+
+	return node.GetWriteCloser()
+}
+
+// Get writer replacing node content, content is encrypted with current key
+func (node *EncryptedNode) GetWriteCloser() (io.WriteCloser, error) {
+	checkEncryptedNodeIsNil(node)
+
+	closeWritable, ok := node.node.(CloseWritable)
+	if !ok {
+		return nil, fmt.Errorf("node is not close writable: %w", errors.ErrUnsupported)
+	}
+
+	writer, err := closeWritable.GetWriteCloser()
+	if err != nil {
+		return nil, err
+	}
+
+	return node.storage.newEncryptingWriter(writer, node.GetReference())
+}
+
+func (node *EncryptedNode) GetFlagWriter(flag int) (io.Writer, error) {
+	checkEncryptedNodeIsNil(node)
+
+	return node.GetFlagWriteCloser(flag)
+}
+
+// Get writer with os.OpenFile flag semantics, appended content is encrypted again together with existing content.
+//
+// Overwriting existing content without os.O_TRUNC or os.O_APPEND is not supported.
+func (node *EncryptedNode) GetFlagWriteCloser(flag int) (io.WriteCloser, error) {
+	checkEncryptedNodeIsNil(node)
+
+	flagCloseWritable, ok := node.node.(FlagCloseWritable)
+	if !ok {
+		return nil, fmt.Errorf("node is not flag close writable: %w", errors.ErrUnsupported)
+	}
+
+	// Wrapped node checks os.O_CREATE and os.O_EXCL, content is always written from the start
+	writer, err := flagCloseWritable.GetFlagWriteCloser((flag | os.O_TRUNC) &^ os.O_APPEND)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing io.Reader
+
+	if flag&os.O_TRUNC == 0 {
+		existing, err = node.GetReader()
+		if errors.Is(err, os.ErrNotExist) {
+			existing, err = nil, nil
+		} else if err == nil && flag&os.O_APPEND == 0 {
+			closeReader(existing)
+			err = fmt.Errorf("overwrite of encrypted content: %w", errors.ErrUnsupported)
+		}
+
+		if err != nil {
+			abortWriter(writer)
+			return nil, err
+		}
+	}
+
+	encryptingWriter, err := node.storage.newEncryptingWriter(writer, node.GetReference())
+	if err != nil {
+		closeReader(existing)
+		return nil, err
+	}
+
+	if existing != nil {
+		_, err = io.Copy(encryptingWriter, existing)
+		closeReader(existing)
+
+		if err != nil {
+			encryptingWriter.Abort()
+			return nil, err
+		}
+	}
+
+	return encryptingWriter, nil
+}
+
+func (node *EncryptedNode) GetSize() int64 {
+	checkEncryptedNodeIsNil(node)
+
+	stat, ok := node.node.(StatNode)
+	if !ok || stat.GetSize() == 0 {
+		return 0
+	}
+
+	_, size, err := encryptedLayout(stat.GetSize())
+	if err != nil {
+		return 0
+	}
+
+	return size
+}
+
+func (node *EncryptedNode) GetCreatedAt() time.Time {
+	checkEncryptedNodeIsNil(node)
+
+	if stat, ok := node.node.(StatNode); ok {
+		return stat.GetCreatedAt()
+	}
+
+	return time.Time{}
+}
+
+func (node *EncryptedNode) GetUpdatedAt() time.Time {
+	checkEncryptedNodeIsNil(node)
+
+	if stat, ok := node.node.(StatNode); ok {
+		return stat.GetUpdatedAt()
+	}
+
+	return time.Time{}
+}
+
+func (node *EncryptedNode) GetContentType() string {
+	checkEncryptedNodeIsNil(node)
+
+	if stat, ok := node.node.(StatNode); ok {
+		return stat.GetContentType()
+	}
+
+	return ""
+}
+
+func (node *EncryptedNode) SetContentType(contentType string) error {
+	checkEncryptedNodeIsNil(node)
+
+	contentTypeMutable, ok := node.node.(ContentTypeMutable)
+	if !ok {
+		return fmt.Errorf("node content type is not mutable: %w", errors.ErrUnsupported)
+	}
+
+	return contentTypeMutable.SetContentType(contentType)
+}
+
+func (node *EncryptedNode) SetTimes(createdAt time.Time, updatedAt time.Time) error {
+	checkEncryptedNodeIsNil(node)
+
+	timesMutable, ok := node.node.(TimesMutable)
+	if !ok {
+		return fmt.Errorf("node times are not mutable: %w", errors.ErrUnsupported)
+	}
+
+	return timesMutable.SetTimes(createdAt, updatedAt)
+}
+
+func closeReader(reader io.Reader) {
+	if closer, ok := reader.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// Discard content of writer, writers without Abort are left unclosed so that content is not committed
+func abortWriter(writer io.Writer) {
+	if abortable, ok := writer.(Abortable); ok {
+		abortable.Abort()
+	}
+}
+
+// Writer encrypting content into wrapped writer, content is committed by Close
+type encryptingWriter struct {
+	writer io.WriteCloser
+	aead   cipher.AEAD
+	// Plaintext of current chunk, full chunk is written once more content follows, so the last chunk is known on Close
+	buffer []byte
+	index  int64
+	closed bool
+}
+
+func (storage *EncryptedStorage) newEncryptingWriter(writer io.WriteCloser, reference string) (*encryptingWriter, error) {
+	header, aead, err := storage.newHeader(reference)
+	if err == nil {
+		_, err = writer.Write(header)
+	}
+
+	if err != nil {
+		abortWriter(writer)
+		return nil, err
+	}
+
+	return &encryptingWriter{
+		writer: writer,
+		aead:   aead,
+		buffer: make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+func (writer *encryptingWriter) flush(last bool) error {
+	chunk := writer.aead.Seal(nil, chunkNonce(writer.index, last), writer.buffer, nil)
+
+	_, err := writer.writer.Write(chunk)
+	if err != nil {
+		return err
+	}
+
+	writer.buffer = writer.buffer[:0]
+	writer.index++
+
+	return nil
+}
+
+func (writer *encryptingWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, os.ErrClosed
+	}
+
+	written := 0
+
+	for len(p) > 0 {
+		if len(writer.buffer) == encryptionChunkSize {
+			err := writer.flush(false)
+			if err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(writer.buffer[len(writer.buffer):encryptionChunkSize], p)
+		writer.buffer = writer.buffer[:len(writer.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+func (writer *encryptingWriter) Close() error {
+	if writer.closed {
+		return os.ErrClosed
+	}
+
+	writer.closed = true
+
+	err := writer.flush(true)
+	if err != nil {
+		abortWriter(writer.writer)
+		return err
+	}
+
+	return writer.writer.Close()
+}
+
+// Discard written content, fails with errors.ErrUnsupported if wrapped writer can not be aborted
+func (writer *encryptingWriter) Abort() error {
+	if writer.closed {
+		return os.ErrClosed
+	}
+
+	abortable, ok := writer.writer.(Abortable)
+	if !ok {
+		return fmt.Errorf("writer is not abortable: %w", errors.ErrUnsupported)
+	}
+
+	writer.closed = true
+
+	return abortable.Abort()
+}
+
+// Decrypt and authenticate chunk in place
+func openChunk(aead cipher.AEAD, chunk []byte, index int64, last bool) ([]byte, error) {
+	plaintext, err := aead.Open(chunk[:0], chunkNonce(index, last), chunk, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chunk %d: %w", ErrDecryptionFailed, index, err)
+	}
+
+	return plaintext, nil
+}
+
+// Sequential reader of encrypted content
+type decryptingReader struct {
+	reader *bufio.Reader
+	closer io.Closer
+	aead   cipher.AEAD
+	index  int64
+	// Ciphertext buffer, holds plaintext of current chunk after decryption
+	chunk     []byte
+	plaintext []byte
+	done      bool
+}
+
+func (reader *decryptingReader) readChunk() error {
+	n, err := io.ReadFull(reader.reader, reader.chunk)
+	if err == io.EOF {
+		// Content ended without last chunk
+		return fmt.Errorf("%w: content is truncated", ErrDecryptionFailed)
+	}
+
+	last := err == io.ErrUnexpectedEOF
+	if err == nil {
+		_, err = reader.reader.Peek(1)
+		last = err == io.EOF
+		if last {
+			err = nil
+		}
+	} else if last {
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	reader.plaintext, err = openChunk(reader.aead, reader.chunk[:n], reader.index, last)
+	if err != nil {
+		return err
+	}
+
+	reader.index++
+	reader.done = last
+
+	return nil
+}
+
+func (reader *decryptingReader) Read(p []byte) (int, error) {
+	for len(reader.plaintext) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+
+		err := reader.readChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, reader.plaintext)
+	reader.plaintext = reader.plaintext[n:]
+
+	return n, nil
+}
+
+func (reader *decryptingReader) Close() error {
+	return reader.closer.Close()
+}
+
+// Chunk buffers of ReadAt, parallel ReadAt calls can not share buffer of reader
+var chunkBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, encryptionChunkSize+encryptionTagSize)
+		return &buffer
+	},
+}
+
+// Random access reader of encrypted content, each chunk is decrypted when read
+type seekDecryptingReader struct {
+	reader ReadSeekCloserAt
+	aead   cipher.AEAD
+	// Size of encrypted content
+	size      int64
+	chunks    int64
+	plaintext int64
+	offset    int64
+	// Last decrypted chunk, the last chunk of content is decrypted on open
+	cachedIndex int64
+	cached      []byte
+	buffer      []byte
+}
+
+// Read and decrypt chunk into buffer
+func (reader *seekDecryptingReader) readChunk(index int64, buffer []byte) ([]byte, error) {
+	offset := encryptionHeaderSize + index*(encryptionChunkSize+encryptionTagSize)
+	length := min(encryptionChunkSize+encryptionTagSize, reader.size-offset)
+
+	n, err := reader.reader.ReadAt(buffer[:length], offset)
+	if int64(n) < length {
+		if err == nil || err == io.EOF {
+			err = fmt.Errorf("%w: content is truncated", ErrDecryptionFailed)
+		}
+
+		return nil, err
+	}
+
+	return openChunk(reader.aead, buffer[:length], index, index == reader.chunks-1)
+}
+
+func (reader *seekDecryptingReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.plaintext {
+		return 0, io.EOF
+	}
+
+	index := reader.offset / encryptionChunkSize
+
+	if reader.cachedIndex != index {
+		reader.cachedIndex = -1
+
+		chunk, err := reader.readChunk(index, reader.buffer)
+		if err != nil {
+			return 0, err
+		}
+
+		reader.cached = chunk
+		reader.cachedIndex = index
+	}
+
+	n := copy(p, reader.cached[reader.offset-index*encryptionChunkSize:])
+	reader.offset += int64(n)
+
+	return n, nil
+}
+
+func (reader *seekDecryptingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("bloby: negative offset")
+	}
+
+	buffer := chunkBufferPool.Get().(*[]byte)
+	defer chunkBufferPool.Put(buffer)
+
+	read := 0
+
+	for read < len(p) {
+		if off >= reader.plaintext {
+			return read, io.EOF
+		}
+
+		index := off / encryptionChunkSize
+
+		chunk, err := reader.readChunk(index, *buffer)
+		if err != nil {
+			return read, err
+		}
+
+		n := copy(p[read:], chunk[off-index*encryptionChunkSize:])
+		read += n
+		off += int64(n)
+	}
+
+	return read, nil
+}
+
+func (reader *seekDecryptingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.plaintext
+	default:
+		return 0, errors.New("bloby: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("bloby: negative position")
+	}
+
+	reader.offset = offset
+
+	return offset, nil
+}
+
+func (reader *seekDecryptingReader) Close() error {
+	return reader.reader.Close()
+}
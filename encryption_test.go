@@ -0,0 +1,349 @@
+package bloby
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedStorage(t *testing.T) {
+	testDirName := "test-file-storage-TestEncryptedStorage"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 32)
+
+	fileStorage := NewFileStorage(testDirName)
+	storage := NewEncryptedStorageWithOptions(fileStorage, NewStaticKeyProvider("1", map[string][]byte{"1": key1}), EncryptedStorageOptions{EncryptMetadata: true})
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, content []byte) {
+		writer, err := node.(*EncryptedNode).GetWriteCloser()
+		assert.NoError(t, err)
+
+		_, err = writer.Write(content)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+	}
+
+	read := func(node Node) ([]byte, error) {
+		reader, err := node.(*EncryptedNode).GetReader()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.(io.Closer).Close()
+
+		return io.ReadAll(reader)
+	}
+
+	node, err := storage.Create("cats", map[string]interface{}{"owner": "alice"})
+	assert.NoError(t, err)
+
+	// Content and metadata are stored encrypted
+	content := make([]byte, 3*encryptionChunkSize+100)
+	rand.New(rand.NewSource(1)).Read(content)
+	copy(content, "meow meow meow")
+
+	write(node, content)
+
+	stored, err := os.ReadFile(node.(*EncryptedNode).Unwrap().(*FileNode).GetPath())
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(stored, []byte("meow meow meow")))
+
+	raw, err := fileStorage.GetByReference(node.GetReference())
+	assert.NoError(t, err)
+	assert.NotContains(t, raw.GetMetadata(), "owner")
+
+	loaded, err := storage.GetByName("cats")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"owner": "alice"}, loaded.GetMetadata())
+	assert.Equal(t, "1", loaded.(*EncryptedNode).GetMetadataKeyID())
+	assert.Equal(t, int64(len(content)), loaded.(*EncryptedNode).GetSize())
+
+	keyID, err := loaded.(*EncryptedNode).GetContentKeyID()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", keyID)
+
+	result, err := read(loaded)
+	assert.NoError(t, err)
+	assert.Equal(t, content, result)
+
+	// Random access across chunk boundaries
+	reader, err := loaded.(*EncryptedNode).GetSeekReader()
+	assert.NoError(t, err)
+
+	size, err := reader.Seek(0, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	buffer := make([]byte, 200)
+
+	_, err = reader.Seek(encryptionChunkSize-100, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(reader, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, content[encryptionChunkSize-100:encryptionChunkSize+100], buffer)
+
+	n, err := reader.ReadAt(buffer, 2*encryptionChunkSize-50)
+	assert.NoError(t, err)
+	assert.Equal(t, content[2*encryptionChunkSize-50:2*encryptionChunkSize+150], buffer[:n])
+
+	n, err = reader.ReadAt(buffer, int64(len(content))-10)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, content[len(content)-10:], buffer[:n])
+
+	assert.NoError(t, reader.Close())
+
+	// Chunk boundary sizes
+	for _, length := range []int{0, 1, encryptionChunkSize, encryptionChunkSize + 1, 2 * encryptionChunkSize} {
+		write(node, content[:length])
+		assert.Equal(t, int64(length), node.(*EncryptedNode).GetSize())
+
+		result, err = read(node)
+		assert.NoError(t, err)
+		assert.Equal(t, content[:length], result)
+	}
+
+	// Append encrypts existing content again
+	writer, err := node.(*EncryptedNode).GetFlagWriteCloser(os.O_RDWR | os.O_APPEND)
+	assert.NoError(t, err)
+	writer.Write([]byte("purr"))
+	assert.NoError(t, writer.Close())
+
+	result, err = read(node)
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte(nil), content[:2*encryptionChunkSize]...), "purr"...), result)
+
+	_, err = node.(*EncryptedNode).GetFlagWriteCloser(os.O_RDWR)
+	assert.True(t, errors.Is(err, errors.ErrUnsupported))
+
+	_, err = node.(*EncryptedNode).GetFlagWriteCloser(os.O_RDWR | os.O_CREATE | os.O_EXCL)
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	// Modified and truncated content
+	path := node.(*EncryptedNode).Unwrap().(*FileNode).GetPath()
+
+	stored, err = os.ReadFile(path)
+	assert.NoError(t, err)
+
+	modified := append([]byte(nil), stored...)
+	modified[encryptionHeaderSize+encryptionChunkSize+100] ^= 1
+	assert.NoError(t, os.WriteFile(path, modified, 0644))
+
+	_, err = read(node)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	// Dropped last chunk
+	assert.NoError(t, os.WriteFile(path, stored[:encryptionHeaderSize+2*(encryptionChunkSize+encryptionTagSize)], 0644))
+
+	_, err = read(node)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	// Content truncated at chunk boundary followed by garbage shorter than a chunk
+	truncated := append(append([]byte(nil), stored[:encryptionHeaderSize+encryptionChunkSize+encryptionTagSize]...), bytes.Repeat([]byte{7}, encryptionTagSize)...)
+	assert.NoError(t, os.WriteFile(path, truncated, 0644))
+
+	_, err = read(node)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	_, err = node.(*EncryptedNode).GetSeekReader()
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	assert.NoError(t, os.WriteFile(path, stored[:encryptionHeaderSize-1], 0644))
+
+	_, err = read(node)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Content written with previous key stays readable after current key is changed
+	storage = NewEncryptedStorage(fileStorage, NewStaticKeyProvider("2", map[string][]byte{"1": key1, "2": key2}))
+
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	node, err = storage.GetByName("cats")
+	assert.NoError(t, err)
+	write(node, []byte("meow"))
+
+	other, err := storage.Create("other cats", "plain")
+	assert.NoError(t, err)
+	write(other, []byte("hiss"))
+
+	other, err = storage.GetByName("other cats")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", other.GetMetadata())
+	assert.Empty(t, other.(*EncryptedNode).GetMetadataKeyID())
+
+	// Plain metadata looking like ciphertext is not decrypted
+	lookalike := map[string]interface{}{"key_id": "2", "data": "bWVvdw==", "bloby_format": "cats", "bloby_version": float64(1)}
+
+	_, err = storage.Create("lookalike cats", lookalike)
+	assert.NoError(t, err)
+
+	loaded, err = storage.GetByName("lookalike cats")
+	assert.NoError(t, err)
+	assert.Equal(t, lookalike, loaded.GetMetadata())
+
+	keyID, err = other.(*EncryptedNode).GetContentKeyID()
+	assert.NoError(t, err)
+	assert.Equal(t, "2", keyID)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Unknown and wrong keys
+	storage = NewEncryptedStorage(fileStorage, NewStaticKeyProvider("2", map[string][]byte{"2": key1}))
+
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	_, err = storage.GetByName("cats")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	other, err = storage.GetByName("other cats")
+	assert.NoError(t, err)
+
+	_, err = read(other)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestEncryptedStorageSequentialReader(t *testing.T) {
+	keys := NewStaticKeyProvider("1", map[string][]byte{"1": make([]byte, 32)})
+	storage := NewEncryptedStorage(NewMemoryStorage(), keys)
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	// Node of wrapped storage without random access
+	memoryNode := node.(*EncryptedNode).Unwrap()
+	sequential := &EncryptedNode{
+		storage: storage,
+		node: struct {
+			Node
+			Readable
+		}{memoryNode, memoryNode.(Readable)},
+	}
+
+	meows := bytes.Repeat([]byte("meow "), encryptionChunkSize)
+
+	for _, length := range []int{0, 5, encryptionChunkSize, 2*encryptionChunkSize + 5} {
+		content := meows[:length]
+
+		writer, err := node.(*EncryptedNode).GetWriteCloser()
+		assert.NoError(t, err)
+		writer.Write(content)
+		assert.NoError(t, writer.Close())
+
+		reader, err := sequential.GetReader()
+		assert.NoError(t, err)
+		assert.IsType(t, &decryptingReader{}, reader)
+
+		result, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, len(content), len(result))
+		assert.True(t, bytes.Equal(content, result))
+	}
+
+	// Content truncated at chunk boundary, as is and followed by garbage
+	storedReader, err := memoryNode.(Readable).GetReader()
+	assert.NoError(t, err)
+
+	stored, err := io.ReadAll(storedReader)
+	assert.NoError(t, err)
+
+	boundary := stored[:encryptionHeaderSize+encryptionChunkSize+encryptionTagSize]
+
+	for _, truncated := range [][]byte{boundary, append(append([]byte(nil), boundary...), bytes.Repeat([]byte{7}, encryptionTagSize)...)} {
+		writer, err := memoryNode.(CloseWritable).GetWriteCloser()
+		assert.NoError(t, err)
+		writer.Write(truncated)
+		assert.NoError(t, writer.Close())
+
+		reader, err := sequential.GetReader()
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(reader)
+		assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+		_, err = node.(*EncryptedNode).GetReader()
+		assert.ErrorIs(t, err, ErrDecryptionFailed)
+	}
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestEncryptedStorageBoundToReference(t *testing.T) {
+	keys := NewStaticKeyProvider("1", map[string][]byte{"1": make([]byte, 32)})
+	memoryStorage := NewMemoryStorage()
+
+	// Wrapped storage without transactions
+	storage := NewEncryptedStorageWithOptions(struct{ Storage }{memoryStorage}, keys, EncryptedStorageOptions{EncryptMetadata: true})
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	cats, err := storage.Create("cats", "meow")
+	assert.NoError(t, err)
+
+	dogs, err := storage.Create("dogs", "woof")
+	assert.NoError(t, err)
+
+	for node, content := range map[Node]string{cats: "meow", dogs: "woof"} {
+		writer, err := node.(*EncryptedNode).GetWriteCloser()
+		assert.NoError(t, err)
+		writer.Write([]byte(content))
+		assert.NoError(t, writer.Close())
+	}
+
+	loaded, err := storage.GetByName("cats")
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", loaded.GetMetadata())
+
+	// Metadata and content of another node fail authentication
+	rawCats, err := memoryStorage.GetByReference(cats.GetReference())
+	assert.NoError(t, err)
+
+	rawDogs, err := memoryStorage.GetByReference(dogs.GetReference())
+	assert.NoError(t, err)
+
+	assert.NoError(t, rawCats.(Mutable).SetMetadata(rawDogs.GetMetadata()))
+
+	_, err = storage.GetByReference(cats.GetReference())
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	dogsReader, err := rawDogs.(Readable).GetReader()
+	assert.NoError(t, err)
+
+	dogsContent, err := io.ReadAll(dogsReader)
+	assert.NoError(t, err)
+
+	writer, err := rawCats.(CloseWritable).GetWriteCloser()
+	assert.NoError(t, err)
+	writer.Write(dogsContent)
+	assert.NoError(t, writer.Close())
+
+	_, err = cats.(*EncryptedNode).GetReader()
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
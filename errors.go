@@ -0,0 +1,97 @@
+package bloby
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// Operation on closed storage
+	ErrClosed = errors.New("storage is closed")
+	// Open of already open storage
+	ErrAlreadyOpen = errors.New("storage is open")
+	// Node or node content does not exist.
+	//
+	// GetByName and GetByReference report missing nodes with nil node and nil error.
+	ErrNotFound = errors.New("node not found")
+	// Node name violates unique name constraint
+	ErrNameConflict = errors.New("node name conflict")
+	// Storage directory is locked by another open storage
+	ErrLocked = errors.New("storage is locked")
+	// Use of transaction after it was committed or rolled back
+	ErrTxDone = errors.New("transaction is done")
+	// Node content does not match checksum recorded on write
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// Node has no recorded checksum, content was never written or was written before checksums were recorded
+	ErrNoChecksum = errors.New("checksum is not recorded")
+	// Storage schema was created by newer version of library
+	ErrSchemaTooNew = errors.New("storage schema is too new")
+	// Open options conflict with settings storage was created with
+	ErrOptionsMismatch = errors.New("storage options mismatch")
+	// Archive passed to Import was not written by Export
+	ErrInvalidArchive = errors.New("invalid archive")
+	// Key provider has no key with requested ID
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// Encrypted content or metadata was modified, truncated or encrypted with different key
+	ErrDecryptionFailed = errors.New("decryption failed")
+)
+
+// Failed storage operation, wraps underlying SQLite or filesystem error
+type StorageError struct {
+	Op        string
+	Reference string
+	Err       error
+}
+
+func (e *StorageError) Error() string {
+	if e.Reference == "" {
+		return "bloby: " + e.Op + ": " + e.Err.Error()
+	}
+
+	return "bloby: " + e.Op + " " + e.Reference + ": " + e.Err.Error()
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// Wrap error into StorageError, sentinel errors are returned as is.
+//
+// Missing files are reported as ErrNotFound and unique constraint violations as ErrNameConflict, keeping original error in chain.
+func wrapError(op string, reference string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch err {
+	case ErrClosed, ErrAlreadyOpen, ErrNotFound, ErrNameConflict, ErrLocked, ErrTxDone, ErrChecksumMismatch, ErrNoChecksum, ErrSchemaTooNew, ErrOptionsMismatch, ErrInvalidArchive, ErrUnknownKey, ErrDecryptionFailed:
+		return err
+	}
+
+	var storageError *StorageError
+	if errors.As(err, &storageError) {
+		return err
+	}
+
+	var sqliteError sqlite3.Error
+
+	if errors.Is(err, os.ErrNotExist) && !errors.Is(err, ErrNotFound) {
+		err = fmt.Errorf("%w: %w", ErrNotFound, err)
+	} else if errors.As(err, &sqliteError) && sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique {
+		err = fmt.Errorf("%w: %w", ErrNameConflict, err)
+	}
+
+	return &StorageError{
+		Op:        op,
+		Reference: reference,
+		Err:       err,
+	}
+}
+
+// Error for missing node content
+func contentNotFoundError(op string, reference string) error {
+	return wrapError(op, reference, &os.PathError{Op: op, Path: reference, Err: os.ErrNotExist})
+}
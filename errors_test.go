@@ -0,0 +1,75 @@
+package bloby
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapError(t *testing.T) {
+	assert.NoError(t, wrapError("get", "", nil))
+
+	// Sentinel errors are kept as is
+	assert.Equal(t, ErrClosed, wrapError("get", "", ErrClosed))
+	assert.Equal(t, ErrNotFound, wrapError("delete", "AAAA", ErrNotFound))
+
+	// Missing files
+	err := wrapError("read", "AAAA", &os.PathError{Op: "open", Path: "AAAA", Err: os.ErrNotExist})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	var storageError *StorageError
+	assert.True(t, errors.As(err, &storageError))
+	assert.Equal(t, "read", storageError.Op)
+	assert.Equal(t, "AAAA", storageError.Reference)
+
+	// Wrapped errors are not wrapped twice
+	assert.Equal(t, err, wrapError("write", "BBBB", err))
+
+	// Other errors
+	cause := errors.New("disk is on fire")
+	err = wrapError("create", "", cause)
+	assert.ErrorIs(t, err, cause)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, "bloby: create: disk is on fire", err.Error())
+}
+
+func TestFileStorageErrors(t *testing.T) {
+	testDirName := "test-file-storage-TestFileStorageErrors"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorage(testDirName)
+
+	_, err := storage.GetByName("AAAAAAAA")
+	assert.ErrorIs(t, err, ErrClosed)
+
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("AAAAAAAA", nil)
+	assert.NoError(t, err)
+
+	err = storage.Delete(node.GetReference())
+	assert.NoError(t, err)
+
+	err = storage.Delete(node.GetReference())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = node.(*FileNode).SetMetadata(13)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = node.(*FileNode).GetFlagWriter(os.O_RDWR)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	var storageError *StorageError
+	assert.True(t, errors.As(err, &storageError))
+	assert.Equal(t, "write", storageError.Op)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
@@ -1,27 +1,31 @@
 package bloby
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
-	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var randomSource = rand.New(rand.NewSource(time.Now().UnixNano()))
-
+// References must be unique between processes sharing storage, so they are generated from crypto/rand
 func randomHexString(n int) string {
 	b := make([]byte, (n + 1))
 
-	if _, err := randomSource.Read(b); err != nil {
+	if _, err := rand.Read(b); err != nil {
 		panic(err)
 	}
 
@@ -40,18 +44,56 @@ func checkNodeIsNil(node *FileNode) {
 	}
 }
 
-type FileStorage struct {
-	lock   sync.Mutex
-	isOpen bool
-	path   string
-	db     *sql.DB
+type FileStorageOptions struct {
+	// Store content under SHA-256 hash of written bytes in `blobs/` directory.
+	// Nodes with identical content share single blob, which is removed when no node references it.
+	//
+	// Mode is recorded on first open, Open of existing storage with different mode fails with ErrOptionsMismatch.
+	ContentAddressed bool
+
+	// Metadata paths to create expression indexes for on Open, see Condition for path format
+	MetadataIndexes []string
+
+	// Enforce unique node names, creating or renaming node into existing name fails with ErrNameConflict.
+	// Open fails with ErrNameConflict if storage already contains duplicate names.
+	//
+	// Constraint is recorded in storage and kept by later opens without this option until it is removed with AllowDuplicateNames.
+	UniqueNames bool
+
+	// Remove unique names constraint added by open with UniqueNames
+	AllowDuplicateNames bool
+
+	// Access mode for storage shared between processes
+	LockMode LockMode
+
+	// Time to wait for database locked by another process in LockShared mode, defaults to DefaultBusyTimeout
+	BusyTimeout time.Duration
+
+	// Codec used by node writers to store content, see FileNode.GetFlagWriteCloserWithCodec for choosing codec per node.
+	// Content is decompressed by readers, changing codec does not affect content written before.
+	Compression Codec
 }
 
-func (s *FileStorage) initDB() {
-	s.db.Exec("create table if not exists metadata (name text, reference text, metadata text)")
-	s.db.Exec("create index if not exists idx_metadata_name on metadata(name)")
-	s.db.Exec("create index if not exists idx_metadata_reference on metadata(reference)")
-	s.db.Exec("create index if not exists idx_metadata_name_reference on metadata(name, reference)")
+type LockMode int
+
+const (
+	// Single process access without locking, opening storage from multiple processes corrupts database
+	LockNone LockMode = iota
+	// Single process access guarded by advisory lock on storage directory, other opens fail with ErrLocked
+	LockExclusive
+	// Multiple process access using SQLite WAL journal and busy timeout, exclusive opens fail with ErrLocked
+	LockShared
+)
+
+const DefaultBusyTimeout = 5 * time.Second
+
+type FileStorage struct {
+	lock     sync.Mutex
+	isOpen   bool
+	path     string
+	db       *sql.DB
+	lockFile *os.File
+	options  FileStorageOptions
 }
 
 func (s *FileStorage) getPathByReference(reference string) string {
@@ -62,369 +104,1464 @@ func (s *FileStorage) getDirByReference(reference string) string {
 	return path.Join(s.path, "tree", reference[0:2], reference[2:4], reference[4:6])
 }
 
-func (s *FileStorage) deleteFileNode(reference string) {
-	os.RemoveAll(s.getPathByReference(reference))
+func (s *FileStorage) getPathByBlob(hash string) string {
+	return path.Join(s.path, "blobs", hash[0:2], hash[2:4], hash[4:6], hash)
 }
 
-func NewFileStorage(path string) *FileStorage {
-	absPath, err := filepath.Abs(path)
+func (s *FileStorage) getDirByBlob(hash string) string {
+	return path.Join(s.path, "blobs", hash[0:2], hash[2:4], hash[4:6])
+}
+
+func (s *FileStorage) getTempDir() string {
+	return path.Join(s.path, "tmp")
+}
+
+// Check update result, reports ErrNotFound if no rows were updated
+func checkUpdated(result sql.Result, err error) error {
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	return &FileStorage{
-		path:   absPath,
-		isOpen: false,
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
 	}
-}
 
-func (storage *FileStorage) GetByReference(reference string) (Node, error) {
-	checkStorageIsNil(storage)
+	if affected == 0 {
+		return ErrNotFound
+	}
 
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+	return nil
+}
 
-	if !storage.isOpen {
-		return nil, errors.New("storage is closed")
-	}
+func (s *FileStorage) deleteFileNode(reference string) {
+	os.RemoveAll(s.getPathByReference(reference))
+}
 
-	rows, err := storage.db.Query("select name, reference, metadata from metadata where reference = ?", reference)
+// Get content hash of node in content addressed mode, returns empty string if node has no content
+func (s *FileStorage) getBlobByReference(reference string) (string, error) {
+	rows, err := s.db.Query("select blob from metadata where reference = ?", reference)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	defer rows.Close()
 
 	if !rows.Next() {
-		return nil, nil
+		return "", nil
 	}
 
-	var resultName string
-	var resultReference string
-	var resultMetadataJson sql.NullString
+	var resultBlob sql.NullString
 
-	err = rows.Scan(&resultName, &resultReference, &resultMetadataJson)
+	err = rows.Scan(&resultBlob)
 	if err != nil {
-		return nil, err
-	}
-
-	var node FileNode
-	node.storage = storage
-	node.name = resultName
-	node.reference = resultReference
-
-	if resultMetadataJson.Valid {
-		err = json.Unmarshal([]byte(resultMetadataJson.String), &node.metadata)
-		if err != nil {
-			node.metadata = nil
-		}
+		return "", err
 	}
 
-	return &node, nil
+	return resultBlob.String, nil
 }
 
-func (storage *FileStorage) GetByName(name string) (Node, error) {
-	checkStorageIsNil(storage)
-
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+// Get path, codec and size of node content, returns empty path if node has no content
+func (s *FileStorage) getContentByReference(reference string) (string, Codec, int64, error) {
+	var resultBlob sql.NullString
+	var resultCodec Codec
+	var resultSize int64
 
-	if !storage.isOpen {
-		return nil, errors.New("storage is closed")
+	err := s.db.QueryRow("select blob, codec, coalesce(size, 0) from metadata where reference = ?", reference).Scan(&resultBlob, &resultCodec, &resultSize)
+	if err == sql.ErrNoRows {
+		return "", CodecNone, 0, nil
 	}
-
-	rows, err := storage.db.Query("select name, reference, metadata from metadata where name = ?", name)
 	if err != nil {
-		return nil, err
+		return "", CodecNone, 0, err
 	}
 
-	if !rows.Next() {
-		return nil, nil
+	if !s.options.ContentAddressed {
+		return s.getPathByReference(reference), resultCodec, resultSize, nil
 	}
 
-	var resultName string
-	var resultReference string
-	var resultMetadataJson sql.NullString
+	if !resultBlob.Valid {
+		return "", CodecNone, 0, nil
+	}
+
+	return s.getPathByBlob(resultBlob.String), resultCodec, resultSize, nil
+}
 
-	err = rows.Scan(&resultName, &resultReference, &resultMetadataJson)
+// Collect blob hashes referenced by rows matching query
+func (s *FileStorage) queryBlobs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var node FileNode
-	node.storage = storage
-	node.name = resultName
-	node.reference = resultReference
+	hashes := make([]string, 0)
 
-	if resultMetadataJson.Valid {
-		err = json.Unmarshal([]byte(resultMetadataJson.String), &node.metadata)
+	for rows.Next() {
+		var resultBlob string
+
+		err = rows.Scan(&resultBlob)
 		if err != nil {
-			node.metadata = nil
+			return nil, err
 		}
+
+		hashes = append(hashes, resultBlob)
 	}
 
-	return &node, nil
+	return hashes, rows.Err()
 }
 
-func (storage *FileStorage) Create(name string, metadata interface{}) (Node, error) {
-	checkStorageIsNil(storage)
+// Decrement blob reference counters, returns hashes of blobs that are no longer referenced
+func (s *FileStorage) releaseBlobs(ctx context.Context, tx *sql.Tx, hashes []string) ([]string, error) {
+	freed := make([]string, 0)
 
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+	for _, hash := range hashes {
+		_, err := tx.ExecContext(ctx, "update blobs set refcount = refcount - 1 where hash = ?", hash)
+		if err != nil {
+			return nil, err
+		}
 
-	if !storage.isOpen {
-		return nil, errors.New("storage is closed")
+		var refcount int64
+
+		err = tx.QueryRowContext(ctx, "select refcount from blobs where hash = ?", hash).Scan(&refcount)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if refcount <= 0 {
+			_, err = tx.ExecContext(ctx, "delete from blobs where hash = ?", hash)
+			if err != nil {
+				return nil, err
+			}
+
+			freed = append(freed, hash)
+		}
 	}
 
-	node := FileNode{
-		storage:   storage,
-		reference: randomHexString(24),
-		name:      name,
-		metadata:  metadata,
+	return freed, nil
+}
+
+// Remove files of freed blobs, blobs referenced again by concurrent writer are kept
+func (s *FileStorage) deleteBlobs(hashes []string) {
+	if len(hashes) == 0 {
+		return
 	}
 
-	metadataBytes, err := json.Marshal(node.metadata)
+	tx, err := s.db.Begin()
 	if err != nil {
-		_, err = storage.db.Exec("insert into metadata (name, reference, metadata) values (?, ?, null)", node.name, node.reference)
-	} else {
-		_, err = storage.db.Exec("insert into metadata (name, reference, metadata) values (?, ?, ?)", node.name, node.reference, string(metadataBytes))
+		return
+	}
+	defer tx.Rollback()
+
+	for _, hash := range hashes {
+		var refcount int64
+
+		err = tx.QueryRow("select refcount from blobs where hash = ?", hash).Scan(&refcount)
+		if err == sql.ErrNoRows {
+			os.Remove(s.getPathByBlob(hash))
+		}
 	}
 
+	tx.Commit()
+}
+
+// Delete rows matching condition with releasing their blobs
+func (s *FileStorage) deleteRows(ctx context.Context, tx *sql.Tx, condition string, args ...interface{}) ([]string, error) {
+	hashes, err := s.queryBlobs(ctx, tx, "select blob from metadata where blob is not null and "+condition, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &node, nil
+	_, err = tx.ExecContext(ctx, "delete from metadata where "+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.releaseBlobs(ctx, tx, hashes)
 }
 
-func (storage *FileStorage) Delete(reference string) error {
-	checkStorageIsNil(storage)
+// Move written temporary file into blob storage and point node to it, hash and size are of uncompressed content
+func (s *FileStorage) commitBlob(reference string, tempPath string, hash string, size int64, codec Codec, updatedAt int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+	if !s.isOpen {
+		os.Remove(tempPath)
+		return ErrClosed
+	}
 
-	if !storage.isOpen {
-		return errors.New("storage is closed")
+	tx, err := s.db.Begin()
+	if err != nil {
+		os.Remove(tempPath)
+		return err
 	}
+	defer tx.Rollback()
 
-	_, err := storage.db.Exec("delete from metadata where reference = ?", reference)
+	var resultBlob sql.NullString
 
+	err = tx.QueryRow("select blob from metadata where reference = ?", reference).Scan(&resultBlob)
+	if err == sql.ErrNoRows {
+		os.Remove(tempPath)
+		return ErrNotFound
+	}
 	if err != nil {
+		os.Remove(tempPath)
 		return err
 	}
 
-	storage.deleteFileNode(reference)
-
-	return nil
-}
+	blob := blobName(hash, codec)
 
-func (storage *FileStorage) DeleteBy(namePrefix string, namePostfix string) error {
-	checkStorageIsNil(storage)
+	if resultBlob.Valid && resultBlob.String == blob {
+		os.Remove(tempPath)
 
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+		// Content is unchanged, checksum may be missing for content written before checksums were recorded
+		_, err = tx.Exec("update metadata set checksum = ?, size = ?, codec = ?, updated_at = ? where reference = ?", hash, size, codec, updatedAt, reference)
+		if err != nil {
+			return err
+		}
 
-	if !storage.isOpen {
-		return errors.New("storage is closed")
+		return tx.Commit()
 	}
 
-	rows, err := storage.db.Query("select reference from metadata where name like ?", namePrefix+"%"+namePostfix)
+	_, err = tx.Exec("insert into blobs (hash, refcount) values (?, 1) on conflict(hash) do update set refcount = refcount + 1", blob)
 	if err != nil {
+		os.Remove(tempPath)
 		return err
 	}
 
-	references := make([]string, 0)
+	_, err = tx.Exec("update metadata set blob = ?, checksum = ?, size = ?, codec = ?, updated_at = ? where reference = ?", blob, hash, size, codec, updatedAt, reference)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
 
-	for rows.Next() {
-		var resultReference string
+	freed := make([]string, 0)
+	if resultBlob.Valid {
+		freed, err = s.releaseBlobs(context.Background(), tx, []string{resultBlob.String})
+		if err != nil {
+			os.Remove(tempPath)
+			return err
+		}
+	}
 
-		err = rows.Scan(&resultReference)
+	if _, err := os.Stat(s.getPathByBlob(blob)); err == nil {
+		os.Remove(tempPath)
+	} else {
+		err = os.MkdirAll(s.getDirByBlob(blob), 0755)
 		if err != nil {
+			os.Remove(tempPath)
 			return err
 		}
 
-		references = append(references, resultReference)
+		err = os.Rename(tempPath, s.getPathByBlob(blob))
+		if err != nil {
+			os.Remove(tempPath)
+			return err
+		}
 	}
 
-	_, err = storage.db.Exec("delete from metadata where name like ?", namePrefix+"%"+namePostfix)
-
+	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	for _, reference := range references {
-		storage.deleteFileNode(reference)
-	}
+	s.deleteBlobs(freed)
 
 	return nil
 }
 
-func (storage *FileStorage) ExistsByName(name string) (bool, error) {
-	checkStorageIsNil(storage)
+// Move written temporary file into node path and record its checksum and codec
+func (s *FileStorage) commitFile(reference string, tempPath string, hash string, size int64, codec Codec, updatedAt int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+	if !s.isOpen {
+		os.Remove(tempPath)
+		return ErrClosed
+	}
 
-	if !storage.isOpen {
-		return false, errors.New("storage is closed")
+	tx, err := s.db.Begin()
+	if err != nil {
+		os.Remove(tempPath)
+		return err
 	}
+	defer tx.Rollback()
 
-	rows, err := storage.db.Query("select 1 from metadata where name = ?", name)
+	result, err := tx.Exec("update metadata set checksum = ?, size = ?, codec = ?, updated_at = ? where reference = ?", hash, size, codec, updatedAt, reference)
+	err = checkUpdated(result, err)
 	if err != nil {
-		return false, err
+		os.Remove(tempPath)
+		return err
+	}
+
+	err = os.Rename(tempPath, s.getPathByReference(reference))
+	if err != nil {
+		os.Remove(tempPath)
+		return err
 	}
 
-	return rows.Next(), nil
+	return tx.Commit()
 }
 
-func (storage *FileStorage) ExistsByReference(reference string) (bool, error) {
-	checkStorageIsNil(storage)
+func NewFileStorage(path string) *FileStorage {
+	return NewFileStorageWithOptions(path, FileStorageOptions{})
+}
 
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+func NewFileStorageWithOptions(path string, options FileStorageOptions) *FileStorage {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		panic(err)
+	}
 
-	if !storage.isOpen {
-		return false, errors.New("storage is closed")
+	return &FileStorage{
+		path:    absPath,
+		isOpen:  false,
+		options: options,
 	}
+}
 
-	rows, err := storage.db.Query("select 1 from metadata where reference = ?", reference)
+// Query executor, either storage database or transaction
+type queryExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Columns scanned by scanNode
+const nodeColumns = "name, reference, metadata, coalesce(size, 0), created_at, updated_at, content_type, codec"
+
+func (storage *FileStorage) scanNode(rows *sql.Rows) (*FileNode, error) {
+	var resultName string
+	var resultReference string
+	var resultMetadataJson sql.NullString
+	var resultSize int64
+	var resultCreatedAt int64
+	var resultUpdatedAt int64
+	var resultContentType string
+	var resultCodec Codec
+
+	err := rows.Scan(&resultName, &resultReference, &resultMetadataJson, &resultSize, &resultCreatedAt, &resultUpdatedAt, &resultContentType, &resultCodec)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	var node FileNode
+	node.storage = storage
+	node.name = resultName
+	node.reference = resultReference
+	node.size = resultSize
+	node.createdAt = unixNanoToTime(resultCreatedAt)
+	node.updatedAt = unixNanoToTime(resultUpdatedAt)
+	node.contentType = resultContentType
+	node.codec = resultCodec
+
+	if resultMetadataJson.Valid {
+		err = json.Unmarshal([]byte(resultMetadataJson.String), &node.metadata)
+		if err != nil {
+			node.metadata = nil
+		}
 	}
 
-	return rows.Next(), nil
+	return &node, nil
 }
 
-func (storage *FileStorage) ListBy(namePrefix string, namePostfix string) ([]Node, error) {
-	checkStorageIsNil(storage)
+func (storage *FileStorage) queryNode(ctx context.Context, db queryExecutor, query string, args ...interface{}) (Node, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
 
-	if !storage.isOpen {
-		return nil, errors.New("storage is closed")
+	node, err := storage.scanNode(rows)
+	if err != nil {
+		return nil, err
 	}
 
-	rows, err := storage.db.Query("select name, reference, metadata from metadata where name like ?", namePrefix+"%"+namePostfix)
+	return node, nil
+}
+
+func (storage *FileStorage) queryNodes(ctx context.Context, db queryExecutor, query string, args ...interface{}) ([]Node, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	nodes := make([]Node, 0)
 
 	for rows.Next() {
-		var resultName string
-		var resultReference string
-		var resultMetadataJson sql.NullString
-
-		err = rows.Scan(&resultName, &resultReference, &resultMetadataJson)
+		node, err := storage.scanNode(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		var node FileNode
-		node.storage = storage
-		node.name = resultName
-		node.reference = resultReference
-
-		if resultMetadataJson.Valid {
-			err = json.Unmarshal([]byte(resultMetadataJson.String), &node.metadata)
-			if err != nil {
-				node.metadata = nil
-			}
-		}
-
-		nodes = append(nodes, &node)
+		nodes = append(nodes, node)
 	}
 
-	return nodes, nil
+	return nodes, rows.Err()
 }
 
-func (storage *FileStorage) ListReferences(namePrefix string, namePostfix string) ([]string, error) {
-	checkStorageIsNil(storage)
-
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
-
-	if !storage.isOpen {
-		return nil, errors.New("storage is closed")
-	}
-
-	rows, err := storage.db.Query("select reference from metadata where name like ?", namePrefix+"%"+namePostfix)
+func (storage *FileStorage) queryStrings(ctx context.Context, db queryExecutor, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	references := make([]string, 0)
+	values := make([]string, 0)
 
 	for rows.Next() {
-		var resultReference string
+		var resultValue string
 
-		err = rows.Scan(&resultReference)
+		err = rows.Scan(&resultValue)
 		if err != nil {
 			return nil, err
 		}
 
-		references = append(references, resultReference)
+		values = append(values, resultValue)
 	}
 
-	return references, nil
+	return values, rows.Err()
 }
 
-// Open FileStorage in goroutine-safe mode
-//
-// WARNING:
-//
-//	This implementation supports only multigoroutine access, but not the multiprocess access. opening database in multiprocess mode will cause database corruption.
-func (storage *FileStorage) Open() error {
-	checkStorageIsNil(storage)
+func (storage *FileStorage) queryExists(ctx context.Context, db queryExecutor, query string, args ...interface{}) (bool, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
 
-	storage.lock.Lock()
-	defer storage.lock.Unlock()
+	return rows.Next(), rows.Err()
+}
 
-	if storage.isOpen {
-		return errors.New("storage is open")
+func (storage *FileStorage) insertNode(ctx context.Context, db queryExecutor, name string, metadata interface{}) (Node, error) {
+	now := time.Now().UnixNano()
+
+	node := FileNode{
+		storage:   storage,
+		reference: randomHexString(24),
+		name:      name,
+		metadata:  metadata,
+		createdAt: unixNanoToTime(now),
+		updatedAt: unixNanoToTime(now),
+	}
+
+	metadataBytes, err := json.Marshal(node.metadata)
+	if err != nil {
+		_, err = db.ExecContext(ctx, "insert into metadata (name, reference, metadata, size, created_at, updated_at) values (?, ?, null, 0, ?, ?)", node.name, node.reference, now, now)
+	} else {
+		_, err = db.ExecContext(ctx, "insert into metadata (name, reference, metadata, size, created_at, updated_at) values (?, ?, ?, 0, ?, ?)", node.name, node.reference, string(metadataBytes), now, now)
+	}
+
+	if err != nil {
+		return nil, wrapError("create", node.reference, err)
+	}
+
+	return &node, nil
+}
+
+// Update returns modification time recorded in updated_at
+func (storage *FileStorage) updateName(ctx context.Context, db queryExecutor, reference string, name string) (time.Time, error) {
+	now := time.Now().UnixNano()
+
+	result, err := db.ExecContext(ctx, "update metadata set name = ?, updated_at = ? where reference = ?", name, now, reference)
+	err = checkUpdated(result, err)
+	if err != nil {
+		return time.Time{}, wrapError("rename", reference, err)
+	}
+
+	return unixNanoToTime(now), nil
+}
+
+func (storage *FileStorage) updateMetadata(ctx context.Context, db queryExecutor, reference string, metadata interface{}) (time.Time, error) {
+	var result sql.Result
+	var err error
+
+	now := time.Now().UnixNano()
+
+	if metadata == nil {
+		result, err = db.ExecContext(ctx, "update metadata set metadata = null, updated_at = ? where reference = ?", now, reference)
+	} else {
+		var metadataBytes []byte
+
+		metadataBytes, err = json.Marshal(metadata)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		result, err = db.ExecContext(ctx, "update metadata set metadata = ?, updated_at = ? where reference = ?", string(metadataBytes), now, reference)
+	}
+
+	err = checkUpdated(result, err)
+	if err != nil {
+		return time.Time{}, wrapError("set metadata", reference, err)
+	}
+
+	return unixNanoToTime(now), nil
+}
+
+func (storage *FileStorage) updateContentType(ctx context.Context, db queryExecutor, reference string, contentType string) (time.Time, error) {
+	now := time.Now().UnixNano()
+
+	result, err := db.ExecContext(ctx, "update metadata set content_type = ?, updated_at = ? where reference = ?", contentType, now, reference)
+	err = checkUpdated(result, err)
+	if err != nil {
+		return time.Time{}, wrapError("set content type", reference, err)
+	}
+
+	return unixNanoToTime(now), nil
+}
+
+func (storage *FileStorage) updateTimes(ctx context.Context, db queryExecutor, reference string, createdAt time.Time, updatedAt time.Time) error {
+	result, err := db.ExecContext(ctx, "update metadata set created_at = coalesce(nullif(?, 0), created_at), updated_at = coalesce(nullif(?, 0), updated_at) where reference = ?", timeToUnixNano(createdAt), timeToUnixNano(updatedAt), reference)
+	err = checkUpdated(result, err)
+	if err != nil {
+		return wrapError("set times", reference, err)
+	}
+
+	return nil
+}
+
+func (storage *FileStorage) GetByReference(reference string) (Node, error) {
+	return storage.GetByReferenceContext(context.Background(), reference)
+}
+
+func (storage *FileStorage) GetByReferenceContext(ctx context.Context, reference string) (Node, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	node, err := storage.queryNode(ctx, storage.db, "select "+nodeColumns+" from metadata where reference = ?", reference)
+	if err != nil {
+		return nil, wrapError("get", reference, err)
+	}
+
+	return node, nil
+}
+
+func (storage *FileStorage) GetByName(name string) (Node, error) {
+	return storage.GetByNameContext(context.Background(), name)
+}
+
+func (storage *FileStorage) GetByNameContext(ctx context.Context, name string) (Node, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	node, err := storage.queryNode(ctx, storage.db, "select "+nodeColumns+" from metadata where name = ?", name)
+	if err != nil {
+		return nil, wrapError("get", "", err)
+	}
+
+	return node, nil
+}
+
+func (storage *FileStorage) Create(name string, metadata interface{}) (Node, error) {
+	return storage.CreateContext(context.Background(), name, metadata)
+}
+
+func (storage *FileStorage) CreateContext(ctx context.Context, name string, metadata interface{}) (Node, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return storage.insertNode(ctx, storage.db, name, metadata)
+}
+
+func (storage *FileStorage) CreateOrReplace(name string, metadata interface{}) (Node, error) {
+	return storage.CreateOrReplaceContext(context.Background(), name, metadata)
+}
+
+// Replace metadata of node with given name or create new node, without unique names constraint node is chosen arbitrarily among nodes with given name
+func (storage *FileStorage) CreateOrReplaceContext(ctx context.Context, name string, metadata interface{}) (Node, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	var node Node
+
+	err := storage.transaction(ctx, func(tx *fileTx) error {
+		var err error
+		node, err = tx.CreateOrReplace(name, metadata)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func (storage *FileStorage) Delete(reference string) error {
+	return storage.DeleteContext(context.Background(), reference)
+}
+
+func (storage *FileStorage) DeleteContext(ctx context.Context, reference string) error {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	return storage.transaction(ctx, func(tx *fileTx) error {
+		return tx.Delete(reference)
+	})
+}
+
+func (storage *FileStorage) DeleteBy(namePrefix string, namePostfix string) error {
+	return storage.DeleteByContext(context.Background(), namePrefix, namePostfix)
+}
+
+// Delete nodes matching name prefix and postfix.
+//
+// Content of deleted nodes is removed after metadata deletion is committed and is not interrupted by ctx.
+func (storage *FileStorage) DeleteByContext(ctx context.Context, namePrefix string, namePostfix string) error {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	return storage.transaction(ctx, func(tx *fileTx) error {
+		return tx.DeleteBy(namePrefix, namePostfix)
+	})
+}
+
+func (storage *FileStorage) ExistsByName(name string) (bool, error) {
+	return storage.ExistsByNameContext(context.Background(), name)
+}
+
+func (storage *FileStorage) ExistsByNameContext(ctx context.Context, name string) (bool, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return false, ErrClosed
+	}
+
+	exists, err := storage.queryExists(ctx, storage.db, "select 1 from metadata where name = ?", name)
+	if err != nil {
+		return false, wrapError("exists", "", err)
+	}
+
+	return exists, nil
+}
+
+func (storage *FileStorage) ExistsByReference(reference string) (bool, error) {
+	return storage.ExistsByReferenceContext(context.Background(), reference)
+}
+
+func (storage *FileStorage) ExistsByReferenceContext(ctx context.Context, reference string) (bool, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return false, ErrClosed
+	}
+
+	exists, err := storage.queryExists(ctx, storage.db, "select 1 from metadata where reference = ?", reference)
+	if err != nil {
+		return false, wrapError("exists", reference, err)
+	}
+
+	return exists, nil
+}
+
+func (storage *FileStorage) ListBy(namePrefix string, namePostfix string) ([]Node, error) {
+	return storage.ListByContext(context.Background(), namePrefix, namePostfix)
+}
+
+func (storage *FileStorage) ListByContext(ctx context.Context, namePrefix string, namePostfix string) ([]Node, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	nodes, err := storage.queryNodes(ctx, storage.db, "select "+nodeColumns+" from metadata where name like ?", namePrefix+"%"+namePostfix)
+	if err != nil {
+		return nil, wrapError("list", "", err)
+	}
+
+	return nodes, nil
+}
+
+func (storage *FileStorage) ListReferences(namePrefix string, namePostfix string) ([]string, error) {
+	return storage.ListReferencesContext(context.Background(), namePrefix, namePostfix)
+}
+
+func (storage *FileStorage) ListReferencesContext(ctx context.Context, namePrefix string, namePostfix string) ([]string, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	references, err := storage.queryStrings(ctx, storage.db, "select reference from metadata where name like ?", namePrefix+"%"+namePostfix)
+	if err != nil {
+		return nil, wrapError("list", "", err)
+	}
+
+	return references, nil
+}
+
+func (storage *FileStorage) Query(namePrefix string, namePostfix string, conditions ...Condition) ([]Node, error) {
+	return storage.QueryContext(context.Background(), namePrefix, namePostfix, conditions...)
+}
+
+// List nodes matching name prefix, postfix and all metadata conditions
+func (storage *FileStorage) QueryContext(ctx context.Context, namePrefix string, namePostfix string, conditions ...Condition) ([]Node, error) {
+	checkStorageIsNil(storage)
+
+	err := checkConditions(conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	query := "select " + nodeColumns + " from metadata where name like ?"
+	args := []interface{}{namePrefix + "%" + namePostfix}
+
+	if len(conditions) > 0 {
+		conditionsQuery, conditionsArgs := conditionsSQL(conditions)
+		query += " and " + conditionsQuery
+		args = append(args, conditionsArgs...)
+	}
+
+	nodes, err := storage.queryNodes(ctx, storage.db, query, args...)
+	if err != nil {
+		return nil, wrapError("query", "", err)
+	}
+
+	return nodes, nil
+}
+
+// Create expression index on metadata path to speed up queries with conditions on it
+func (storage *FileStorage) CreateMetadataIndex(path string) error {
+	checkStorageIsNil(storage)
+
+	err := checkConditionPath(path)
+	if err != nil {
+		return err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	return wrapError("create index", "", storage.createMetadataIndex(path))
+}
+
+func (storage *FileStorage) DropMetadataIndex(path string) error {
+	checkStorageIsNil(storage)
+
+	err := checkConditionPath(path)
+	if err != nil {
+		return err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	_, err = storage.db.Exec("drop index if exists " + metadataIndexName(path))
+
+	return wrapError("drop index", "", err)
+}
+
+func (storage *FileStorage) createMetadataIndex(path string) error {
+	_, err := storage.db.Exec("create index if not exists " + metadataIndexName(path) + " on metadata(" + metadataPathExpression(path) + ")")
+
+	return err
+}
+
+func (storage *FileStorage) ListPage(options ListOptions) (Page, error) {
+	return storage.ListPageContext(context.Background(), options)
+}
+
+func (storage *FileStorage) ListPageContext(ctx context.Context, options ListOptions) (Page, error) {
+	checkStorageIsNil(storage)
+
+	err := checkListOrder(options.Order)
+	if err != nil {
+		return Page{}, err
+	}
+
+	cursor, err := decodeCursor(options, options.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	err = checkConditions(options.Where)
+	if err != nil {
+		return Page{}, err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return Page{}, ErrClosed
+	}
+
+	query := "select " + nodeColumns + " from metadata where name like ?"
+	args := []interface{}{options.NamePrefix + "%" + options.NamePostfix}
+
+	if len(options.Where) > 0 {
+		conditionsQuery, conditionsArgs := conditionsSQL(options.Where)
+		query += " and " + conditionsQuery
+		args = append(args, conditionsArgs...)
+	}
+
+	if options.ContentType != "" {
+		query += " and content_type = ?"
+		args = append(args, options.ContentType)
+	}
+
+	if options.MinSize > 0 {
+		query += " and coalesce(size, 0) >= ?"
+		args = append(args, options.MinSize)
+	}
+
+	if options.MaxSize > 0 {
+		query += " and coalesce(size, 0) <= ?"
+		args = append(args, options.MaxSize)
+	}
+
+	for _, filter := range []struct {
+		condition string
+		time      time.Time
+	}{
+		{"created_at >= ?", options.CreatedSince},
+		{"created_at < ?", options.CreatedBefore},
+		{"updated_at >= ?", options.UpdatedSince},
+		{"updated_at < ?", options.UpdatedBefore},
+	} {
+		if !filter.time.IsZero() {
+			query += " and " + filter.condition
+			args = append(args, filter.time.UnixNano())
+		}
+	}
+
+	compare := ">"
+	direction := ""
+	if options.Descending {
+		compare = "<"
+		direction = " desc"
+	}
+
+	// Sort key column, reference is used as tie breaker
+	var key string
+
+	switch options.Order {
+	case OrderByName:
+		key = "name"
+	case OrderBySize:
+		key = "coalesce(size, 0)"
+	case OrderByCreatedAt:
+		key = "created_at"
+	case OrderByUpdatedAt:
+		key = "updated_at"
+	}
+
+	if key == "" {
+		if cursor != nil {
+			query += " and reference " + compare + " ?"
+			args = append(args, cursor.Reference)
+		}
+
+		query += " order by reference" + direction
+	} else {
+		if cursor != nil {
+			var cursorKey interface{} = cursor.Number
+			if options.Order == OrderByName {
+				cursorKey = cursor.Key
+			}
+
+			query += " and (" + key + " " + compare + " ? or (" + key + " = ? and reference " + compare + " ?))"
+			args = append(args, cursorKey, cursorKey, cursor.Reference)
+		}
+
+		query += " order by " + key + direction + ", reference" + direction
+	}
+
+	if options.Limit > 0 {
+		query += " limit ?"
+		args = append(args, options.Limit+1)
+	}
+
+	nodes, err := storage.queryNodes(ctx, storage.db, query, args...)
+	if err != nil {
+		return Page{}, wrapError("list", "", err)
+	}
+
+	return makePage(options, nodes), nil
+}
+
+func (storage *FileStorage) Walk(options ListOptions, callback func(node Node) error) error {
+	return storage.WalkContext(context.Background(), options, callback)
+}
+
+func (storage *FileStorage) WalkContext(ctx context.Context, options ListOptions, callback func(node Node) error) error {
+	checkStorageIsNil(storage)
+
+	return walkPages(ctx, options, storage.ListPageContext, callback)
+}
+
+func (storage *FileStorage) Transaction(fn func(tx Tx) error) error {
+	return storage.TransactionContext(context.Background(), fn)
+}
+
+// Run fn in single database transaction, metadata changes are committed if fn returns nil and rolled back otherwise.
+//
+// Storage is locked while fn is running, so fn must use only tx and must not use storage or its nodes.
+// Content of deleted nodes is removed after commit.
+func (storage *FileStorage) TransactionContext(ctx context.Context, fn func(tx Tx) error) error {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	return storage.transaction(ctx, func(tx *fileTx) error {
+		return fn(tx)
+	})
+}
+
+// Run fn in database transaction and remove content of deleted nodes after commit, storage lock must be held
+func (storage *FileStorage) transaction(ctx context.Context, fn func(tx *fileTx) error) error {
+	sqlTx, err := storage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError("transaction", "", err)
+	}
+	defer sqlTx.Rollback()
+
+	tx := &fileTx{
+		storage: storage,
+		ctx:     ctx,
+		tx:      sqlTx,
+	}
+	defer func() {
+		tx.done = true
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	err = sqlTx.Commit()
+	if err != nil {
+		return wrapError("transaction", "", err)
+	}
+
+	for _, reference := range tx.references {
+		storage.deleteFileNode(reference)
+	}
+
+	storage.deleteBlobs(tx.freed)
+
+	return nil
+}
+
+// Build SQLite DSN for lock mode
+func (storage *FileStorage) dataSourceName(dbPath string) string {
+	if storage.options.LockMode != LockShared {
+		return "file:" + dbPath + "?mode=rwc&nolock=1"
+	}
+
+	busyTimeout := storage.options.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = DefaultBusyTimeout
+	}
+
+	// Immediate transactions take write lock on begin, so concurrent writers wait for busy timeout instead of failing on lock upgrade
+	return "file:" + dbPath + "?mode=rwc&_journal_mode=WAL&_txlock=immediate&_busy_timeout=" + strconv.FormatInt(busyTimeout.Milliseconds(), 10)
+}
+
+// Check database file uses WAL journal, which can not be read without SQLite file locking
+func isWALDatabase(dbPath string) bool {
+	file, err := os.Open(dbPath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	// Header bytes 18 and 19 hold file format write and read versions, 2 for WAL
+	header := make([]byte, 20)
+
+	_, err = io.ReadFull(file, header)
+	if err != nil {
+		return false
+	}
+
+	return header[18] == 2 && header[19] == 2
+}
+
+// Switch database left by LockShared mode back to rollback journal
+func convertFromWAL(dbPath string) error {
+	// Journal mode can be changed only with file locking enabled, change fails if database is used by another process
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=rw")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("pragma journal_mode = delete")
+
+	return err
+}
+
+// Open FileStorage in goroutine-safe mode
+//
+// WARNING:
+//
+//	With LockNone mode only multigoroutine access is supported, opening database from multiple processes will cause database corruption.
+//	Use LockExclusive to detect concurrent opens or LockShared to share storage between processes.
+func (storage *FileStorage) Open() error {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if storage.isOpen {
+		return ErrAlreadyOpen
 	}
 
 	os.Mkdir(storage.path, 0755)
 	dbPath := filepath.Join(storage.path, "metadata.db")
 	dbPath, err := filepath.Abs(dbPath)
 	if err != nil {
-		return err
+		return wrapError("open", "", err)
 	}
 
-	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=rwc&nolock=1")
+	err = checkCodec(storage.options.Compression)
 	if err != nil {
-		return err
+		return wrapError("open", "", err)
+	}
+
+	if storage.options.UniqueNames && storage.options.AllowDuplicateNames {
+		return wrapError("open", "", errors.New("UniqueNames and AllowDuplicateNames are exclusive"))
+	}
+
+	switch storage.options.LockMode {
+	case LockNone:
+	case LockExclusive, LockShared:
+		lockFile, err := lockDirectory(storage.path, storage.options.LockMode == LockExclusive)
+		if err != nil {
+			return wrapError("open", "", err)
+		}
+		storage.lockFile = lockFile
+	default:
+		return wrapError("open", "", errors.New("unknown lock mode"))
+	}
+
+	if storage.options.LockMode != LockShared && isWALDatabase(dbPath) {
+		err = convertFromWAL(dbPath)
+		if err != nil {
+			storage.unlock()
+			return wrapError("open", "", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", storage.dataSourceName(dbPath))
+	if err != nil {
+		storage.unlock()
+		return wrapError("open", "", err)
 	}
 	storage.db = db
-	storage.initDB()
+
+	// Mode is checked before migrations, which locate content of existing nodes
+	err = storage.checkContentAddressed()
+	if err == nil {
+		err = storage.migrate()
+	}
+
+	// Mode is checked again after recording in case storage was created by concurrent open with different mode
+	if err == nil {
+		err = recordSetting(db, settingContentAddressed, strconv.FormatBool(storage.options.ContentAddressed))
+	}
+	if err == nil {
+		err = storage.checkContentAddressed()
+	}
+
+	if err != nil {
+		db.Close()
+		storage.unlock()
+		return wrapError("open", "", err)
+	}
+
+	// Unique index is removed only on explicit request, so that opens without UniqueNames do not allow duplicates
+	if storage.options.UniqueNames {
+		_, err = db.Exec("create unique index if not exists idx_metadata_name_unique on metadata(name)")
+	} else if storage.options.AllowDuplicateNames {
+		_, err = db.Exec("drop index if exists idx_metadata_name_unique")
+	}
+
+	if err != nil {
+		db.Close()
+		storage.unlock()
+		return wrapError("open", "", err)
+	}
+
+	for _, path := range storage.options.MetadataIndexes {
+		err = checkConditionPath(path)
+		if err == nil {
+			err = storage.createMetadataIndex(path)
+		}
+
+		if err != nil {
+			db.Close()
+			storage.unlock()
+			return wrapError("open", "", err)
+		}
+	}
 
 	storage.isOpen = true
 
 	return nil
 }
 
+// Check ContentAddressed option against mode of existing storage.
+//
+// Mode is recorded in settings, mode of storage created before it was recorded is detected from content directories.
+func (storage *FileStorage) checkContentAddressed() error {
+	value, ok, err := querySetting(storage.db, settingContentAddressed)
+	if err != nil {
+		return err
+	}
+
+	var contentAddressed bool
+
+	if ok {
+		contentAddressed, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid setting %s: %w", settingContentAddressed, err)
+		}
+	} else {
+		// Blobs are stored only in content addressed mode and tree only in default mode, mode of empty storage is not known
+		hasBlobs, err := hasEntries(path.Join(storage.path, "blobs"))
+		if err != nil {
+			return err
+		}
+
+		hasTree, err := hasEntries(path.Join(storage.path, "tree"))
+		if err != nil {
+			return err
+		}
+
+		if hasBlobs == hasTree {
+			return nil
+		}
+
+		contentAddressed = hasBlobs
+	}
+
+	if contentAddressed != storage.options.ContentAddressed {
+		if contentAddressed {
+			return fmt.Errorf("%w: storage is content addressed", ErrOptionsMismatch)
+		}
+
+		return fmt.Errorf("%w: storage is not content addressed", ErrOptionsMismatch)
+	}
+
+	return nil
+}
+
+// Check directory exists and is not empty
+func hasEntries(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return len(entries) > 0, nil
+}
+
+// Release directory lock if held
+func (storage *FileStorage) unlock() {
+	if storage.lockFile != nil {
+		unlockDirectory(storage.lockFile)
+		storage.lockFile = nil
+	}
+}
+
 func (storage *FileStorage) Close() error {
 	checkStorageIsNil(storage)
 
 	storage.lock.Lock()
 	defer storage.lock.Unlock()
 
-	if !storage.isOpen {
-		return errors.New("storage is closed")
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	err := storage.db.Close()
+	storage.unlock()
+
+	storage.isOpen = false
+
+	return wrapError("close", "", err)
+}
+
+type fileTx struct {
+	storage *FileStorage
+	ctx     context.Context
+	tx      *sql.Tx
+	done    bool
+	// Deleted nodes and freed blobs, removed after commit
+	references []string
+	freed      []string
+}
+
+func (tx *fileTx) GetByReference(reference string) (Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	node, err := tx.storage.queryNode(tx.ctx, tx.tx, "select "+nodeColumns+" from metadata where reference = ?", reference)
+	if err != nil {
+		return nil, wrapError("get", reference, err)
+	}
+
+	return node, nil
+}
+
+func (tx *fileTx) GetByName(name string) (Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	node, err := tx.storage.queryNode(tx.ctx, tx.tx, "select "+nodeColumns+" from metadata where name = ?", name)
+	if err != nil {
+		return nil, wrapError("get", "", err)
+	}
+
+	return node, nil
+}
+
+func (tx *fileTx) Create(name string, metadata interface{}) (Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	return tx.storage.insertNode(tx.ctx, tx.tx, name, metadata)
+}
+
+func (tx *fileTx) CreateOrReplace(name string, metadata interface{}) (Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	node, err := tx.storage.queryNode(tx.ctx, tx.tx, "select "+nodeColumns+" from metadata where name = ?", name)
+	if err != nil {
+		return nil, wrapError("create", "", err)
+	}
+
+	if node == nil {
+		return tx.storage.insertNode(tx.ctx, tx.tx, name, metadata)
+	}
+
+	fileNode := node.(*FileNode)
+
+	updatedAt, err := tx.storage.updateMetadata(tx.ctx, tx.tx, fileNode.reference, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	fileNode.metadata = metadata
+	fileNode.updatedAt = updatedAt
+
+	return fileNode, nil
+}
+
+func (tx *fileTx) Delete(reference string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	exists, err := tx.storage.queryExists(tx.ctx, tx.tx, "select 1 from metadata where reference = ?", reference)
+	if err != nil {
+		return wrapError("delete", reference, err)
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	freed, err := tx.storage.deleteRows(tx.ctx, tx.tx, "reference = ?", reference)
+	if err != nil {
+		return wrapError("delete", reference, err)
+	}
+
+	tx.references = append(tx.references, reference)
+	tx.freed = append(tx.freed, freed...)
+
+	return nil
+}
+
+func (tx *fileTx) DeleteBy(namePrefix string, namePostfix string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	references, err := tx.storage.queryStrings(tx.ctx, tx.tx, "select reference from metadata where name like ?", namePrefix+"%"+namePostfix)
+	if err != nil {
+		return wrapError("delete", "", err)
+	}
+
+	freed, err := tx.storage.deleteRows(tx.ctx, tx.tx, "name like ?", namePrefix+"%"+namePostfix)
+	if err != nil {
+		return wrapError("delete", "", err)
+	}
+
+	tx.references = append(tx.references, references...)
+	tx.freed = append(tx.freed, freed...)
+
+	return nil
+}
+
+func (tx *fileTx) ExistsByName(name string) (bool, error) {
+	if tx.done {
+		return false, ErrTxDone
+	}
+
+	exists, err := tx.storage.queryExists(tx.ctx, tx.tx, "select 1 from metadata where name = ?", name)
+	if err != nil {
+		return false, wrapError("exists", "", err)
+	}
+
+	return exists, nil
+}
+
+func (tx *fileTx) ExistsByReference(reference string) (bool, error) {
+	if tx.done {
+		return false, ErrTxDone
+	}
+
+	exists, err := tx.storage.queryExists(tx.ctx, tx.tx, "select 1 from metadata where reference = ?", reference)
+	if err != nil {
+		return false, wrapError("exists", reference, err)
+	}
+
+	return exists, nil
+}
+
+func (tx *fileTx) ListBy(namePrefix string, namePostfix string) ([]Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	nodes, err := tx.storage.queryNodes(tx.ctx, tx.tx, "select "+nodeColumns+" from metadata where name like ?", namePrefix+"%"+namePostfix)
+	if err != nil {
+		return nil, wrapError("list", "", err)
+	}
+
+	return nodes, nil
+}
+
+func (tx *fileTx) ListReferences(namePrefix string, namePostfix string) ([]string, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	references, err := tx.storage.queryStrings(tx.ctx, tx.tx, "select reference from metadata where name like ?", namePrefix+"%"+namePostfix)
+	if err != nil {
+		return nil, wrapError("list", "", err)
+	}
+
+	return references, nil
+}
+
+func (tx *fileTx) SetName(reference string, name string) error {
+	if tx.done {
+		return ErrTxDone
 	}
 
-	err := storage.db.Close()
+	_, err := tx.storage.updateName(tx.ctx, tx.tx, reference, name)
 
-	storage.isOpen = false
+	return err
+}
+
+func (tx *fileTx) SetMetadata(reference string, metadata interface{}) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	_, err := tx.storage.updateMetadata(tx.ctx, tx.tx, reference, metadata)
 
 	return err
 }
 
 type FileNode struct {
-	storage   *FileStorage
-	reference string
-	name      string
-	metadata  interface{}
+	storage     *FileStorage
+	reference   string
+	name        string
+	metadata    interface{}
+	size        int64
+	createdAt   time.Time
+	updatedAt   time.Time
+	contentType string
+	codec       Codec
 }
 
 func (node *FileNode) GetReference() string {
@@ -446,79 +1583,506 @@ func (node *FileNode) GetMetadata() interface{} {
 }
 
 func (node *FileNode) SetName(name string) error {
+	return node.SetNameContext(context.Background(), name)
+}
+
+func (node *FileNode) SetNameContext(ctx context.Context, name string) error {
 	checkNodeIsNil(node)
 
 	node.storage.lock.Lock()
 	defer node.storage.lock.Unlock()
 
 	if !node.storage.isOpen {
-		return errors.New("storage is closed")
+		return ErrClosed
 	}
 
-	_, err := node.storage.db.Exec("update or ignore metadata set name = ? where reference = ?", name, node.reference)
+	updatedAt, err := node.storage.updateName(ctx, node.storage.db, node.reference, name)
 	if err != nil {
 		return err
 	}
 
 	node.name = name
+	node.updatedAt = updatedAt
 
 	return nil
 }
 
 func (node *FileNode) SetMetadata(metadata interface{}) error {
+	return node.SetMetadataContext(context.Background(), metadata)
+}
+
+func (node *FileNode) SetMetadataContext(ctx context.Context, metadata interface{}) error {
 	checkNodeIsNil(node)
 
 	node.storage.lock.Lock()
 	defer node.storage.lock.Unlock()
 
 	if !node.storage.isOpen {
-		return errors.New("storage is closed")
+		return ErrClosed
 	}
 
-	if metadata == nil {
-		_, err := node.storage.db.Exec("update or ignore metadata set metadata = null where reference = ?", node.reference)
-		if err != nil {
-			return err
-		}
-	} else {
-		metadataBytes, err := json.Marshal(metadata)
-		if err != nil {
-			return err
-		}
-
-		_, err = node.storage.db.Exec("update or ignore metadata set metadata = ? where reference = ?", string(metadataBytes), node.reference)
-		if err != nil {
-			return err
-		}
+	updatedAt, err := node.storage.updateMetadata(ctx, node.storage.db, node.reference, metadata)
+	if err != nil {
+		return err
 	}
 
 	node.metadata = metadata
+	node.updatedAt = updatedAt
+
+	return nil
+}
+
+func (node *FileNode) GetSize() int64 {
+	checkNodeIsNil(node)
+
+	return node.size
+}
+
+func (node *FileNode) GetCreatedAt() time.Time {
+	checkNodeIsNil(node)
+
+	return node.createdAt
+}
+
+func (node *FileNode) GetUpdatedAt() time.Time {
+	checkNodeIsNil(node)
+
+	return node.updatedAt
+}
+
+func (node *FileNode) GetContentType() string {
+	checkNodeIsNil(node)
+
+	return node.contentType
+}
+
+func (node *FileNode) SetContentType(contentType string) error {
+	return node.SetContentTypeContext(context.Background(), contentType)
+}
+
+func (node *FileNode) SetContentTypeContext(ctx context.Context, contentType string) error {
+	checkNodeIsNil(node)
+
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return ErrClosed
+	}
+
+	updatedAt, err := node.storage.updateContentType(ctx, node.storage.db, node.reference, contentType)
+	if err != nil {
+		return err
+	}
+
+	node.contentType = contentType
+	node.updatedAt = updatedAt
+
+	return nil
+}
+
+func (node *FileNode) SetTimes(createdAt time.Time, updatedAt time.Time) error {
+	return node.SetTimesContext(context.Background(), createdAt, updatedAt)
+}
+
+func (node *FileNode) SetTimesContext(ctx context.Context, createdAt time.Time, updatedAt time.Time) error {
+	checkNodeIsNil(node)
+
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return ErrClosed
+	}
+
+	err := node.storage.updateTimes(ctx, node.storage.db, node.reference, createdAt, updatedAt)
+	if err != nil {
+		return err
+	}
+
+	// Stored times have nanosecond precision without monotonic clock reading
+	if !createdAt.IsZero() {
+		node.createdAt = unixNanoToTime(createdAt.UnixNano())
+	}
+
+	if !updatedAt.IsZero() {
+		node.updatedAt = unixNanoToTime(updatedAt.UnixNano())
+	}
 
 	return nil
 }
 
+// Get codec content is stored with on disk, as of node load or last write through this node
+func (node *FileNode) GetCodec() Codec {
+	checkNodeIsNil(node)
+
+	return node.codec
+}
+
+// Get path of content file, content is stored compressed unless node codec is CodecNone
 func (node *FileNode) GetPath() string {
 	checkNodeIsNil(node)
 
-	return node.storage.getPathByReference(node.reference)
+	if !node.storage.options.ContentAddressed {
+		return node.storage.getPathByReference(node.reference)
+	}
+
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return ""
+	}
+
+	hash, err := node.storage.getBlobByReference(node.reference)
+	if err != nil || hash == "" {
+		return ""
+	}
+
+	return node.storage.getPathByBlob(hash)
 }
 
 func (node *FileNode) GetReader() (io.Reader, error) {
 	checkNodeIsNil(node)
 
-	return os.Open(node.GetPath())
+	return node.openReader()
 }
 
+func (node *FileNode) GetSeekReader() (ReadSeekCloserAt, error) {
+	checkNodeIsNil(node)
+
+	return node.openReader()
+}
+
+// Open content file under storage lock, so it is not replaced between looking up codec and opening it
+func (node *FileNode) openReader() (ReadSeekCloserAt, error) {
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return node.openReaderLocked()
+}
+
+// Open content file, storage lock must be held
+func (node *FileNode) openReaderLocked() (ReadSeekCloserAt, error) {
+	path, codec, size, err := node.storage.getContentByReference(node.reference)
+	if err != nil {
+		return nil, wrapError("read", node.reference, err)
+	}
+
+	if path == "" {
+		return nil, contentNotFoundError("read", node.reference)
+	}
+
+	reader, err := openContent(path, codec, size)
+	if err != nil {
+		return nil, wrapError("read", node.reference, err)
+	}
+
+	return reader, nil
+}
+
+// Get writer replacing node content.
+//
+// Content is written into temporary file and atomically moved into place on Close, so readers see either old or complete new content.
 func (node *FileNode) GetWriter() (io.Writer, error) {
 	checkNodeIsNil(node)
 
-	os.MkdirAll(node.storage.getDirByReference(node.reference), 0755)
-	return os.Create(node.GetPath())
+	return node.openWriter(os.O_RDWR|os.O_CREATE|os.O_TRUNC, node.storage.options.Compression)
 }
 
+// Get writer with os.OpenFile flag semantics: os.O_CREATE, os.O_EXCL, os.O_TRUNC and os.O_APPEND are respected.
+//
+// Existing content is copied into temporary file unless os.O_TRUNC is set, result is atomically moved into place on Close.
 func (node *FileNode) GetFlagWriter(flag int) (io.Writer, error) {
 	checkNodeIsNil(node)
 
-	os.MkdirAll(node.storage.getDirByReference(node.reference), 0755)
-	return os.OpenFile(node.GetPath(), flag, 0755)
+	return node.openWriter(flag, node.storage.options.Compression)
+}
+
+func (node *FileNode) GetWriteCloser() (io.WriteCloser, error) {
+	checkNodeIsNil(node)
+
+	return node.openWriter(os.O_RDWR|os.O_CREATE|os.O_TRUNC, node.storage.options.Compression)
+}
+
+func (node *FileNode) GetFlagWriteCloser(flag int) (io.WriteCloser, error) {
+	checkNodeIsNil(node)
+
+	return node.openWriter(flag, node.storage.options.Compression)
+}
+
+// Get writer like GetFlagWriteCloser storing content with given codec instead of storage Compression.
+//
+// Appended or overwritten content is decompressed and stored again with given codec.
+func (node *FileNode) GetFlagWriteCloserWithCodec(flag int, codec Codec) (io.WriteCloser, error) {
+	checkNodeIsNil(node)
+
+	return node.openWriter(flag, codec)
+}
+
+func (node *FileNode) openWriter(flag int, codec Codec) (io.WriteCloser, error) {
+	writer, err := node.newFileWriter(flag, codec)
+	if err != nil {
+		return nil, wrapError("write", node.reference, err)
+	}
+
+	return writer, nil
+}
+
+func (node *FileNode) newFileWriter(flag int, codec Codec) (*fileWriter, error) {
+	storage := node.storage
+
+	err := checkCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.lock.Lock()
+	if !storage.isOpen {
+		storage.lock.Unlock()
+		return nil, ErrClosed
+	}
+	currentPath, currentCodec, currentSize, err := storage.getContentByReference(node.reference)
+	storage.lock.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tempDir string
+	var commit func(tempPath string, hash string, size int64) error
+
+	if storage.options.ContentAddressed {
+		tempDir = storage.getTempDir()
+		commit = func(tempPath string, hash string, size int64) error {
+			updatedAt := time.Now().UnixNano()
+
+			err := storage.commitBlob(node.reference, tempPath, hash, size, codec, updatedAt)
+			if err == nil {
+				node.size = size
+				node.codec = codec
+				node.updatedAt = unixNanoToTime(updatedAt)
+			}
+
+			return err
+		}
+	} else {
+		if currentPath != "" {
+			_, err := os.Stat(currentPath)
+			if errors.Is(err, os.ErrNotExist) {
+				currentPath = ""
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		tempDir = storage.getDirByReference(node.reference)
+		commit = func(tempPath string, hash string, size int64) error {
+			updatedAt := time.Now().UnixNano()
+
+			err := storage.commitFile(node.reference, tempPath, hash, size, codec, updatedAt)
+			if err == nil {
+				node.size = size
+				node.codec = codec
+				node.updatedAt = unixNanoToTime(updatedAt)
+			}
+
+			return err
+		}
+	}
+
+	if currentPath == "" {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: node.reference, Err: os.ErrNotExist}
+		}
+	} else if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, &os.PathError{Op: "open", Path: node.reference, Err: os.ErrExist}
+	}
+
+	err = os.MkdirAll(tempDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp(tempDir, node.reference+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	file.Chmod(0755)
+
+	writer := &fileWriter{
+		reference: node.reference,
+		file:      file,
+		output:    file,
+		hash:      sha256.New(),
+		codec:     codec,
+		// Writes overwrite content from the start, hash is computed and content is compressed on Close
+		rehash: currentPath != "" && flag&(os.O_TRUNC|os.O_APPEND) == 0,
+		commit: commit,
+	}
+
+	if codec != CodecNone && !writer.rehash {
+		writer.encoder, err = newEncoder(codec, file)
+		if err != nil {
+			writer.Abort()
+			return nil, err
+		}
+
+		writer.output = writer.encoder
+	}
+
+	if currentPath != "" && flag&os.O_TRUNC == 0 {
+		source, err := openContent(currentPath, currentCodec, currentSize)
+		if err != nil {
+			writer.Abort()
+			return nil, err
+		}
+		defer source.Close()
+
+		if flag&os.O_APPEND != 0 {
+			writer.size, err = io.Copy(io.MultiWriter(writer.output, writer.hash), source)
+		} else {
+			_, err = io.Copy(file, source)
+			if err == nil {
+				_, err = file.Seek(0, io.SeekStart)
+			}
+		}
+
+		if err != nil {
+			writer.Abort()
+			return nil, err
+		}
+	}
+
+	return writer, nil
+}
+
+// Writer into temporary file, which is passed to commit on Close and removed on Abort
+type fileWriter struct {
+	reference string
+	file      *os.File
+	// Destination of writes, either file or encoder compressing into file
+	output  io.Writer
+	encoder io.WriteCloser
+	codec   Codec
+	hash    hash.Hash
+	// Size of uncompressed content
+	size   int64
+	rehash bool
+	closed bool
+	commit func(tempPath string, hash string, size int64) error
+}
+
+func (writer *fileWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, os.ErrClosed
+	}
+
+	n, err := writer.output.Write(p)
+	if !writer.rehash {
+		writer.hash.Write(p[:n])
+		writer.size += int64(n)
+	}
+
+	return n, err
+}
+
+func (writer *fileWriter) Close() error {
+	if writer.closed {
+		return os.ErrClosed
+	}
+
+	err := writer.finish()
+	if err != nil {
+		writer.Abort()
+		return wrapError("write", writer.reference, err)
+	}
+
+	writer.closed = true
+
+	err = writer.file.Sync()
+	if err != nil {
+		writer.file.Close()
+		os.Remove(writer.file.Name())
+		return wrapError("write", writer.reference, err)
+	}
+
+	err = writer.file.Close()
+	if err != nil {
+		os.Remove(writer.file.Name())
+		return wrapError("write", writer.reference, err)
+	}
+
+	return wrapError("write", writer.reference, writer.commit(writer.file.Name(), hex.EncodeToString(writer.hash.Sum(nil)), writer.size))
+}
+
+// Flush compressed stream, or hash and compress overwritten content
+func (writer *fileWriter) finish() error {
+	if writer.encoder != nil {
+		return writer.encoder.Close()
+	}
+
+	if !writer.rehash {
+		return nil
+	}
+
+	_, err := writer.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	writer.size, err = io.Copy(writer.hash, writer.file)
+	if err != nil || writer.codec == CodecNone {
+		return err
+	}
+
+	return writer.compress()
+}
+
+// Replace temporary file with its compressed copy
+func (writer *fileWriter) compress() error {
+	file, err := os.CreateTemp(filepath.Dir(writer.file.Name()), writer.reference+".tmp*")
+	if err != nil {
+		return err
+	}
+	file.Chmod(0755)
+
+	encoder, err := newEncoder(writer.codec, file)
+	if err == nil {
+		_, err = writer.file.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		_, err = io.Copy(encoder, writer.file)
+	}
+	if err == nil {
+		err = encoder.Close()
+	}
+
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	writer.file.Close()
+	os.Remove(writer.file.Name())
+	writer.file = file
+
+	return nil
+}
+
+// Discard written content and remove temporary file
+func (writer *fileWriter) Abort() error {
+	if writer.closed {
+		return os.ErrClosed
+	}
+
+	writer.closed = true
+	writer.file.Close()
+
+	return os.Remove(writer.file.Name())
 }
@@ -1,10 +1,15 @@
 package bloby
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -1055,3 +1060,716 @@ func TestFileIO(t *testing.T) {
 
 	assert.DirExists(t, testDirName)
 }
+
+func TestContentAddressed(t *testing.T) {
+	testDirName := "test-file-storage-TestContentAddressed"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: true})
+	assert.NotNil(t, storage)
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, flag int, content string) {
+		writer, err := node.(FlagWritable).GetFlagWriter(flag)
+		assert.NoError(t, err)
+
+		_, err = writer.Write([]byte(content))
+		assert.NoError(t, err)
+
+		err = writer.(io.Closer).Close()
+		assert.NoError(t, err)
+	}
+
+	read := func(node Node) string {
+		reader, err := node.(Readable).GetReader()
+		assert.NoError(t, err)
+		defer reader.(io.Closer).Close()
+
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+
+		return string(content)
+	}
+
+	node1, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	node2, err := storage.Create("more cats", nil)
+	assert.NoError(t, err)
+
+	// No content yet
+	assert.Equal(t, "", node1.(Pathable).GetPath())
+
+	_, err = node1.(Readable).GetReader()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Same content shares blob
+	write(node1, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, "meow")
+	write(node2, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, "meow")
+
+	blobPath := node1.(Pathable).GetPath()
+	assert.NotEqual(t, "", blobPath)
+	assert.Equal(t, blobPath, node2.(Pathable).GetPath())
+	assert.FileExists(t, blobPath)
+	assert.Equal(t, "meow", read(node1))
+	assert.Equal(t, "meow", read(node2))
+
+	// Append and overwrite keep existing content
+	write(node2, os.O_WRONLY|os.O_APPEND, "-purr")
+	assert.Equal(t, "meow-purr", read(node2))
+
+	write(node2, os.O_WRONLY, "MEOW")
+	assert.Equal(t, "MEOW-purr", read(node2))
+	assert.NotEqual(t, blobPath, node2.(Pathable).GetPath())
+
+	_, err = node2.(FlagWritable).GetFlagWriter(os.O_WRONLY | os.O_CREATE | os.O_EXCL)
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	// Blob is kept while referenced
+	write(node2, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, "meow")
+	assert.Equal(t, blobPath, node2.(Pathable).GetPath())
+
+	err = storage.Delete(node1.GetReference())
+	assert.NoError(t, err)
+	assert.FileExists(t, blobPath)
+
+	// Rewrite frees unreferenced blob
+	write(node2, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, "woof")
+	assert.NoFileExists(t, blobPath)
+
+	blobPath = node2.(Pathable).GetPath()
+	assert.FileExists(t, blobPath)
+
+	err = storage.DeleteBy("more", "")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, blobPath)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	assert.DirExists(t, testDirName)
+}
+
+func TestContentAddressedMode(t *testing.T) {
+	testDirName := "test-file-storage-TestContentAddressedMode"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	for _, contentAddressed := range []bool{true, false} {
+		os.RemoveAll(testDirName)
+
+		storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: contentAddressed})
+		err := storage.Open()
+		assert.NoError(t, err)
+
+		node, err := storage.Create("cats", nil)
+		assert.NoError(t, err)
+
+		writer, err := node.(*FileNode).GetWriteCloser()
+		assert.NoError(t, err)
+		writer.Write([]byte("meow"))
+		assert.NoError(t, writer.Close())
+
+		err = storage.Close()
+		assert.NoError(t, err)
+
+		// Mode is recorded on first open
+		mismatched := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: !contentAddressed})
+		err = mismatched.Open()
+		assert.ErrorIs(t, err, ErrOptionsMismatch)
+
+		_, err = mismatched.GetByName("cats")
+		assert.ErrorIs(t, err, ErrClosed)
+
+		// Mode of storage created before it was recorded is detected from content
+		err = storage.Open()
+		assert.NoError(t, err)
+		_, err = storage.db.Exec("delete from settings")
+		assert.NoError(t, err)
+		err = storage.Close()
+		assert.NoError(t, err)
+
+		err = mismatched.Open()
+		assert.ErrorIs(t, err, ErrOptionsMismatch)
+
+		err = storage.Open()
+		assert.NoError(t, err)
+
+		value, ok, err := querySetting(storage.db, settingContentAddressed)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, fmt.Sprint(contentAddressed), value)
+
+		err = storage.Close()
+		assert.NoError(t, err)
+	}
+}
+
+func TestAtomicWrite(t *testing.T) {
+	testDirName := "test-file-storage-TestAtomicWrite"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorage(testDirName)
+	assert.NotNil(t, storage)
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	read := func() string {
+		reader, err := node.(Readable).GetReader()
+		assert.NoError(t, err)
+		defer reader.(io.Closer).Close()
+
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+
+		return string(content)
+	}
+
+	writer, err := node.(Writable).GetWriter()
+	assert.NoError(t, err)
+
+	_, err = writer.Write([]byte("meow"))
+	assert.NoError(t, err)
+
+	// Content is not visible until Close
+	_, err = node.(Readable).GetReader()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = writer.(io.Closer).Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", read())
+
+	// Partial write keeps old content
+	writer, err = node.(Writable).GetWriter()
+	assert.NoError(t, err)
+
+	_, err = writer.Write([]byte("wo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", read())
+
+	// Aborted write is discarded
+	err = writer.(Abortable).Abort()
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", read())
+
+	_, err = writer.Write([]byte("of"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	entries, err := os.ReadDir(storage.getDirByReference(node.GetReference()))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Write to deleted node fails
+	writer, err = node.(Writable).GetWriter()
+	assert.NoError(t, err)
+
+	err = storage.Delete(node.GetReference())
+	assert.NoError(t, err)
+
+	_, err = writer.Write([]byte("woof"))
+	assert.NoError(t, err)
+
+	err = writer.(io.Closer).Close()
+	assert.Error(t, err)
+	assert.NoFileExists(t, storage.getPathByReference(node.GetReference()))
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	assert.DirExists(t, testDirName)
+}
+
+func TestContext(t *testing.T) {
+	testDirName := "test-file-storage-TestContext"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorage(testDirName)
+	assert.NotNil(t, storage)
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	// Check interface implementation
+	storageCast, ok := (interface{}(storage)).(StorageContext)
+	assert.True(t, ok)
+	assert.NotNil(t, storageCast)
+
+	ctx := context.Background()
+
+	node, err := storage.CreateContext(ctx, "cats", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, node)
+
+	err = node.(MutableContext).SetNameContext(ctx, "dogs")
+	assert.NoError(t, err)
+
+	err = node.(MutableContext).SetMetadataContext(ctx, "woof")
+	assert.NoError(t, err)
+
+	nodeRequeried, err := storage.GetByNameContext(ctx, "dogs")
+	assert.NoError(t, err)
+	assert.Equal(t, "woof", nodeRequeried.GetMetadata())
+
+	nodes, err := storage.ListByContext(ctx, "do", "")
+	assert.NoError(t, err)
+	CheckQueriedNodes(t, []string{"dogs"}, []string{node.GetReference()}, nodes)
+
+	// Cancelled context
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = storage.CreateContext(cancelled, "cats", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = storage.GetByReferenceContext(cancelled, node.GetReference())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = storage.ListReferencesContext(cancelled, "", "")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = storage.DeleteByContext(cancelled, "", "")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = node.(MutableContext).SetNameContext(cancelled, "cats")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "dogs", node.GetName())
+
+	exists, err := storage.ExistsByReferenceContext(ctx, node.GetReference())
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	err = storage.DeleteContext(ctx, node.GetReference())
+	assert.NoError(t, err)
+
+	exists, err = storage.ExistsByNameContext(ctx, "dogs")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	assert.DirExists(t, testDirName)
+}
+
+func TestMetadataIndex(t *testing.T) {
+	testDirName := "test-file-storage-TestMetadataIndex"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{MetadataIndexes: []string{"owner"}})
+	assert.NotNil(t, storage)
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	usesIndex := func(path string) bool {
+		rows, err := storage.db.Query("explain query plan select reference from metadata where " + metadataPathExpression(path) + " = 'alice'")
+		assert.NoError(t, err)
+		defer rows.Close()
+
+		found := false
+
+		for rows.Next() {
+			var id, parent, unused int
+			var detail string
+
+			assert.NoError(t, rows.Scan(&id, &parent, &unused, &detail))
+			found = found || strings.Contains(detail, metadataIndexName(path))
+		}
+
+		return found
+	}
+
+	assert.True(t, usesIndex("owner"))
+	assert.False(t, usesIndex("type"))
+
+	err = storage.CreateMetadataIndex("type")
+	assert.NoError(t, err)
+	assert.True(t, usesIndex("type"))
+
+	err = storage.DropMetadataIndex("type")
+	assert.NoError(t, err)
+	assert.False(t, usesIndex("type"))
+
+	err = storage.CreateMetadataIndex("type'")
+	assert.Error(t, err)
+
+	_, err = storage.Create("cats", map[string]interface{}{"owner": "alice"})
+	assert.NoError(t, err)
+
+	nodes, err := storage.Query("", "", Condition{Path: "owner", Op: OpEqual, Value: "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cats"}, NodesToNames(nodes))
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Invalid index path fails Open
+	storage = NewFileStorageWithOptions(testDirName, FileStorageOptions{MetadataIndexes: []string{"owner;"}})
+
+	err = storage.Open()
+	assert.Error(t, err)
+
+	assert.DirExists(t, testDirName)
+}
+
+func TestLockMode(t *testing.T) {
+	testDirName := "test-file-storage-TestLockMode"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	exclusive := NewFileStorageWithOptions(testDirName, FileStorageOptions{LockMode: LockExclusive, ContentAddressed: true})
+	err := exclusive.Open()
+	assert.NoError(t, err)
+
+	// Second exclusive and shared opens fail
+	err = NewFileStorageWithOptions(testDirName, FileStorageOptions{LockMode: LockExclusive, ContentAddressed: true}).Open()
+	assert.ErrorIs(t, err, ErrLocked)
+
+	err = NewFileStorageWithOptions(testDirName, FileStorageOptions{LockMode: LockShared, ContentAddressed: true}).Open()
+	assert.ErrorIs(t, err, ErrLocked)
+
+	err = exclusive.Close()
+	assert.NoError(t, err)
+
+	// Shared opens coexist and block exclusive open
+	options := FileStorageOptions{LockMode: LockShared, ContentAddressed: true}
+
+	shared1 := NewFileStorageWithOptions(testDirName, options)
+	err = shared1.Open()
+	assert.NoError(t, err)
+
+	shared2 := NewFileStorageWithOptions(testDirName, options)
+	err = shared2.Open()
+	assert.NoError(t, err)
+
+	err = exclusive.Open()
+	assert.ErrorIs(t, err, ErrLocked)
+
+	// Concurrent writers sharing blobs
+	var wait sync.WaitGroup
+
+	for index, storage := range []*FileStorage{shared1, shared2, shared1, shared2} {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			for iteration := range 20 {
+				node, err := storage.Create(fmt.Sprint(index, "-", iteration), nil)
+				assert.NoError(t, err)
+
+				writer, err := node.(*FileNode).GetWriteCloser()
+				assert.NoError(t, err)
+
+				writer.Write([]byte("shared content"))
+				assert.NoError(t, writer.Close())
+
+				if iteration%2 == 0 {
+					assert.NoError(t, storage.Delete(node.GetReference()))
+				}
+			}
+		}()
+	}
+
+	wait.Wait()
+
+	nodes, err := shared2.ListBy("", "")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 40)
+
+	for _, node := range nodes {
+		reader, err := node.(*FileNode).GetSeekReader()
+		assert.NoError(t, err)
+
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "shared content", string(content))
+		reader.Close()
+	}
+
+	err = shared1.Close()
+	assert.NoError(t, err)
+
+	err = shared2.Close()
+	assert.NoError(t, err)
+
+	// Storage left in WAL mode opens without locking
+	storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: true})
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	nodes, err = storage.ListBy("", "")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 40)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestTransaction(t *testing.T) {
+	testDirName := "test-file-storage-TestTransaction"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorage(testDirName)
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	writer, err := node.(*FileNode).GetWriteCloser()
+	assert.NoError(t, err)
+
+	writer.Write([]byte("meow"))
+	assert.NoError(t, writer.Close())
+
+	path := node.(*FileNode).GetPath()
+
+	// Content is kept on rollback
+	err = storage.Transaction(func(tx Tx) error {
+		err := tx.Delete(node.GetReference())
+		assert.NoError(t, err)
+
+		_, err = os.Stat(path)
+		assert.NoError(t, err)
+
+		return errors.New("rollback")
+	})
+	assert.Error(t, err)
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+
+	// Content is removed after commit
+	err = storage.Transaction(func(tx Tx) error {
+		err := tx.Delete(node.GetReference())
+		assert.NoError(t, err)
+
+		_, err = os.Stat(path)
+		assert.NoError(t, err)
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	err = storage.Transaction(func(tx Tx) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestUniqueNames(t *testing.T) {
+	testDirName := "test-file-storage-TestUniqueNames"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	// Duplicates prevent unique mode
+	storage := NewFileStorage(testDirName)
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	duplicate1, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	duplicate2, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	storage = NewFileStorageWithOptions(testDirName, FileStorageOptions{UniqueNames: true})
+	err = storage.Open()
+	assert.ErrorIs(t, err, ErrNameConflict)
+
+	storage = NewFileStorage(testDirName)
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	err = storage.Delete(duplicate2.GetReference())
+	assert.NoError(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Unique mode
+	storage = NewFileStorageWithOptions(testDirName, FileStorageOptions{UniqueNames: true})
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	_, err = storage.Create("cats", nil)
+	assert.ErrorIs(t, err, ErrNameConflict)
+
+	var storageError *StorageError
+	assert.True(t, errors.As(err, &storageError))
+	assert.Equal(t, "create", storageError.Op)
+
+	dogs, err := storage.Create("dogs", nil)
+	assert.NoError(t, err)
+
+	err = dogs.(*FileNode).SetName("cats")
+	assert.ErrorIs(t, err, ErrNameConflict)
+	assert.Equal(t, "dogs", dogs.GetName())
+
+	err = storage.Transaction(func(tx Tx) error {
+		_, err := tx.Create("birds", nil)
+		assert.NoError(t, err)
+
+		_, err = tx.Create("cats", nil)
+		return err
+	})
+	assert.ErrorIs(t, err, ErrNameConflict)
+
+	exists, err := storage.ExistsByName("birds")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Replace keeps reference and content
+	cats, err := storage.GetByName("cats")
+	assert.NoError(t, err)
+	assert.Equal(t, duplicate1.GetReference(), cats.GetReference())
+
+	writer, err := cats.(*FileNode).GetWriteCloser()
+	assert.NoError(t, err)
+
+	writer.Write([]byte("meow"))
+	assert.NoError(t, writer.Close())
+
+	node, err := storage.CreateOrReplace("cats", map[string]interface{}{"amount": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, duplicate1.GetReference(), node.GetReference())
+	assert.Equal(t, map[string]interface{}{"amount": 2}, node.GetMetadata())
+
+	reader, err := node.(*FileNode).GetSeekReader()
+	assert.NoError(t, err)
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", string(content))
+	reader.Close()
+
+	node, err = storage.CreateOrReplace("birds", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "birds", node.GetName())
+
+	nodes, err := storage.ListBy("", "")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 3)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Unique names are kept by opens without option
+	storage = NewFileStorageWithOptions(testDirName, FileStorageOptions{LockMode: LockShared})
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	_, err = storage.Create("cats", nil)
+	assert.ErrorIs(t, err, ErrNameConflict)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Explicit opt out
+	storage = NewFileStorageWithOptions(testDirName, FileStorageOptions{UniqueNames: true, AllowDuplicateNames: true})
+	err = storage.Open()
+	assert.Error(t, err)
+
+	storage = NewFileStorageWithOptions(testDirName, FileStorageOptions{AllowDuplicateNames: true})
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	_, err = storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestSystemColumns(t *testing.T) {
+	testDirName := "test-file-storage-TestSystemColumns"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	for _, contentAddressed := range []bool{false, true} {
+		os.RemoveAll(testDirName)
+
+		storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: contentAddressed})
+		err := storage.Open()
+		assert.NoError(t, err)
+
+		node, err := storage.Create("cats", nil)
+		assert.NoError(t, err)
+
+		writer, err := node.(*FileNode).GetWriteCloser()
+		assert.NoError(t, err)
+		writer.Write([]byte("meow"))
+		assert.NoError(t, writer.Close())
+
+		empty, err := storage.Create("empty", nil)
+		assert.NoError(t, err)
+
+		// Rows written before system columns were maintained
+		_, err = storage.db.Exec("update metadata set size = null, created_at = 0, updated_at = 0")
+		assert.NoError(t, err)
+		_, err = storage.db.Exec("pragma user_version = 3")
+		assert.NoError(t, err)
+
+		modTime := time.Unix(1700000000, 0)
+		assert.NoError(t, os.Chtimes(node.(*FileNode).GetPath(), modTime, modTime))
+
+		err = storage.Close()
+		assert.NoError(t, err)
+
+		err = storage.Open()
+		assert.NoError(t, err)
+
+		loaded, err := storage.GetByReference(node.GetReference())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), loaded.(*FileNode).GetSize())
+		assert.True(t, loaded.(*FileNode).GetCreatedAt().IsZero())
+		assert.True(t, loaded.(*FileNode).GetUpdatedAt().Equal(modTime))
+
+		loaded, err = storage.GetByReference(empty.GetReference())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), loaded.(*FileNode).GetSize())
+		assert.True(t, loaded.(*FileNode).GetUpdatedAt().IsZero())
+
+		err = storage.Close()
+		assert.NoError(t, err)
+	}
+}
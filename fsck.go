@@ -0,0 +1,433 @@
+package bloby
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Temporary files modified within this duration are considered in use by running writers
+const DefaultTempFileAge = time.Hour
+
+// Inconsistencies between metadata database and content files, paths are relative to storage directory
+type CheckReport struct {
+	// Content files without metadata row or blob record
+	OrphanFiles []string
+	// Temporary files left by interrupted writes
+	TempFiles []string
+	// References of nodes without content file, including nodes that were never written
+	MissingContent []string
+	// Names of blobs referenced by nodes, but missing on disk, in content addressed mode
+	MissingBlobs []string
+	// Names of blobs with reference counter not matching amount of referencing nodes, in content addressed mode
+	BadRefcounts []string
+}
+
+type RepairOptions struct {
+	// Move orphan files into `quarantine/` directory instead of removing them
+	Quarantine bool
+	// Delete nodes without content, nodes that were never written are deleted too
+	DeleteMissingContent bool
+	// Temporary files modified more recently are kept, defaults to DefaultTempFileAge
+	TempFileAge time.Duration
+}
+
+func (storage *FileStorage) getQuarantineDir() string {
+	return filepath.Join(storage.path, "quarantine")
+}
+
+// List regular files under directory, missing directory has no files
+func (storage *FileStorage) walkFiles(ctx context.Context, dir string, callback func(path string) error) error {
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		return callback(path)
+	})
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (storage *FileStorage) relativePath(path string) string {
+	relativePath, err := filepath.Rel(storage.path, path)
+	if err != nil {
+		return path
+	}
+
+	return relativePath
+}
+
+func isTempFile(path string) bool {
+	return strings.Contains(filepath.Base(path), ".tmp")
+}
+
+func (storage *FileStorage) check(ctx context.Context, db queryExecutor) (CheckReport, error) {
+	report := CheckReport{
+		OrphanFiles:    make([]string, 0),
+		TempFiles:      make([]string, 0),
+		MissingContent: make([]string, 0),
+		MissingBlobs:   make([]string, 0),
+		BadRefcounts:   make([]string, 0),
+	}
+
+	if !storage.options.ContentAddressed {
+		references, err := storage.queryStrings(ctx, db, "select reference from metadata")
+		if err != nil {
+			return report, err
+		}
+
+		found := make(map[string]bool, len(references))
+		for _, reference := range references {
+			found[reference] = false
+		}
+
+		err = storage.walkFiles(ctx, filepath.Join(storage.path, "tree"), func(path string) error {
+			if isTempFile(path) {
+				report.TempFiles = append(report.TempFiles, storage.relativePath(path))
+				return nil
+			}
+
+			reference := filepath.Base(path)
+			if _, ok := found[reference]; ok && len(reference) >= 6 && filepath.Clean(storage.getPathByReference(reference)) == path {
+				found[reference] = true
+			} else {
+				report.OrphanFiles = append(report.OrphanFiles, storage.relativePath(path))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+
+		for _, reference := range references {
+			if !found[reference] {
+				report.MissingContent = append(report.MissingContent, reference)
+			}
+		}
+
+		return report, nil
+	}
+
+	// Actual reference counts of blobs
+	rows, err := db.QueryContext(ctx, "select blob, count(*) from metadata where blob is not null group by blob")
+	if err != nil {
+		return report, err
+	}
+
+	counts := make(map[string]int64)
+
+	for rows.Next() {
+		var resultBlob string
+		var resultCount int64
+
+		err = rows.Scan(&resultBlob, &resultCount)
+		if err != nil {
+			rows.Close()
+			return report, err
+		}
+
+		counts[resultBlob] = resultCount
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return report, err
+	}
+
+	// Stored reference counts
+	rows, err = db.QueryContext(ctx, "select hash, refcount from blobs")
+	if err != nil {
+		return report, err
+	}
+
+	refcounts := make(map[string]int64)
+
+	for rows.Next() {
+		var resultHash string
+		var resultRefcount int64
+
+		err = rows.Scan(&resultHash, &resultRefcount)
+		if err != nil {
+			rows.Close()
+			return report, err
+		}
+
+		refcounts[resultHash] = resultRefcount
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return report, err
+	}
+
+	for hash, refcount := range refcounts {
+		if counts[hash] != refcount {
+			report.BadRefcounts = append(report.BadRefcounts, hash)
+		}
+	}
+
+	for hash := range counts {
+		if _, ok := refcounts[hash]; !ok {
+			report.BadRefcounts = append(report.BadRefcounts, hash)
+		}
+	}
+
+	found := make(map[string]bool, len(counts))
+
+	err = storage.walkFiles(ctx, filepath.Join(storage.path, "blobs"), func(path string) error {
+		hash := filepath.Base(path)
+
+		_, referenced := counts[hash]
+		_, recorded := refcounts[hash]
+
+		if (referenced || recorded) && len(hash) >= 6 && filepath.Clean(storage.getPathByBlob(hash)) == path {
+			found[hash] = true
+		} else {
+			report.OrphanFiles = append(report.OrphanFiles, storage.relativePath(path))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	err = storage.walkFiles(ctx, storage.getTempDir(), func(path string) error {
+		report.TempFiles = append(report.TempFiles, storage.relativePath(path))
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for hash := range counts {
+		if !found[hash] {
+			report.MissingBlobs = append(report.MissingBlobs, hash)
+		}
+	}
+
+	references, err := storage.queryStrings(ctx, db, "select reference from metadata where blob is null")
+	if err != nil {
+		return report, err
+	}
+
+	report.MissingContent = append(report.MissingContent, references...)
+
+	for _, hash := range report.MissingBlobs {
+		references, err := storage.queryStrings(ctx, db, "select reference from metadata where blob = ?", hash)
+		if err != nil {
+			return report, err
+		}
+
+		report.MissingContent = append(report.MissingContent, references...)
+	}
+
+	return report, nil
+}
+
+func (storage *FileStorage) Check() (CheckReport, error) {
+	return storage.CheckContext(context.Background())
+}
+
+// Find content files without metadata, nodes without content and broken blob records, storage is not modified
+func (storage *FileStorage) CheckContext(ctx context.Context) (CheckReport, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return CheckReport{}, ErrClosed
+	}
+
+	report, err := storage.check(ctx, storage.db)
+	if err != nil {
+		return report, wrapError("check", "", err)
+	}
+
+	return report, nil
+}
+
+func (storage *FileStorage) Repair(options RepairOptions) (CheckReport, error) {
+	return storage.RepairContext(context.Background(), options)
+}
+
+// Fix inconsistencies found by Check and return found inconsistencies.
+//
+// Orphan files are removed or quarantined, stale temporary files are removed, reference counters are recalculated
+// and nodes pointing to missing blobs are reset to nodes without content.
+// Candidates are checked again inside write transaction, so files committed by concurrent writers are kept.
+func (storage *FileStorage) RepairContext(ctx context.Context, options RepairOptions) (CheckReport, error) {
+	checkStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return CheckReport{}, ErrClosed
+	}
+
+	tempFileAge := options.TempFileAge
+	if tempFileAge <= 0 {
+		tempFileAge = DefaultTempFileAge
+	}
+
+	var report CheckReport
+
+	// Orphan files are removed after commit, so rolled back repair keeps them
+	var orphans []string
+
+	err := storage.transaction(ctx, func(tx *fileTx) error {
+		var err error
+
+		orphans = nil
+
+		report, err = storage.check(ctx, tx.tx)
+		if err != nil {
+			return err
+		}
+
+		if storage.options.ContentAddressed {
+			for _, hash := range report.MissingBlobs {
+				_, err = tx.tx.ExecContext(ctx, "update metadata set blob = null, checksum = null, size = 0, codec = '' where blob = ?", hash)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Recalculate all counters, blobs left without references become orphans
+			_, err = tx.tx.ExecContext(ctx, "insert into blobs (hash, refcount) select blob, count(*) from metadata where blob is not null group by blob on conflict(hash) do update set refcount = excluded.refcount")
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.tx.ExecContext(ctx, "delete from blobs where hash not in (select blob from metadata where blob is not null)")
+			if err != nil {
+				return err
+			}
+
+			for _, hash := range report.BadRefcounts {
+				relativePath := storage.relativePath(storage.getPathByBlob(hash))
+
+				orphan, err := storage.isOrphan(ctx, tx.tx, relativePath)
+				if err != nil {
+					return err
+				}
+
+				if orphan {
+					orphans = append(orphans, relativePath)
+				}
+			}
+		}
+
+		if options.DeleteMissingContent {
+			for _, reference := range report.MissingContent {
+				err = tx.Delete(reference)
+				if err != nil && err != ErrNotFound {
+					return err
+				}
+			}
+		}
+
+		for _, relativePath := range report.OrphanFiles {
+			orphan, err := storage.isOrphan(ctx, tx.tx, relativePath)
+			if err != nil {
+				return err
+			}
+
+			if orphan {
+				orphans = append(orphans, relativePath)
+			}
+		}
+
+		for _, relativePath := range report.TempFiles {
+			path := filepath.Join(storage.path, relativePath)
+
+			info, err := os.Stat(path)
+			if err != nil || time.Since(info.ModTime()) < tempFileAge {
+				continue
+			}
+
+			os.Remove(path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return report, wrapError("repair", "", err)
+	}
+
+	for _, relativePath := range orphans {
+		err = storage.removeOrphan(relativePath, options.Quarantine)
+		if err != nil {
+			return report, wrapError("repair", "", err)
+		}
+	}
+
+	return report, nil
+}
+
+// Check file found by check has no metadata, so file committed after check is kept
+func (storage *FileStorage) isOrphan(ctx context.Context, tx *sql.Tx, relativePath string) (bool, error) {
+	name := filepath.Base(relativePath)
+
+	var query string
+	if storage.options.ContentAddressed {
+		query = "select 1 from blobs where hash = ?"
+	} else {
+		query = "select 1 from metadata where reference = ?"
+	}
+
+	exists, err := storage.queryExists(ctx, tx, query, name)
+	if err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
+// Remove or quarantine orphan file
+func (storage *FileStorage) removeOrphan(relativePath string, quarantine bool) error {
+	path := filepath.Join(storage.path, relativePath)
+
+	if !quarantine {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	quarantinePath := filepath.Join(storage.getQuarantineDir(), relativePath)
+
+	err := os.MkdirAll(filepath.Dir(quarantinePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(path, quarantinePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
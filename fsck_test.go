@@ -0,0 +1,192 @@
+package bloby
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRepair(t *testing.T) {
+	testDirName := "test-file-storage-TestCheckRepair"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorage(testDirName)
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, content string) {
+		writer, err := node.(*FileNode).GetWriteCloser()
+		assert.NoError(t, err)
+
+		writer.Write([]byte(content))
+		assert.NoError(t, writer.Close())
+	}
+
+	writeFile := func(path string, modTime time.Time) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("junk"), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	written, err := storage.Create("written", nil)
+	assert.NoError(t, err)
+	write(written, "meow")
+
+	empty, err := storage.Create("empty", nil)
+	assert.NoError(t, err)
+
+	lost, err := storage.Create("lost", nil)
+	assert.NoError(t, err)
+	write(lost, "woof")
+	assert.NoError(t, os.Remove(lost.(*FileNode).GetPath()))
+
+	orphanReference := strings.Repeat("ab", 25)
+	writeFile(storage.getPathByReference(orphanReference), time.Now())
+	writeFile(storage.getPathByReference(written.GetReference())+".tmp1", time.Now().Add(-2*time.Hour))
+	writeFile(storage.getPathByReference(written.GetReference())+".tmp2", time.Now())
+
+	report, err := storage.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("tree", "ab", "ab", "ab", orphanReference)}, report.OrphanFiles)
+	assert.Len(t, report.TempFiles, 2)
+	assert.ElementsMatch(t, []string{empty.GetReference(), lost.GetReference()}, report.MissingContent)
+	assert.Empty(t, report.MissingBlobs)
+	assert.Empty(t, report.BadRefcounts)
+
+	// Orphans are quarantined and stale temporary files are removed
+	_, err = storage.Repair(RepairOptions{Quarantine: true})
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(testDirName, "quarantine", "tree", "ab", "ab", "ab", orphanReference))
+	assert.NoError(t, err)
+
+	report, err = storage.Check()
+	assert.NoError(t, err)
+	assert.Empty(t, report.OrphanFiles)
+	assert.Len(t, report.TempFiles, 1)
+	assert.Len(t, report.MissingContent, 2)
+
+	// Nodes without content are deleted
+	_, err = storage.Repair(RepairOptions{DeleteMissingContent: true})
+	assert.NoError(t, err)
+
+	references, err := storage.ListReferences("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{written.GetReference()}, references)
+
+	report, err = storage.Check()
+	assert.NoError(t, err)
+	assert.Empty(t, report.MissingContent)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	_, err = storage.Check()
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestCheckRepairContentAddressed(t *testing.T) {
+	testDirName := "test-file-storage-TestCheckRepairContentAddressed"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewFileStorageWithOptions(testDirName, FileStorageOptions{ContentAddressed: true})
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	write := func(node Node, content string) {
+		writer, err := node.(*FileNode).GetWriteCloser()
+		assert.NoError(t, err)
+
+		writer.Write([]byte(content))
+		assert.NoError(t, writer.Close())
+	}
+
+	shared1, err := storage.Create("shared1", nil)
+	assert.NoError(t, err)
+	write(shared1, "meow")
+
+	shared2, err := storage.Create("shared2", nil)
+	assert.NoError(t, err)
+	write(shared2, "meow")
+
+	lost, err := storage.Create("lost", nil)
+	assert.NoError(t, err)
+	write(lost, "woof")
+
+	lostHash, err := storage.getBlobByReference(lost.GetReference())
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(storage.getPathByBlob(lostHash)))
+
+	sharedHash, err := storage.getBlobByReference(shared1.GetReference())
+	assert.NoError(t, err)
+
+	_, err = storage.db.Exec("update blobs set refcount = 5 where hash = ?", sharedHash)
+	assert.NoError(t, err)
+
+	// Blob recorded without references
+	unreferencedHash := strings.Repeat("cd", 32)
+	_, err = storage.db.Exec("insert into blobs (hash, refcount) values (?, 1)", unreferencedHash)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(storage.getDirByBlob(unreferencedHash), 0755))
+	assert.NoError(t, os.WriteFile(storage.getPathByBlob(unreferencedHash), []byte("junk"), 0644))
+
+	orphanHash := strings.Repeat("ef", 32)
+	assert.NoError(t, os.MkdirAll(storage.getDirByBlob(orphanHash), 0755))
+	assert.NoError(t, os.WriteFile(storage.getPathByBlob(orphanHash), []byte("junk"), 0644))
+
+	report, err := storage.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("blobs", "ef", "ef", "ef", orphanHash)}, report.OrphanFiles)
+	assert.Equal(t, []string{lostHash}, report.MissingBlobs)
+	assert.Equal(t, []string{lost.GetReference()}, report.MissingContent)
+	assert.ElementsMatch(t, []string{sharedHash, unreferencedHash}, report.BadRefcounts)
+
+	_, err = storage.Repair(RepairOptions{})
+	assert.NoError(t, err)
+
+	report, err = storage.Check()
+	assert.NoError(t, err)
+	assert.Empty(t, report.OrphanFiles)
+	assert.Empty(t, report.MissingBlobs)
+	assert.Empty(t, report.BadRefcounts)
+	assert.Equal(t, []string{lost.GetReference()}, report.MissingContent)
+
+	_, err = os.Stat(storage.getPathByBlob(unreferencedHash))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Node with missing blob is reset to node without content
+	_, err = lost.(*FileNode).GetChecksum()
+	assert.ErrorIs(t, err, ErrNoChecksum)
+
+	lost, err = storage.GetByReference(lost.GetReference())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), lost.(*FileNode).GetSize())
+
+	scrubReport, err := storage.Scrub()
+	assert.NoError(t, err)
+	assert.Empty(t, scrubReport.Corrupted)
+
+	// Shared blob is released only after both nodes are deleted
+	assert.NoError(t, storage.Delete(shared1.GetReference()))
+
+	_, err = os.Stat(storage.getPathByBlob(sharedHash))
+	assert.NoError(t, err)
+
+	assert.NoError(t, storage.Delete(shared2.GetReference()))
+
+	_, err = os.Stat(storage.getPathByBlob(sharedHash))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,648 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrate16/bloby"
+)
+
+// Unexpected response of bloby HTTP server
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+}
+
+// Unwrap to storage error matching status
+func (err *StatusError) Unwrap() error {
+	switch err.StatusCode {
+	case http.StatusNotFound:
+		return bloby.ErrNotFound
+	case http.StatusConflict:
+		return bloby.ErrNameConflict
+	case http.StatusNotImplemented:
+		return errors.ErrUnsupported
+	default:
+		return nil
+	}
+}
+
+func checkRemoteStorageIsNil(storage *RemoteStorage) {
+	if storage == nil {
+		panic("storage is nil")
+	}
+}
+
+func checkRemoteNodeIsNil(node *RemoteNode) {
+	if node == nil {
+		panic("node is nil")
+	}
+}
+
+// Storage served by Handler of bloby HTTP server.
+//
+// Open and Close only change client state, server storage is not opened or closed.
+type RemoteStorage struct {
+	lock    sync.Mutex
+	isOpen  bool
+	baseURL string
+	client  *http.Client
+}
+
+func NewRemoteStorage(baseURL string) *RemoteStorage {
+	return NewRemoteStorageWithClient(baseURL, http.DefaultClient)
+}
+
+func NewRemoteStorageWithClient(baseURL string, client *http.Client) *RemoteStorage {
+	return &RemoteStorage{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+	}
+}
+
+func (storage *RemoteStorage) Open() error {
+	checkRemoteStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if storage.isOpen {
+		return bloby.ErrAlreadyOpen
+	}
+
+	storage.isOpen = true
+
+	return nil
+}
+
+func (storage *RemoteStorage) Close() error {
+	checkRemoteStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return bloby.ErrClosed
+	}
+
+	storage.isOpen = false
+
+	return nil
+}
+
+func (storage *RemoteStorage) checkOpen() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return bloby.ErrClosed
+	}
+
+	return nil
+}
+
+func listQuery(namePrefix string, namePostfix string) string {
+	query := url.Values{}
+	query.Set("prefix", namePrefix)
+	query.Set("postfix", namePostfix)
+
+	return "?" + query.Encode()
+}
+
+func nameQuery(name string) string {
+	query := url.Values{}
+	query.Set("name", name)
+
+	return "?" + query.Encode()
+}
+
+// Decode error response
+func readStatusError(response *http.Response) error {
+	var body errorResponse
+
+	content, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if json.Unmarshal(content, &body) != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(content))
+	}
+
+	return &StatusError{
+		StatusCode: response.StatusCode,
+		Message:    body.Error,
+	}
+}
+
+// Send request, response body must be closed by caller
+func (storage *RemoteStorage) do(ctx context.Context, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	err := storage.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, storage.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	return storage.client.Do(request)
+}
+
+// Send request with JSON body and decode JSON response into result, fails unless response status is expected status
+func (storage *RemoteStorage) doJSON(ctx context.Context, method string, path string, request interface{}, status int, result interface{}) error {
+	var body io.Reader
+	contentType := ""
+
+	if request != nil {
+		requestBytes, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(requestBytes)
+		contentType = "application/json"
+	}
+
+	response, err := storage.do(ctx, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+
+	return decodeResponse(response, status, result)
+}
+
+// Decode JSON response into result and close response body, fails unless response status is expected status
+func decodeResponse(response *http.Response, status int, result interface{}) error {
+	defer response.Body.Close()
+
+	if response.StatusCode != status {
+		return readStatusError(response)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+func wrapError(op string, reference string, err error) error {
+	if err == nil || err == bloby.ErrClosed {
+		return err
+	}
+
+	return &bloby.StorageError{
+		Op:        op,
+		Reference: reference,
+		Err:       err,
+	}
+}
+
+func (storage *RemoteStorage) newNode(node nodeJSON) *RemoteNode {
+	remoteNode := &RemoteNode{storage: storage}
+	remoteNode.update(node)
+
+	return remoteNode
+}
+
+func (storage *RemoteStorage) newNodes(nodes []nodeJSON) []bloby.Node {
+	result := make([]bloby.Node, 0, len(nodes))
+
+	for _, node := range nodes {
+		result = append(result, storage.newNode(node))
+	}
+
+	return result
+}
+
+// Get node, returns nil node for missing node
+func (storage *RemoteStorage) getNode(ctx context.Context, path string, reference string) (bloby.Node, error) {
+	var node nodeJSON
+
+	err := storage.doJSON(ctx, http.MethodGet, path, nil, http.StatusOK, &node)
+	if statusErr, ok := err.(*StatusError); ok && statusErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, wrapError("get", reference, err)
+	}
+
+	return storage.newNode(node), nil
+}
+
+// Check existence with HEAD request
+func (storage *RemoteStorage) exists(ctx context.Context, path string) (bool, error) {
+	response, err := storage.do(ctx, http.MethodHead, path, "", nil)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, &StatusError{StatusCode: response.StatusCode}
+	}
+}
+
+func (storage *RemoteStorage) GetByReference(reference string) (bloby.Node, error) {
+	return storage.GetByReferenceContext(context.Background(), reference)
+}
+
+func (storage *RemoteStorage) GetByReferenceContext(ctx context.Context, reference string) (bloby.Node, error) {
+	checkRemoteStorageIsNil(storage)
+
+	return storage.getNode(ctx, "/nodes/"+url.PathEscape(reference), reference)
+}
+
+func (storage *RemoteStorage) GetByName(name string) (bloby.Node, error) {
+	return storage.GetByNameContext(context.Background(), name)
+}
+
+func (storage *RemoteStorage) GetByNameContext(ctx context.Context, name string) (bloby.Node, error) {
+	checkRemoteStorageIsNil(storage)
+
+	return storage.getNode(ctx, "/names"+nameQuery(name), "")
+}
+
+func (storage *RemoteStorage) Create(name string, metadata interface{}) (bloby.Node, error) {
+	return storage.CreateContext(context.Background(), name, metadata)
+}
+
+func (storage *RemoteStorage) CreateContext(ctx context.Context, name string, metadata interface{}) (bloby.Node, error) {
+	checkRemoteStorageIsNil(storage)
+
+	var node nodeJSON
+
+	err := storage.doJSON(ctx, http.MethodPost, "/nodes", createRequest{Name: name, Metadata: metadata}, http.StatusCreated, &node)
+	if err != nil {
+		return nil, wrapError("create", "", err)
+	}
+
+	return storage.newNode(node), nil
+}
+
+func (storage *RemoteStorage) Delete(reference string) error {
+	return storage.DeleteContext(context.Background(), reference)
+}
+
+func (storage *RemoteStorage) DeleteContext(ctx context.Context, reference string) error {
+	checkRemoteStorageIsNil(storage)
+
+	err := storage.doJSON(ctx, http.MethodDelete, "/nodes/"+url.PathEscape(reference), nil, http.StatusNoContent, nil)
+
+	return wrapError("delete", reference, err)
+}
+
+func (storage *RemoteStorage) DeleteBy(namePrefix string, namePostfix string) error {
+	return storage.DeleteByContext(context.Background(), namePrefix, namePostfix)
+}
+
+func (storage *RemoteStorage) DeleteByContext(ctx context.Context, namePrefix string, namePostfix string) error {
+	checkRemoteStorageIsNil(storage)
+
+	err := storage.doJSON(ctx, http.MethodDelete, "/nodes"+listQuery(namePrefix, namePostfix), nil, http.StatusNoContent, nil)
+
+	return wrapError("delete", "", err)
+}
+
+func (storage *RemoteStorage) ExistsByName(name string) (bool, error) {
+	return storage.ExistsByNameContext(context.Background(), name)
+}
+
+func (storage *RemoteStorage) ExistsByNameContext(ctx context.Context, name string) (bool, error) {
+	checkRemoteStorageIsNil(storage)
+
+	exists, err := storage.exists(ctx, "/names"+nameQuery(name))
+
+	return exists, wrapError("exists", "", err)
+}
+
+func (storage *RemoteStorage) ExistsByReference(reference string) (bool, error) {
+	return storage.ExistsByReferenceContext(context.Background(), reference)
+}
+
+func (storage *RemoteStorage) ExistsByReferenceContext(ctx context.Context, reference string) (bool, error) {
+	checkRemoteStorageIsNil(storage)
+
+	exists, err := storage.exists(ctx, "/nodes/"+url.PathEscape(reference))
+
+	return exists, wrapError("exists", reference, err)
+}
+
+func (storage *RemoteStorage) ListBy(namePrefix string, namePostfix string) ([]bloby.Node, error) {
+	return storage.ListByContext(context.Background(), namePrefix, namePostfix)
+}
+
+func (storage *RemoteStorage) ListByContext(ctx context.Context, namePrefix string, namePostfix string) ([]bloby.Node, error) {
+	checkRemoteStorageIsNil(storage)
+
+	var list listResponse
+
+	err := storage.doJSON(ctx, http.MethodGet, "/nodes"+listQuery(namePrefix, namePostfix), nil, http.StatusOK, &list)
+	if err != nil {
+		return nil, wrapError("list", "", err)
+	}
+
+	return storage.newNodes(list.Nodes), nil
+}
+
+func (storage *RemoteStorage) ListReferences(namePrefix string, namePostfix string) ([]string, error) {
+	return storage.ListReferencesContext(context.Background(), namePrefix, namePostfix)
+}
+
+func (storage *RemoteStorage) ListReferencesContext(ctx context.Context, namePrefix string, namePostfix string) ([]string, error) {
+	checkRemoteStorageIsNil(storage)
+
+	var references referencesResponse
+
+	err := storage.doJSON(ctx, http.MethodGet, "/references"+listQuery(namePrefix, namePostfix), nil, http.StatusOK, &references)
+	if err != nil {
+		return nil, wrapError("list", "", err)
+	}
+
+	return references.References, nil
+}
+
+// Node of RemoteStorage, attributes are loaded with node and updated by changes made through node
+type RemoteNode struct {
+	storage     *RemoteStorage
+	reference   string
+	name        string
+	metadata    interface{}
+	size        int64
+	createdAt   time.Time
+	updatedAt   time.Time
+	contentType string
+}
+
+func (node *RemoteNode) update(source nodeJSON) {
+	node.reference = source.Reference
+	node.name = source.Name
+	node.metadata = source.Metadata
+
+	if source.Size != nil {
+		node.size = *source.Size
+	}
+
+	if source.CreatedAt != nil {
+		node.createdAt = *source.CreatedAt
+	}
+
+	if source.UpdatedAt != nil {
+		node.updatedAt = *source.UpdatedAt
+	}
+
+	if source.ContentType != nil {
+		node.contentType = *source.ContentType
+	}
+}
+
+func (node *RemoteNode) GetReference() string {
+	checkRemoteNodeIsNil(node)
+
+	return node.reference
+}
+
+func (node *RemoteNode) GetName() string {
+	checkRemoteNodeIsNil(node)
+
+	return node.name
+}
+
+func (node *RemoteNode) GetMetadata() interface{} {
+	checkRemoteNodeIsNil(node)
+
+	return node.metadata
+}
+
+func (node *RemoteNode) GetSize() int64 {
+	checkRemoteNodeIsNil(node)
+
+	return node.size
+}
+
+func (node *RemoteNode) GetCreatedAt() time.Time {
+	checkRemoteNodeIsNil(node)
+
+	return node.createdAt
+}
+
+func (node *RemoteNode) GetUpdatedAt() time.Time {
+	checkRemoteNodeIsNil(node)
+
+	return node.updatedAt
+}
+
+func (node *RemoteNode) GetContentType() string {
+	checkRemoteNodeIsNil(node)
+
+	return node.contentType
+}
+
+// Send node update and apply returned attributes
+func (node *RemoteNode) patch(ctx context.Context, op string, request interface{}) error {
+	var result nodeJSON
+
+	err := node.storage.doJSON(ctx, http.MethodPatch, "/nodes/"+url.PathEscape(node.reference), request, http.StatusOK, &result)
+	if err != nil {
+		return wrapError(op, node.reference, err)
+	}
+
+	node.update(result)
+
+	return nil
+}
+
+func (node *RemoteNode) SetName(name string) error {
+	return node.SetNameContext(context.Background(), name)
+}
+
+func (node *RemoteNode) SetNameContext(ctx context.Context, name string) error {
+	checkRemoteNodeIsNil(node)
+
+	return node.patch(ctx, "rename", map[string]interface{}{"name": name})
+}
+
+func (node *RemoteNode) SetMetadata(metadata interface{}) error {
+	return node.SetMetadataContext(context.Background(), metadata)
+}
+
+func (node *RemoteNode) SetMetadataContext(ctx context.Context, metadata interface{}) error {
+	checkRemoteNodeIsNil(node)
+
+	return node.patch(ctx, "set metadata", map[string]interface{}{"metadata": metadata})
+}
+
+func (node *RemoteNode) SetContentType(contentType string) error {
+	checkRemoteNodeIsNil(node)
+
+	return node.patch(context.Background(), "set content type", map[string]interface{}{"content_type": contentType})
+}
+
+func (node *RemoteNode) contentPath() string {
+	return "/nodes/" + url.PathEscape(node.reference) + "/content"
+}
+
+// Get reader streaming content from server, reader must be closed
+func (node *RemoteNode) GetReader() (io.Reader, error) {
+	checkRemoteNodeIsNil(node)
+
+	reader, err := node.GetReaderContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// Get reader streaming content from server, request is cancelled with ctx
+func (node *RemoteNode) GetReaderContext(ctx context.Context) (io.ReadCloser, error) {
+	checkRemoteNodeIsNil(node)
+
+	response, err := node.storage.do(ctx, http.MethodGet, node.contentPath(), "", nil)
+	if err != nil {
+		return nil, wrapError("read", node.reference, err)
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		defer response.Body.Close()
+		return nil, wrapError("read", node.reference, fmt.Errorf("%w: %w", readStatusError(response), os.ErrNotExist))
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, wrapError("read", node.reference, readStatusError(response))
+	}
+
+	return response.Body, nil
+}
+
+func (node *RemoteNode) GetWriter() (io.Writer, error) {
+	checkRemoteNodeIsNil(node)
+
+	return node.openWriter()
+}
+
+func (node *RemoteNode) GetWriteCloser() (io.WriteCloser, error) {
+	checkRemoteNodeIsNil(node)
+
+	return node.openWriter()
+}
+
+func (node *RemoteNode) openWriter() (io.WriteCloser, error) {
+	err := node.storage.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	return newRemoteWriter(node), nil
+}
+
+// Writer streaming content to server, content replaces node content on Close
+type remoteWriter struct {
+	node   *RemoteNode
+	pipe   *io.PipeWriter
+	cancel context.CancelFunc
+	done   chan struct{}
+	// Upload result, available after done is closed
+	result nodeJSON
+	err    error
+	closed bool
+}
+
+func newRemoteWriter(node *RemoteNode) *remoteWriter {
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, pipe := io.Pipe()
+
+	writer := &remoteWriter{
+		node:   node,
+		pipe:   pipe,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(writer.done)
+
+		response, err := node.storage.do(ctx, http.MethodPut, node.contentPath(), "", reader)
+		if err == nil {
+			err = decodeResponse(response, http.StatusOK, &writer.result)
+		}
+		writer.err = err
+
+		// Unblock writes if server responded before whole content was sent
+		if writer.err != nil {
+			reader.CloseWithError(writer.err)
+		} else {
+			reader.CloseWithError(io.ErrClosedPipe)
+		}
+	}()
+
+	return writer
+}
+
+func (writer *remoteWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, os.ErrClosed
+	}
+
+	n, err := writer.pipe.Write(p)
+	if err != nil {
+		return n, wrapError("write", writer.node.reference, err)
+	}
+
+	return n, nil
+}
+
+func (writer *remoteWriter) Close() error {
+	if writer.closed {
+		return os.ErrClosed
+	}
+
+	writer.closed = true
+	writer.pipe.Close()
+	<-writer.done
+	writer.cancel()
+
+	if writer.err != nil {
+		return wrapError("write", writer.node.reference, writer.err)
+	}
+
+	writer.node.update(writer.result)
+
+	return nil
+}
+
+// Cancel upload, node content is left unchanged
+func (writer *remoteWriter) Abort() error {
+	if writer.closed {
+		return os.ErrClosed
+	}
+
+	writer.closed = true
+	writer.cancel()
+	writer.pipe.CloseWithError(context.Canceled)
+	<-writer.done
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrate16/bloby"
+	"github.com/bitrate16/bloby/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Serve opened storage and return closed client
+func newTestRemoteStorage(t *testing.T, storage bloby.Storage) *RemoteStorage {
+	require.NoError(t, storage.Open())
+
+	server := httptest.NewServer(NewHandler(storage))
+
+	t.Cleanup(func() {
+		server.Close()
+		storage.Close()
+	})
+
+	return NewRemoteStorageWithClient(server.URL, server.Client())
+}
+
+func TestRemoteMemoryStorageConformance(t *testing.T) {
+	storagetest.RunConformance(t, func() bloby.Storage {
+		return newTestRemoteStorage(t, bloby.NewMemoryStorage())
+	})
+}
+
+func TestRemoteFileStorageConformance(t *testing.T) {
+	testDirName := t.TempDir()
+	count := 0
+
+	storagetest.RunConformance(t, func() bloby.Storage {
+		count++
+		return newTestRemoteStorage(t, bloby.NewFileStorage(filepath.Join(testDirName, fmt.Sprint(count))))
+	})
+}
+
+func TestRemoteStorage(t *testing.T) {
+	testDirName := "test-file-storage-TestRemoteStorage"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	local := bloby.NewFileStorageWithOptions(testDirName, bloby.FileStorageOptions{UniqueNames: true})
+	storage := newTestRemoteStorage(t, local)
+	require.NoError(t, storage.Open())
+
+	node, err := storage.Create("cats", map[string]interface{}{"color": "gray"})
+	require.NoError(t, err)
+
+	// Errors of server storage are preserved
+	_, err = storage.Create("cats", nil)
+	assert.ErrorIs(t, err, bloby.ErrNameConflict)
+
+	err = storage.Delete("missing")
+	assert.ErrorIs(t, err, bloby.ErrNotFound)
+
+	// Content larger than pipe and transport buffers is streamed
+	content := bytes.Repeat([]byte("meow "), 1<<20)
+
+	writer, err := node.(bloby.CloseWritable).GetWriteCloser()
+	require.NoError(t, err)
+
+	for offset := 0; offset < len(content); offset += 4096 {
+		_, err = writer.Write(content[offset:min(offset+4096, len(content))])
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, writer.Close())
+	assert.Equal(t, int64(len(content)), node.(bloby.StatNode).GetSize())
+
+	reader, err := node.(bloby.Readable).GetReader()
+	require.NoError(t, err)
+
+	read, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, content, read)
+	reader.(io.Closer).Close()
+
+	// Aborted upload leaves content unchanged
+	writer, err = node.(bloby.CloseWritable).GetWriteCloser()
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte("woof"))
+	require.NoError(t, err)
+	require.NoError(t, writer.(bloby.Abortable).Abort())
+
+	localNode, err := local.GetByReference(node.GetReference())
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), localNode.(bloby.StatNode).GetSize())
+
+	// Upload to deleted node fails
+	require.NoError(t, storage.Delete(node.GetReference()))
+
+	writer, err = node.(bloby.CloseWritable).GetWriteCloser()
+	require.NoError(t, err)
+
+	writer.Write([]byte("woof"))
+	err = writer.Close()
+	assert.ErrorIs(t, err, bloby.ErrNotFound)
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+
+	// Names cleaned from URL paths
+	for _, name := range []string{".", "..", "cats/../dogs", "/", "?name=cats"} {
+		created, err := storage.Create(name, nil)
+		require.NoError(t, err)
+
+		node, err = storage.GetByName(name)
+		require.NoError(t, err)
+		require.NotNil(t, node)
+		assert.Equal(t, created.GetReference(), node.GetReference())
+
+		exists, err := storage.ExistsByName(name)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	}
+
+	// Content type
+	node, err = storage.Create("dogs", nil)
+	require.NoError(t, err)
+	require.NoError(t, node.(bloby.ContentTypeMutable).SetContentType("text/plain"))
+
+	node, err = storage.GetByName("dogs")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", node.(bloby.StatNode).GetContentType())
+
+	// Closed client
+	require.NoError(t, storage.Close())
+
+	_, err = node.(bloby.Readable).GetReader()
+	assert.ErrorIs(t, err, bloby.ErrClosed)
+}
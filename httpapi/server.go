@@ -0,0 +1,629 @@
+// Package httpapi exposes bloby.Storage over HTTP.
+//
+// Endpoints:
+//
+//	GET    /nodes?prefix=&postfix=            list nodes, limit, cursor, order and desc are supported for bloby.PageListable storages
+//	POST   /nodes                             create node from {"name": ..., "metadata": ...}
+//	DELETE /nodes?prefix=&postfix=            delete nodes by name
+//	GET    /references?prefix=&postfix=       list references
+//	GET    /names?name=                       get node by name, HEAD checks existence
+//	GET    /nodes/{reference}                 get node by reference, HEAD checks existence
+//	PATCH  /nodes/{reference}                 rename node or update metadata from {"name": ..., "metadata": ...}
+//	DELETE /nodes/{reference}                 delete node
+//	GET    /nodes/{reference}/content         download content with Range and ETag support
+//	PUT    /nodes/{reference}/content         upload content
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bitrate16/bloby"
+)
+
+// Node representation, stat attributes are present for bloby.StatNode nodes
+type nodeJSON struct {
+	Reference   string      `json:"reference"`
+	Name        string      `json:"name"`
+	Metadata    interface{} `json:"metadata"`
+	Size        *int64      `json:"size,omitempty"`
+	CreatedAt   *time.Time  `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time  `json:"updated_at,omitempty"`
+	ContentType *string     `json:"content_type,omitempty"`
+}
+
+type createRequest struct {
+	Name     string      `json:"name"`
+	Metadata interface{} `json:"metadata"`
+}
+
+// Absent fields are left unchanged, null metadata clears metadata
+type updateRequest struct {
+	Name        *string         `json:"name"`
+	Metadata    json.RawMessage `json:"metadata"`
+	ContentType *string         `json:"content_type"`
+}
+
+type listResponse struct {
+	Nodes  []nodeJSON `json:"nodes"`
+	Cursor string     `json:"cursor,omitempty"`
+}
+
+type referencesResponse struct {
+	References []string `json:"references"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+var listOrders = map[string]bloby.ListOrder{
+	"name":       bloby.OrderByName,
+	"reference":  bloby.OrderByReference,
+	"size":       bloby.OrderBySize,
+	"created_at": bloby.OrderByCreatedAt,
+	"updated_at": bloby.OrderByUpdatedAt,
+}
+
+// HTTP handler serving storage, storage must be open while handler is used
+type Handler struct {
+	storage bloby.Storage
+	mux     *http.ServeMux
+}
+
+func NewHandler(storage bloby.Storage) *Handler {
+	if storage == nil {
+		panic("storage is nil")
+	}
+
+	handler := &Handler{
+		storage: storage,
+		mux:     http.NewServeMux(),
+	}
+
+	handler.mux.HandleFunc("GET /nodes", handler.list)
+	handler.mux.HandleFunc("POST /nodes", handler.create)
+	handler.mux.HandleFunc("DELETE /nodes", handler.deleteBy)
+	handler.mux.HandleFunc("GET /references", handler.listReferences)
+	handler.mux.HandleFunc("GET /names", handler.getByName)
+	handler.mux.HandleFunc("GET /nodes/{reference}", handler.getByReference)
+	handler.mux.HandleFunc("PATCH /nodes/{reference}", handler.update)
+	handler.mux.HandleFunc("DELETE /nodes/{reference}", handler.delete)
+	handler.mux.HandleFunc("GET /nodes/{reference}/content", handler.download)
+	handler.mux.HandleFunc("PUT /nodes/{reference}/content", handler.upload)
+
+	return handler
+}
+
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// Map storage errors to HTTP status
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, bloby.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, bloby.ErrNameConflict):
+		return http.StatusConflict
+	case errors.Is(err, bloby.ErrClosed), errors.Is(err, bloby.ErrLocked):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errors.ErrUnsupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeStorageError(w http.ResponseWriter, err error) {
+	writeError(w, errorStatus(err), err)
+}
+
+func toNodeJSON(node bloby.Node) nodeJSON {
+	result := nodeJSON{
+		Reference: node.GetReference(),
+		Name:      node.GetName(),
+		Metadata:  node.GetMetadata(),
+	}
+
+	if stat, ok := node.(bloby.StatNode); ok {
+		size := stat.GetSize()
+		createdAt := stat.GetCreatedAt()
+		updatedAt := stat.GetUpdatedAt()
+		contentType := stat.GetContentType()
+
+		result.Size = &size
+		result.CreatedAt = &createdAt
+		result.UpdatedAt = &updatedAt
+		result.ContentType = &contentType
+	}
+
+	return result
+}
+
+func toNodesJSON(nodes []bloby.Node) []nodeJSON {
+	result := make([]nodeJSON, 0, len(nodes))
+
+	for _, node := range nodes {
+		result = append(result, toNodeJSON(node))
+	}
+
+	return result
+}
+
+func (handler *Handler) getNode(ctx context.Context, reference string) (bloby.Node, error) {
+	var node bloby.Node
+	var err error
+
+	if storage, ok := handler.storage.(bloby.StorageContext); ok {
+		node, err = storage.GetByReferenceContext(ctx, reference)
+	} else {
+		node, err = handler.storage.GetByReference(reference)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if node == nil {
+		return nil, &bloby.StorageError{Op: "get", Reference: reference, Err: bloby.ErrNotFound}
+	}
+
+	return node, nil
+}
+
+// Parse list options from query, reports whether paging options are present
+func parseListOptions(r *http.Request) (bloby.ListOptions, bool, error) {
+	query := r.URL.Query()
+
+	options := bloby.ListOptions{
+		NamePrefix:  query.Get("prefix"),
+		NamePostfix: query.Get("postfix"),
+		Cursor:      query.Get("cursor"),
+		ContentType: query.Get("content_type"),
+	}
+
+	paged := options.Cursor != "" || options.ContentType != ""
+
+	for _, param := range []struct {
+		name  string
+		value *int64
+	}{
+		{"min_size", &options.MinSize},
+		{"max_size", &options.MaxSize},
+	} {
+		if value := query.Get(param.name); value != "" {
+			number, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return options, false, errors.New("invalid " + param.name)
+			}
+
+			*param.value = number
+			paged = true
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		number, err := strconv.Atoi(limit)
+		if err != nil || number < 0 {
+			return options, false, errors.New("invalid limit")
+		}
+
+		options.Limit = number
+		paged = true
+	}
+
+	if order := query.Get("order"); order != "" {
+		listOrder, ok := listOrders[order]
+		if !ok {
+			return options, false, errors.New("invalid order")
+		}
+
+		options.Order = listOrder
+		paged = true
+	}
+
+	if desc := query.Get("desc"); desc != "" {
+		descending, err := strconv.ParseBool(desc)
+		if err != nil {
+			return options, false, errors.New("invalid desc")
+		}
+
+		options.Descending = descending
+		paged = true
+	}
+
+	return options, paged, nil
+}
+
+func (handler *Handler) list(w http.ResponseWriter, r *http.Request) {
+	options, paged, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if pageListable, ok := handler.storage.(bloby.PageListable); ok {
+		page, err := pageListable.ListPageContext(r.Context(), options)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, listResponse{Nodes: toNodesJSON(page.Nodes), Cursor: page.Cursor})
+		return
+	}
+
+	if paged {
+		writeError(w, http.StatusNotImplemented, errors.New("storage does not support paging"))
+		return
+	}
+
+	var nodes []bloby.Node
+
+	if storage, ok := handler.storage.(bloby.StorageContext); ok {
+		nodes, err = storage.ListByContext(r.Context(), options.NamePrefix, options.NamePostfix)
+	} else {
+		nodes, err = handler.storage.ListBy(options.NamePrefix, options.NamePostfix)
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{Nodes: toNodesJSON(nodes)})
+}
+
+func (handler *Handler) listReferences(w http.ResponseWriter, r *http.Request) {
+	namePrefix := r.URL.Query().Get("prefix")
+	namePostfix := r.URL.Query().Get("postfix")
+
+	var references []string
+	var err error
+
+	if storage, ok := handler.storage.(bloby.StorageContext); ok {
+		references, err = storage.ListReferencesContext(r.Context(), namePrefix, namePostfix)
+	} else {
+		references, err = handler.storage.ListReferences(namePrefix, namePostfix)
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, referencesResponse{References: references})
+}
+
+func (handler *Handler) create(w http.ResponseWriter, r *http.Request) {
+	var request createRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var node bloby.Node
+
+	if storage, ok := handler.storage.(bloby.StorageContext); ok {
+		node, err = storage.CreateContext(r.Context(), request.Name, request.Metadata)
+	} else {
+		node, err = handler.storage.Create(request.Name, request.Metadata)
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toNodeJSON(node))
+}
+
+func (handler *Handler) deleteBy(w http.ResponseWriter, r *http.Request) {
+	namePrefix := r.URL.Query().Get("prefix")
+	namePostfix := r.URL.Query().Get("postfix")
+
+	var err error
+
+	if storage, ok := handler.storage.(bloby.StorageContext); ok {
+		err = storage.DeleteByContext(r.Context(), namePrefix, namePostfix)
+	} else {
+		err = handler.storage.DeleteBy(namePrefix, namePostfix)
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Name is passed in query, names like "." and ".." are cleaned from request path
+func (handler *Handler) getByName(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	var node bloby.Node
+	var err error
+
+	if storage, ok := handler.storage.(bloby.StorageContext); ok {
+		node, err = storage.GetByNameContext(r.Context(), name)
+	} else {
+		node, err = handler.storage.GetByName(name)
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	if node == nil {
+		writeError(w, http.StatusNotFound, bloby.ErrNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toNodeJSON(node))
+}
+
+func (handler *Handler) getByReference(w http.ResponseWriter, r *http.Request) {
+	node, err := handler.getNode(r.Context(), r.PathValue("reference"))
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toNodeJSON(node))
+}
+
+func (handler *Handler) update(w http.ResponseWriter, r *http.Request) {
+	var request updateRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var metadata interface{}
+
+	if request.Metadata != nil {
+		err = json.Unmarshal(request.Metadata, &metadata)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	node, err := handler.getNode(r.Context(), r.PathValue("reference"))
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	if request.Name != nil || request.Metadata != nil {
+		if _, ok := node.(bloby.Mutable); !ok {
+			writeError(w, http.StatusNotImplemented, errors.New("node is not mutable"))
+			return
+		}
+	}
+
+	if request.ContentType != nil {
+		if _, ok := node.(bloby.ContentTypeMutable); !ok {
+			writeError(w, http.StatusNotImplemented, errors.New("node content type is not mutable"))
+			return
+		}
+	}
+
+	if request.Name != nil {
+		if mutable, ok := node.(bloby.MutableContext); ok {
+			err = mutable.SetNameContext(r.Context(), *request.Name)
+		} else {
+			err = node.(bloby.Mutable).SetName(*request.Name)
+		}
+
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+
+	if request.Metadata != nil {
+		if mutable, ok := node.(bloby.MutableContext); ok {
+			err = mutable.SetMetadataContext(r.Context(), metadata)
+		} else {
+			err = node.(bloby.Mutable).SetMetadata(metadata)
+		}
+
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+
+	if request.ContentType != nil {
+		err = node.(bloby.ContentTypeMutable).SetContentType(*request.ContentType)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, toNodeJSON(node))
+}
+
+func (handler *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	reference := r.PathValue("reference")
+
+	var err error
+
+	if storage, ok := handler.storage.(bloby.StorageContext); ok {
+		err = storage.DeleteContext(r.Context(), reference)
+	} else {
+		err = handler.storage.Delete(reference)
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (handler *Handler) download(w http.ResponseWriter, r *http.Request) {
+	node, err := handler.getNode(r.Context(), r.PathValue("reference"))
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	contentType := "application/octet-stream"
+	var modTime time.Time
+
+	if stat, ok := node.(bloby.StatNode); ok {
+		if stat.GetContentType() != "" {
+			contentType = stat.GetContentType()
+		}
+
+		modTime = stat.GetUpdatedAt()
+	}
+
+	// Checksum and content are taken together, so ETag always matches served content
+	if checksumSeekReadable, ok := node.(bloby.ChecksumSeekReadable); ok {
+		reader, checksum, err := checksumSeekReadable.GetSeekReaderWithChecksum()
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		defer reader.Close()
+
+		if checksum.SHA256 != "" {
+			w.Header().Set("ETag", `"`+checksum.SHA256+`"`)
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		http.ServeContent(w, r, "", modTime, reader)
+		return
+	}
+
+	if verifiable, ok := node.(bloby.Verifiable); ok {
+		checksum, err := verifiable.GetChecksum()
+		if err == nil {
+			w.Header().Set("ETag", `"`+checksum.SHA256+`"`)
+		} else if !errors.Is(err, bloby.ErrNoChecksum) {
+			writeStorageError(w, err)
+			return
+		}
+	}
+
+	if seekReadable, ok := node.(bloby.SeekReadable); ok {
+		reader, err := seekReadable.GetSeekReader()
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		defer reader.Close()
+
+		w.Header().Set("Content-Type", contentType)
+		http.ServeContent(w, r, "", modTime, reader)
+		return
+	}
+
+	readable, ok := node.(bloby.Readable)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("node is not readable"))
+		return
+	}
+
+	reader, err := readable.GetReader()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	io.Copy(w, reader)
+}
+
+func (handler *Handler) upload(w http.ResponseWriter, r *http.Request) {
+	node, err := handler.getNode(r.Context(), r.PathValue("reference"))
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	var writer io.Writer
+
+	if closeWritable, ok := node.(bloby.CloseWritable); ok {
+		writer, err = closeWritable.GetWriteCloser()
+	} else if writable, ok := node.(bloby.Writable); ok {
+		writer, err = writable.GetWriter()
+	} else {
+		writeError(w, http.StatusNotImplemented, errors.New("node is not writable"))
+		return
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	// Interrupted upload must not replace content, writer that can not be aborted is left unclosed, since Close commits it
+	abort := func() {
+		if abortable, ok := writer.(bloby.Abortable); ok {
+			abortable.Abort()
+		}
+	}
+
+	_, err = io.Copy(writer, r.Body)
+	if err != nil {
+		abort()
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Content type is applied before commit, so committed upload is not reported as failed
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if contentTypeMutable, ok := node.(bloby.ContentTypeMutable); ok {
+			err = contentTypeMutable.SetContentType(contentType)
+			if err != nil {
+				abort()
+				writeStorageError(w, err)
+				return
+			}
+		}
+	}
+
+	if closer, ok := writer.(io.Closer); ok {
+		err = closer.Close()
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, toNodeJSON(node))
+}
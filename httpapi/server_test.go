@@ -0,0 +1,214 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bitrate16/bloby"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	testDirName := "test-file-storage-TestHandler"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := bloby.NewFileStorage(testDirName)
+	require.NoError(t, storage.Open())
+	defer storage.Close()
+
+	server := httptest.NewServer(NewHandler(storage))
+	defer server.Close()
+
+	do := func(method string, path string, contentType string, body string, header http.Header) (*http.Response, string) {
+		var bodyReader io.Reader
+		if body != "" {
+			bodyReader = strings.NewReader(body)
+		}
+
+		request, err := http.NewRequest(method, server.URL+path, bodyReader)
+		require.NoError(t, err)
+
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+
+		for key, values := range header {
+			request.Header[key] = values
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		content, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+
+		return response, string(content)
+	}
+
+	decodeNode := func(body string) nodeJSON {
+		var node nodeJSON
+		require.NoError(t, json.Unmarshal([]byte(body), &node))
+		return node
+	}
+
+	// Create
+	response, body := do("POST", "/nodes", "application/json", `{"name": "cats/tom", "metadata": {"color": "gray"}}`, nil)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+
+	created := decodeNode(body)
+	assert.Equal(t, "cats/tom", created.Name)
+	assert.Equal(t, map[string]interface{}{"color": "gray"}, created.Metadata)
+	assert.Equal(t, int64(0), *created.Size)
+
+	response, _ = do("POST", "/nodes", "application/json", `not json`, nil)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	// Get by reference and name
+	response, body = do("GET", "/nodes/"+created.Reference, "", "", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, created.Reference, decodeNode(body).Reference)
+
+	response, body = do("GET", "/names?name="+url.QueryEscape("cats/tom"), "", "", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, created.Reference, decodeNode(body).Reference)
+
+	response, _ = do("HEAD", "/names?name=dogs", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response, _ = do("GET", "/nodes/missing", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// Download without content
+	response, _ = do("GET", "/nodes/"+created.Reference+"/content", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// Upload and download
+	response, body = do("PUT", "/nodes/"+created.Reference+"/content", "text/plain", "meow meow", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int64(9), *decodeNode(body).Size)
+	assert.Equal(t, "text/plain", *decodeNode(body).ContentType)
+
+	response, body = do("GET", "/nodes/"+created.Reference+"/content", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "meow meow", body)
+	assert.Equal(t, "text/plain", response.Header.Get("Content-Type"))
+
+	etag := response.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	response, body = do("GET", "/nodes/"+created.Reference+"/content", "", "", http.Header{"Range": {"bytes=5-"}})
+	assert.Equal(t, http.StatusPartialContent, response.StatusCode)
+	assert.Equal(t, "meow", body)
+
+	response, _ = do("GET", "/nodes/"+created.Reference+"/content", "", "", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+
+	// Rename and update metadata
+	response, body = do("PATCH", "/nodes/"+created.Reference, "application/json", `{"name": "cats/tommy"}`, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "cats/tommy", decodeNode(body).Name)
+	assert.Equal(t, map[string]interface{}{"color": "gray"}, decodeNode(body).Metadata)
+
+	response, body = do("PATCH", "/nodes/"+created.Reference, "application/json", `{"metadata": null}`, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Nil(t, decodeNode(body).Metadata)
+
+	response, _ = do("PATCH", "/nodes/missing", "application/json", `{"name": "dogs"}`, nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// List
+	for _, name := range []string{"cats/kitty", "dogs/rex"} {
+		response, _ = do("POST", "/nodes", "application/json", `{"name": "`+name+`"}`, nil)
+		require.Equal(t, http.StatusCreated, response.StatusCode)
+	}
+
+	var list listResponse
+
+	response, body = do("GET", "/nodes?prefix=cats/&order=name", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &list))
+	assert.Len(t, list.Nodes, 2)
+	assert.Equal(t, "cats/kitty", list.Nodes[0].Name)
+
+	response, body = do("GET", "/nodes?order=name&limit=2", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &list))
+	assert.Len(t, list.Nodes, 2)
+	assert.NotEmpty(t, list.Cursor)
+
+	response, body = do("GET", "/nodes?order=name&limit=2&cursor="+list.Cursor, "", "", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &list))
+	assert.Len(t, list.Nodes, 1)
+	assert.Equal(t, "dogs/rex", list.Nodes[0].Name)
+
+	response, _ = do("GET", "/nodes?order=color", "", "", nil)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	var references referencesResponse
+
+	response, body = do("GET", "/references?postfix=rex", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &references))
+	assert.Len(t, references.References, 1)
+
+	// Delete
+	response, _ = do("DELETE", "/nodes/"+created.Reference, "", "", nil)
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+	response, _ = do("DELETE", "/nodes/"+created.Reference, "", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response, _ = do("DELETE", "/nodes?prefix=dogs/", "", "", nil)
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+	names, err := storage.ListReferences("", "")
+	assert.NoError(t, err)
+	assert.Len(t, names, 1)
+
+	// Closed storage
+	require.NoError(t, storage.Close())
+
+	response, _ = do("GET", "/nodes", "", "", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+}
+
+func TestHandlerMemoryStorage(t *testing.T) {
+	storage := bloby.NewMemoryStorage()
+	require.NoError(t, storage.Open())
+	defer storage.Close()
+
+	server := httptest.NewServer(NewHandler(storage))
+	defer server.Close()
+
+	node, err := storage.Create("cats", nil)
+	require.NoError(t, err)
+
+	request, err := http.NewRequest("PUT", server.URL+"/nodes/"+node.GetReference()+"/content", strings.NewReader("meow"))
+	require.NoError(t, err)
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, err = http.Get(server.URL + "/nodes/" + node.GetReference() + "/content")
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", string(content))
+	assert.Equal(t, "application/octet-stream", response.Header.Get("Content-Type"))
+}
@@ -0,0 +1,243 @@
+package bloby
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type ListOrder int
+
+const (
+	OrderByName ListOrder = iota
+	OrderByReference
+	// Orders by system attributes, supported by storages with StatNode nodes
+	OrderBySize
+	OrderByCreatedAt
+	OrderByUpdatedAt
+)
+
+// Page size used by Walk when ListOptions.Limit is not set
+const DefaultWalkLimit = 1000
+
+type ListOptions struct {
+	NamePrefix  string
+	NamePostfix string
+	Order       ListOrder
+	// Reverse order, including reference tie breaker
+	Descending bool
+	// Metadata conditions, supported by storages implementing Queryable
+	Where []Condition
+	// Content type filter, empty string matches any content type
+	ContentType string
+	// Content size filter in bytes, MaxSize <= 0 means no upper limit
+	MinSize int64
+	MaxSize int64
+	// Time filters, Since bounds are inclusive, Before bounds are exclusive, zero values disable filter
+	CreatedSince  time.Time
+	CreatedBefore time.Time
+	UpdatedSince  time.Time
+	UpdatedBefore time.Time
+	// Maximal amount of nodes in page, values <= 0 mean no limit
+	Limit int
+	// Cursor returned with previous page, empty string starts from the beginning
+	Cursor string
+}
+
+type Page struct {
+	Nodes []Node
+	// Cursor for next page, empty string if there are no more nodes
+	Cursor string
+}
+
+// Storage with paginated listing.
+//
+// Nodes are ordered by ListOptions.Order with reference as tie breaker, so pages are stable while nodes are created or deleted.
+type PageListable interface {
+	ListPage(options ListOptions) (Page, error)
+	ListPageContext(ctx context.Context, options ListOptions) (Page, error)
+	// Stream matching nodes page by page into callback, returned error stops iteration and is returned from Walk
+	Walk(options ListOptions, callback func(node Node) error) error
+	WalkContext(ctx context.Context, options ListOptions, callback func(node Node) error) error
+}
+
+type listCursor struct {
+	Order      ListOrder `json:"o"`
+	Descending bool      `json:"d,omitempty"`
+	// Sort key of last node, string for OrderByName and number for orders by system attributes
+	Key       string `json:"k,omitempty"`
+	Number    int64  `json:"n,omitempty"`
+	Reference string `json:"r"`
+}
+
+// Get numeric sort key of node for orders by system attributes
+func nodeSortNumber(order ListOrder, node Node) int64 {
+	stat, ok := node.(StatNode)
+	if !ok {
+		return 0
+	}
+
+	switch order {
+	case OrderBySize:
+		return stat.GetSize()
+	case OrderByCreatedAt:
+		return timeToUnixNano(stat.GetCreatedAt())
+	case OrderByUpdatedAt:
+		return timeToUnixNano(stat.GetUpdatedAt())
+	default:
+		return 0
+	}
+}
+
+// Get cursor pointing at node
+func nodeCursor(options ListOptions, node Node) *listCursor {
+	cursor := &listCursor{
+		Order:      options.Order,
+		Descending: options.Descending,
+		Reference:  node.GetReference(),
+	}
+
+	switch options.Order {
+	case OrderByName:
+		cursor.Key = node.GetName()
+	case OrderBySize, OrderByCreatedAt, OrderByUpdatedAt:
+		cursor.Number = nodeSortNumber(options.Order, node)
+	}
+
+	return cursor
+}
+
+// Check whether node at cursor a is listed before node at cursor b
+func (a *listCursor) before(b *listCursor) bool {
+	if a.Descending {
+		a, b = b, a
+	}
+
+	switch a.Order {
+	case OrderByName:
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+	case OrderBySize, OrderByCreatedAt, OrderByUpdatedAt:
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+	}
+
+	return a.Reference < b.Reference
+}
+
+func encodeCursor(options ListOptions, node Node) string {
+	cursorBytes, err := json.Marshal(nodeCursor(options, node))
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(cursorBytes)
+}
+
+// Decode cursor, returns nil for empty cursor
+func decodeCursor(options ListOptions, cursorString string) (*listCursor, error) {
+	if cursorString == "" {
+		return nil, nil
+	}
+
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(cursorString)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	var cursor listCursor
+
+	err = json.Unmarshal(cursorBytes, &cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	if cursor.Order != options.Order || cursor.Descending != options.Descending {
+		return nil, errors.New("cursor does not match order")
+	}
+
+	return &cursor, nil
+}
+
+func checkListOrder(order ListOrder) error {
+	switch order {
+	case OrderByName, OrderByReference, OrderBySize, OrderByCreatedAt, OrderByUpdatedAt:
+		return nil
+	default:
+		return errors.New("unknown list order")
+	}
+}
+
+// Build page from up to limit + 1 queried nodes
+func makePage(options ListOptions, nodes []Node) Page {
+	if options.Limit <= 0 || len(nodes) <= options.Limit {
+		return Page{Nodes: nodes}
+	}
+
+	nodes = nodes[:options.Limit]
+
+	return Page{
+		Nodes:  nodes,
+		Cursor: encodeCursor(options, nodes[len(nodes)-1]),
+	}
+}
+
+// Check system attributes against list filters
+func matchListFilters(options ListOptions, size int64, createdAt time.Time, updatedAt time.Time, contentType string) bool {
+	if options.ContentType != "" && contentType != options.ContentType {
+		return false
+	}
+
+	if size < options.MinSize || (options.MaxSize > 0 && size > options.MaxSize) {
+		return false
+	}
+
+	if !options.CreatedSince.IsZero() && createdAt.Before(options.CreatedSince) {
+		return false
+	}
+
+	if !options.CreatedBefore.IsZero() && !createdAt.Before(options.CreatedBefore) {
+		return false
+	}
+
+	if !options.UpdatedSince.IsZero() && updatedAt.Before(options.UpdatedSince) {
+		return false
+	}
+
+	if !options.UpdatedBefore.IsZero() && !updatedAt.Before(options.UpdatedBefore) {
+		return false
+	}
+
+	return true
+}
+
+// Iterate pages using listPage, storage lock is not held while callback is running
+func walkPages(ctx context.Context, options ListOptions, listPage func(ctx context.Context, options ListOptions) (Page, error), callback func(node Node) error) error {
+	if options.Limit <= 0 {
+		options.Limit = DefaultWalkLimit
+	}
+
+	for {
+		page, err := listPage(ctx, options)
+		if err != nil {
+			return err
+		}
+
+		for _, node := range page.Nodes {
+			err = callback(node)
+			if err != nil {
+				return err
+			}
+		}
+
+		if page.Cursor == "" {
+			return nil
+		}
+
+		options.Cursor = page.Cursor
+	}
+}
@@ -0,0 +1,91 @@
+package bloby
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	node := &MemoryNode{
+		reference: "0123456789abcdef",
+		name:      "cats",
+		size:      4,
+		updatedAt: time.Unix(0, 42),
+	}
+
+	byName := ListOptions{Order: OrderByName}
+	byReference := ListOptions{Order: OrderByReference}
+
+	cursor, err := decodeCursor(byName, encodeCursor(byName, node))
+	assert.NoError(t, err)
+	assert.Equal(t, &listCursor{Order: OrderByName, Key: "cats", Reference: "0123456789abcdef"}, cursor)
+
+	cursor, err = decodeCursor(byReference, encodeCursor(byReference, node))
+	assert.NoError(t, err)
+	assert.Equal(t, &listCursor{Order: OrderByReference, Reference: "0123456789abcdef"}, cursor)
+
+	cursor, err = decodeCursor(byName, "")
+	assert.NoError(t, err)
+	assert.Nil(t, cursor)
+
+	_, err = decodeCursor(byReference, encodeCursor(byName, node))
+	assert.Error(t, err)
+
+	_, err = decodeCursor(byName, "not a cursor")
+	assert.Error(t, err)
+
+	bySize := ListOptions{Order: OrderBySize, Descending: true}
+
+	cursor, err = decodeCursor(bySize, encodeCursor(bySize, node))
+	assert.NoError(t, err)
+	assert.Equal(t, &listCursor{Order: OrderBySize, Descending: true, Number: 4, Reference: "0123456789abcdef"}, cursor)
+
+	cursor, err = decodeCursor(ListOptions{Order: OrderByUpdatedAt}, encodeCursor(ListOptions{Order: OrderByUpdatedAt}, node))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), cursor.Number)
+
+	// Cursor of descending list can not be used for ascending list
+	_, err = decodeCursor(ListOptions{Order: OrderBySize}, encodeCursor(bySize, node))
+	assert.Error(t, err)
+
+	assert.Error(t, checkListOrder(ListOrder(-1)))
+}
+
+func TestMakePage(t *testing.T) {
+	nodes := []Node{
+		&MemoryNode{reference: "a", name: "1"},
+		&MemoryNode{reference: "b", name: "2"},
+		&MemoryNode{reference: "c", name: "3"},
+	}
+
+	page := makePage(ListOptions{Order: OrderByName}, nodes)
+	assert.Len(t, page.Nodes, 3)
+	assert.Empty(t, page.Cursor)
+
+	page = makePage(ListOptions{Order: OrderByName, Limit: 3}, nodes)
+	assert.Len(t, page.Nodes, 3)
+	assert.Empty(t, page.Cursor)
+
+	page = makePage(ListOptions{Order: OrderByName, Limit: 2}, nodes)
+	assert.Len(t, page.Nodes, 2)
+	assert.Equal(t, encodeCursor(ListOptions{Order: OrderByName}, nodes[1]), page.Cursor)
+}
+
+func TestMatchListFilters(t *testing.T) {
+	now := time.Now()
+
+	assert.True(t, matchListFilters(ListOptions{}, 4, now, now, ""))
+	assert.True(t, matchListFilters(ListOptions{ContentType: "text/plain"}, 4, now, now, "text/plain"))
+	assert.False(t, matchListFilters(ListOptions{ContentType: "text/plain"}, 4, now, now, ""))
+
+	assert.True(t, matchListFilters(ListOptions{MinSize: 4, MaxSize: 4}, 4, now, now, ""))
+	assert.False(t, matchListFilters(ListOptions{MinSize: 5}, 4, now, now, ""))
+	assert.False(t, matchListFilters(ListOptions{MaxSize: 3}, 4, now, now, ""))
+
+	assert.True(t, matchListFilters(ListOptions{CreatedSince: now}, 4, now, now, ""))
+	assert.False(t, matchListFilters(ListOptions{CreatedBefore: now}, 4, now, now, ""))
+	assert.True(t, matchListFilters(ListOptions{UpdatedBefore: now.Add(time.Second)}, 4, now, now, ""))
+	assert.False(t, matchListFilters(ListOptions{UpdatedSince: now.Add(time.Second)}, 4, now, now, ""))
+}
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package bloby
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+func lockDirectory(path string, exclusive bool) (*os.File, error) {
+	return nil, fmt.Errorf("directory locking: %w", errors.ErrUnsupported)
+}
+
+func unlockDirectory(file *os.File) error {
+	return file.Close()
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package bloby
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Take advisory lock on storage directory, fails with ErrLocked if lock is held by another open storage
+func lockDirectory(path string, exclusive bool) (*os.File, error) {
+	file, err := os.OpenFile(filepath.Join(path, "lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err = syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+	if err != nil {
+		file.Close()
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func unlockDirectory(file *os.File) error {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	return file.Close()
+}
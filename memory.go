@@ -0,0 +1,1199 @@
+package bloby
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+func checkMemoryStorageIsNil(storage *MemoryStorage) {
+	if storage == nil {
+		panic("storage is nil")
+	}
+}
+
+func checkMemoryNodeIsNil(node *MemoryNode) {
+	if node == nil {
+		panic("node is nil")
+	}
+}
+
+// Name matching equivalent to `name like prefix%postfix` used by FileStorage
+func matchName(name string, namePrefix string, namePostfix string) bool {
+	return matchLike(name, namePrefix+"%"+namePostfix)
+}
+
+// Match name against SQLite like pattern: `%` matches any sequence of characters, `_` matches single character
+// and ASCII letters match regardless of case
+func matchLike(name string, pattern string) bool {
+	nameRunes := []rune(name)
+	patternRunes := []rune(pattern)
+
+	i, j := 0, 0
+	// Position in pattern after last `%` and position in name it is matched to
+	wildcard, mark := -1, 0
+
+	for i < len(nameRunes) {
+		if j < len(patternRunes) && patternRunes[j] == '%' {
+			wildcard = j + 1
+			mark = i
+			j++
+		} else if j < len(patternRunes) && (patternRunes[j] == '_' || foldASCII(patternRunes[j]) == foldASCII(nameRunes[i])) {
+			i++
+			j++
+		} else if wildcard >= 0 {
+			// Let last `%` match one more character
+			mark++
+			i = mark
+			j = wildcard
+		} else {
+			return false
+		}
+	}
+
+	for j < len(patternRunes) && patternRunes[j] == '%' {
+		j++
+	}
+
+	return j == len(patternRunes)
+}
+
+func foldASCII(r rune) rune {
+	if 'A' <= r && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+
+	return r
+}
+
+type memoryEntry struct {
+	reference    string
+	name         string
+	metadataJson []byte
+	content      []byte
+	hasContent   bool
+	createdAt    time.Time
+	updatedAt    time.Time
+	contentType  string
+}
+
+// In-memory Storage, keeps metadata and content in process memory.
+//
+// Metadata is stored in JSON form, so nodes returned by queries behave the same way as FileStorage nodes.
+type MemoryStorage struct {
+	lock    sync.Mutex
+	isOpen  bool
+	entries []*memoryEntry
+	index   map[string]*memoryEntry
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		isOpen:  false,
+		entries: make([]*memoryEntry, 0),
+		index:   make(map[string]*memoryEntry),
+	}
+}
+
+func (storage *MemoryStorage) newNode(entry *memoryEntry) *MemoryNode {
+	var node MemoryNode
+	node.storage = storage
+	node.name = entry.name
+	node.reference = entry.reference
+	node.size = int64(len(entry.content))
+	node.createdAt = entry.createdAt
+	node.updatedAt = entry.updatedAt
+	node.contentType = entry.contentType
+
+	if entry.metadataJson != nil {
+		err := json.Unmarshal(entry.metadataJson, &node.metadata)
+		if err != nil {
+			node.metadata = nil
+		}
+	}
+
+	return &node
+}
+
+func (storage *MemoryStorage) deleteEntries(match func(entry *memoryEntry) bool) {
+	entries := make([]*memoryEntry, 0, len(storage.entries))
+
+	for _, entry := range storage.entries {
+		if match(entry) {
+			delete(storage.index, entry.reference)
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+
+	storage.entries = entries
+}
+
+func (storage *MemoryStorage) getByReference(reference string) Node {
+	entry, ok := storage.index[reference]
+	if !ok {
+		return nil
+	}
+
+	return storage.newNode(entry)
+}
+
+func (storage *MemoryStorage) getByName(name string) Node {
+	for _, entry := range storage.entries {
+		if entry.name == name {
+			return storage.newNode(entry)
+		}
+	}
+
+	return nil
+}
+
+func (storage *MemoryStorage) create(name string, metadata interface{}) Node {
+	now := time.Now().Round(0)
+
+	node := MemoryNode{
+		storage:   storage,
+		reference: randomHexString(24),
+		name:      name,
+		metadata:  metadata,
+		createdAt: now,
+		updatedAt: now,
+	}
+
+	entry := &memoryEntry{
+		reference: node.reference,
+		name:      node.name,
+		createdAt: now,
+		updatedAt: now,
+	}
+
+	metadataBytes, err := json.Marshal(node.metadata)
+	if err == nil && metadata != nil {
+		entry.metadataJson = metadataBytes
+	}
+
+	storage.entries = append(storage.entries, entry)
+	storage.index[entry.reference] = entry
+
+	return &node
+}
+
+func (storage *MemoryStorage) createOrReplace(name string, metadata interface{}) (Node, error) {
+	for _, entry := range storage.entries {
+		if entry.name == name {
+			err := storage.setMetadata(entry.reference, metadata)
+			if err != nil {
+				return nil, err
+			}
+
+			node := storage.newNode(entry)
+			node.metadata = metadata
+			node.updatedAt = entry.updatedAt
+
+			return node, nil
+		}
+	}
+
+	return storage.create(name, metadata), nil
+}
+
+func (storage *MemoryStorage) delete(reference string) error {
+	if _, ok := storage.index[reference]; !ok {
+		return ErrNotFound
+	}
+
+	storage.deleteEntries(func(entry *memoryEntry) bool {
+		return entry.reference == reference
+	})
+
+	return nil
+}
+
+func (storage *MemoryStorage) deleteBy(namePrefix string, namePostfix string) {
+	storage.deleteEntries(func(entry *memoryEntry) bool {
+		return matchName(entry.name, namePrefix, namePostfix)
+	})
+}
+
+func (storage *MemoryStorage) existsByName(name string) bool {
+	for _, entry := range storage.entries {
+		if entry.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (storage *MemoryStorage) listBy(namePrefix string, namePostfix string) []Node {
+	nodes := make([]Node, 0)
+
+	for _, entry := range storage.entries {
+		if matchName(entry.name, namePrefix, namePostfix) {
+			nodes = append(nodes, storage.newNode(entry))
+		}
+	}
+
+	return nodes
+}
+
+func (storage *MemoryStorage) listReferences(namePrefix string, namePostfix string) []string {
+	references := make([]string, 0)
+
+	for _, entry := range storage.entries {
+		if matchName(entry.name, namePrefix, namePostfix) {
+			references = append(references, entry.reference)
+		}
+	}
+
+	return references
+}
+
+func (storage *MemoryStorage) setName(reference string, name string) error {
+	entry, ok := storage.index[reference]
+	if !ok {
+		return ErrNotFound
+	}
+
+	entry.name = name
+	entry.updatedAt = time.Now().Round(0)
+
+	return nil
+}
+
+func (storage *MemoryStorage) setMetadata(reference string, metadata interface{}) error {
+	entry, ok := storage.index[reference]
+	if !ok {
+		return ErrNotFound
+	}
+
+	var metadataJson []byte
+
+	if metadata != nil {
+		metadataBytes, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+
+		metadataJson = metadataBytes
+	}
+
+	entry.metadataJson = metadataJson
+	entry.updatedAt = time.Now().Round(0)
+
+	return nil
+}
+
+func (storage *MemoryStorage) setContentType(reference string, contentType string) error {
+	entry, ok := storage.index[reference]
+	if !ok {
+		return ErrNotFound
+	}
+
+	entry.contentType = contentType
+	entry.updatedAt = time.Now().Round(0)
+
+	return nil
+}
+
+func (storage *MemoryStorage) setTimes(reference string, createdAt time.Time, updatedAt time.Time) error {
+	entry, ok := storage.index[reference]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if !createdAt.IsZero() {
+		entry.createdAt = createdAt.Round(0)
+	}
+
+	if !updatedAt.IsZero() {
+		entry.updatedAt = updatedAt.Round(0)
+	}
+
+	return nil
+}
+
+func (storage *MemoryStorage) GetByReference(reference string) (Node, error) {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return storage.getByReference(reference), nil
+}
+
+func (storage *MemoryStorage) GetByName(name string) (Node, error) {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return storage.getByName(name), nil
+}
+
+func (storage *MemoryStorage) Create(name string, metadata interface{}) (Node, error) {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return storage.create(name, metadata), nil
+}
+
+// Replace metadata of first node with given name or create new node
+func (storage *MemoryStorage) CreateOrReplace(name string, metadata interface{}) (Node, error) {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return storage.createOrReplace(name, metadata)
+}
+
+func (storage *MemoryStorage) Delete(reference string) error {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	return storage.delete(reference)
+}
+
+func (storage *MemoryStorage) DeleteBy(namePrefix string, namePostfix string) error {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	storage.deleteBy(namePrefix, namePostfix)
+
+	return nil
+}
+
+func (storage *MemoryStorage) ExistsByName(name string) (bool, error) {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return false, ErrClosed
+	}
+
+	return storage.existsByName(name), nil
+}
+
+func (storage *MemoryStorage) ExistsByReference(reference string) (bool, error) {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return false, ErrClosed
+	}
+
+	_, ok := storage.index[reference]
+
+	return ok, nil
+}
+
+func (storage *MemoryStorage) ListBy(namePrefix string, namePostfix string) ([]Node, error) {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return storage.listBy(namePrefix, namePostfix), nil
+}
+
+func (storage *MemoryStorage) ListReferences(namePrefix string, namePostfix string) ([]string, error) {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	return storage.listReferences(namePrefix, namePostfix), nil
+}
+
+func (storage *MemoryStorage) Query(namePrefix string, namePostfix string, conditions ...Condition) ([]Node, error) {
+	return storage.QueryContext(context.Background(), namePrefix, namePostfix, conditions...)
+}
+
+func (storage *MemoryStorage) QueryContext(ctx context.Context, namePrefix string, namePostfix string, conditions ...Condition) ([]Node, error) {
+	checkMemoryStorageIsNil(storage)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	err := checkConditions(conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	nodes := make([]Node, 0)
+
+	for _, entry := range storage.entries {
+		if matchName(entry.name, namePrefix, namePostfix) && matchConditions(entry.metadataJson, conditions) {
+			nodes = append(nodes, storage.newNode(entry))
+		}
+	}
+
+	return nodes, nil
+}
+
+func (storage *MemoryStorage) ListPage(options ListOptions) (Page, error) {
+	return storage.ListPageContext(context.Background(), options)
+}
+
+func (storage *MemoryStorage) ListPageContext(ctx context.Context, options ListOptions) (Page, error) {
+	checkMemoryStorageIsNil(storage)
+
+	if err := ctx.Err(); err != nil {
+		return Page{}, err
+	}
+
+	err := checkListOrder(options.Order)
+	if err != nil {
+		return Page{}, err
+	}
+
+	cursor, err := decodeCursor(options, options.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	err = checkConditions(options.Where)
+	if err != nil {
+		return Page{}, err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return Page{}, ErrClosed
+	}
+
+	nodes := make([]Node, 0)
+	cursors := make(map[Node]*listCursor)
+
+	for _, entry := range storage.entries {
+		if !matchName(entry.name, options.NamePrefix, options.NamePostfix) || !matchConditions(entry.metadataJson, options.Where) {
+			continue
+		}
+
+		if !matchListFilters(options, int64(len(entry.content)), entry.createdAt, entry.updatedAt, entry.contentType) {
+			continue
+		}
+
+		node := storage.newNode(entry)
+		nodeCursor := nodeCursor(options, node)
+
+		if cursor != nil && !cursor.before(nodeCursor) {
+			continue
+		}
+
+		nodes = append(nodes, node)
+		cursors[node] = nodeCursor
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return cursors[nodes[i]].before(cursors[nodes[j]])
+	})
+
+	if options.Limit > 0 && len(nodes) > options.Limit+1 {
+		nodes = nodes[:options.Limit+1]
+	}
+
+	return makePage(options, nodes), nil
+}
+
+func (storage *MemoryStorage) Walk(options ListOptions, callback func(node Node) error) error {
+	return storage.WalkContext(context.Background(), options, callback)
+}
+
+func (storage *MemoryStorage) WalkContext(ctx context.Context, options ListOptions, callback func(node Node) error) error {
+	checkMemoryStorageIsNil(storage)
+
+	return walkPages(ctx, options, storage.ListPageContext, callback)
+}
+
+func (storage *MemoryStorage) GetByReferenceContext(ctx context.Context, reference string) (Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return storage.GetByReference(reference)
+}
+
+func (storage *MemoryStorage) GetByNameContext(ctx context.Context, name string) (Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return storage.GetByName(name)
+}
+
+func (storage *MemoryStorage) CreateContext(ctx context.Context, name string, metadata interface{}) (Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return storage.Create(name, metadata)
+}
+
+func (storage *MemoryStorage) CreateOrReplaceContext(ctx context.Context, name string, metadata interface{}) (Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return storage.CreateOrReplace(name, metadata)
+}
+
+func (storage *MemoryStorage) DeleteContext(ctx context.Context, reference string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return storage.Delete(reference)
+}
+
+func (storage *MemoryStorage) DeleteByContext(ctx context.Context, namePrefix string, namePostfix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return storage.DeleteBy(namePrefix, namePostfix)
+}
+
+func (storage *MemoryStorage) ExistsByNameContext(ctx context.Context, name string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return storage.ExistsByName(name)
+}
+
+func (storage *MemoryStorage) ExistsByReferenceContext(ctx context.Context, reference string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return storage.ExistsByReference(reference)
+}
+
+func (storage *MemoryStorage) ListByContext(ctx context.Context, namePrefix string, namePostfix string) ([]Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return storage.ListBy(namePrefix, namePostfix)
+}
+
+func (storage *MemoryStorage) ListReferencesContext(ctx context.Context, namePrefix string, namePostfix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return storage.ListReferences(namePrefix, namePostfix)
+}
+
+// Open MemoryStorage, contents are kept between Close and Open calls
+func (storage *MemoryStorage) Open() error {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if storage.isOpen {
+		return ErrAlreadyOpen
+	}
+
+	storage.isOpen = true
+
+	return nil
+}
+
+func (storage *MemoryStorage) Close() error {
+	checkMemoryStorageIsNil(storage)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	storage.isOpen = false
+
+	return nil
+}
+
+func (storage *MemoryStorage) Transaction(fn func(tx Tx) error) error {
+	return storage.TransactionContext(context.Background(), fn)
+}
+
+// Run fn with storage locked, changes are reverted if fn returns error or panics
+func (storage *MemoryStorage) TransactionContext(ctx context.Context, fn func(tx Tx) error) error {
+	checkMemoryStorageIsNil(storage)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.isOpen {
+		return ErrClosed
+	}
+
+	// Entries are copied by value, content slices are replaced on write and can be shared
+	snapshot := make([]memoryEntry, 0, len(storage.entries))
+	for _, entry := range storage.entries {
+		snapshot = append(snapshot, *entry)
+	}
+
+	tx := &memoryTx{storage: storage}
+	committed := false
+
+	defer func() {
+		tx.done = true
+
+		if committed {
+			return
+		}
+
+		storage.entries = make([]*memoryEntry, 0, len(snapshot))
+		storage.index = make(map[string]*memoryEntry, len(snapshot))
+
+		for index := range snapshot {
+			entry := &snapshot[index]
+			storage.entries = append(storage.entries, entry)
+			storage.index[entry.reference] = entry
+		}
+	}()
+
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	committed = true
+
+	return nil
+}
+
+type memoryTx struct {
+	storage *MemoryStorage
+	done    bool
+}
+
+func (tx *memoryTx) GetByReference(reference string) (Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	return tx.storage.getByReference(reference), nil
+}
+
+func (tx *memoryTx) GetByName(name string) (Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	return tx.storage.getByName(name), nil
+}
+
+func (tx *memoryTx) Create(name string, metadata interface{}) (Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	return tx.storage.create(name, metadata), nil
+}
+
+func (tx *memoryTx) CreateOrReplace(name string, metadata interface{}) (Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	return tx.storage.createOrReplace(name, metadata)
+}
+
+func (tx *memoryTx) Delete(reference string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	return tx.storage.delete(reference)
+}
+
+func (tx *memoryTx) DeleteBy(namePrefix string, namePostfix string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.storage.deleteBy(namePrefix, namePostfix)
+
+	return nil
+}
+
+func (tx *memoryTx) ExistsByName(name string) (bool, error) {
+	if tx.done {
+		return false, ErrTxDone
+	}
+
+	return tx.storage.existsByName(name), nil
+}
+
+func (tx *memoryTx) ExistsByReference(reference string) (bool, error) {
+	if tx.done {
+		return false, ErrTxDone
+	}
+
+	_, ok := tx.storage.index[reference]
+
+	return ok, nil
+}
+
+func (tx *memoryTx) ListBy(namePrefix string, namePostfix string) ([]Node, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	return tx.storage.listBy(namePrefix, namePostfix), nil
+}
+
+func (tx *memoryTx) ListReferences(namePrefix string, namePostfix string) ([]string, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	return tx.storage.listReferences(namePrefix, namePostfix), nil
+}
+
+func (tx *memoryTx) SetName(reference string, name string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	return tx.storage.setName(reference, name)
+}
+
+func (tx *memoryTx) SetMetadata(reference string, metadata interface{}) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	return tx.storage.setMetadata(reference, metadata)
+}
+
+type MemoryNode struct {
+	storage     *MemoryStorage
+	reference   string
+	name        string
+	metadata    interface{}
+	size        int64
+	createdAt   time.Time
+	updatedAt   time.Time
+	contentType string
+}
+
+func (node *MemoryNode) GetReference() string {
+	checkMemoryNodeIsNil(node)
+
+	return node.reference
+}
+
+func (node *MemoryNode) GetName() string {
+	checkMemoryNodeIsNil(node)
+
+	return node.name
+}
+
+func (node *MemoryNode) GetMetadata() interface{} {
+	checkMemoryNodeIsNil(node)
+
+	return node.metadata
+}
+
+func (node *MemoryNode) SetName(name string) error {
+	checkMemoryNodeIsNil(node)
+
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return ErrClosed
+	}
+
+	err := node.storage.setName(node.reference, name)
+	if err != nil {
+		return err
+	}
+
+	node.name = name
+	node.updatedAt = node.storage.index[node.reference].updatedAt
+
+	return nil
+}
+
+func (node *MemoryNode) SetMetadata(metadata interface{}) error {
+	checkMemoryNodeIsNil(node)
+
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return ErrClosed
+	}
+
+	err := node.storage.setMetadata(node.reference, metadata)
+	if err != nil {
+		return err
+	}
+
+	node.metadata = metadata
+	node.updatedAt = node.storage.index[node.reference].updatedAt
+
+	return nil
+}
+
+func (node *MemoryNode) SetNameContext(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return node.SetName(name)
+}
+
+func (node *MemoryNode) SetMetadataContext(ctx context.Context, metadata interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return node.SetMetadata(metadata)
+}
+
+func (node *MemoryNode) GetSize() int64 {
+	checkMemoryNodeIsNil(node)
+
+	return node.size
+}
+
+func (node *MemoryNode) GetCreatedAt() time.Time {
+	checkMemoryNodeIsNil(node)
+
+	return node.createdAt
+}
+
+func (node *MemoryNode) GetUpdatedAt() time.Time {
+	checkMemoryNodeIsNil(node)
+
+	return node.updatedAt
+}
+
+func (node *MemoryNode) GetContentType() string {
+	checkMemoryNodeIsNil(node)
+
+	return node.contentType
+}
+
+func (node *MemoryNode) SetContentType(contentType string) error {
+	checkMemoryNodeIsNil(node)
+
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return ErrClosed
+	}
+
+	err := node.storage.setContentType(node.reference, contentType)
+	if err != nil {
+		return err
+	}
+
+	node.contentType = contentType
+	node.updatedAt = node.storage.index[node.reference].updatedAt
+
+	return nil
+}
+
+func (node *MemoryNode) SetContentTypeContext(ctx context.Context, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return node.SetContentType(contentType)
+}
+
+func (node *MemoryNode) SetTimes(createdAt time.Time, updatedAt time.Time) error {
+	checkMemoryNodeIsNil(node)
+
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return ErrClosed
+	}
+
+	err := node.storage.setTimes(node.reference, createdAt, updatedAt)
+	if err != nil {
+		return err
+	}
+
+	node.createdAt = node.storage.index[node.reference].createdAt
+	node.updatedAt = node.storage.index[node.reference].updatedAt
+
+	return nil
+}
+
+func (node *MemoryNode) SetTimesContext(ctx context.Context, createdAt time.Time, updatedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return node.SetTimes(createdAt, updatedAt)
+}
+
+func (node *MemoryNode) GetReader() (io.Reader, error) {
+	checkMemoryNodeIsNil(node)
+
+	reader, err := node.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func (node *MemoryNode) GetSeekReader() (ReadSeekCloserAt, error) {
+	checkMemoryNodeIsNil(node)
+
+	reader, err := node.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func (node *MemoryNode) open() (*memoryReader, error) {
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	entry, ok := node.storage.index[node.reference]
+	if !ok || !entry.hasContent {
+		return nil, contentNotFoundError("read", node.reference)
+	}
+
+	// Content slice is replaced on write, so it is safe to share
+	return &memoryReader{bytes.NewReader(entry.content)}, nil
+}
+
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (reader *memoryReader) Close() error {
+	return nil
+}
+
+func (node *MemoryNode) GetWriter() (io.Writer, error) {
+	checkMemoryNodeIsNil(node)
+
+	return node.openWriter(os.O_RDWR | os.O_CREATE | os.O_TRUNC)
+}
+
+func (node *MemoryNode) GetWriteCloser() (io.WriteCloser, error) {
+	checkMemoryNodeIsNil(node)
+
+	return node.openWriter(os.O_RDWR | os.O_CREATE | os.O_TRUNC)
+}
+
+// Get writer with os.OpenFile flag semantics: os.O_CREATE, os.O_EXCL, os.O_TRUNC and os.O_APPEND are respected.
+//
+// Written content replaces node content on Close.
+func (node *MemoryNode) GetFlagWriter(flag int) (io.Writer, error) {
+	checkMemoryNodeIsNil(node)
+
+	return node.openWriter(flag)
+}
+
+func (node *MemoryNode) GetFlagWriteCloser(flag int) (io.WriteCloser, error) {
+	checkMemoryNodeIsNil(node)
+
+	return node.openWriter(flag)
+}
+
+func (node *MemoryNode) openWriter(flag int) (io.WriteCloser, error) {
+	writer, err := node.newWriter(flag)
+	if err != nil {
+		return nil, wrapError("write", node.reference, err)
+	}
+
+	return writer, nil
+}
+
+func (node *MemoryNode) newWriter(flag int) (*memoryWriter, error) {
+	node.storage.lock.Lock()
+	defer node.storage.lock.Unlock()
+
+	if !node.storage.isOpen {
+		return nil, ErrClosed
+	}
+
+	entry, ok := node.storage.index[node.reference]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if entry.hasContent {
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return nil, &os.PathError{Op: "open", Path: node.reference, Err: os.ErrExist}
+		}
+	} else if flag&os.O_CREATE == 0 {
+		return nil, &os.PathError{Op: "open", Path: node.reference, Err: os.ErrNotExist}
+	}
+
+	writer := &memoryWriter{
+		node:      node,
+		storage:   node.storage,
+		reference: node.reference,
+		append:    flag&os.O_APPEND != 0,
+	}
+
+	if flag&os.O_TRUNC == 0 {
+		writer.content = bytes.Clone(entry.content)
+	}
+
+	return writer, nil
+}
+
+type memoryWriter struct {
+	node      *MemoryNode
+	storage   *MemoryStorage
+	reference string
+	content   []byte
+	offset    int
+	append    bool
+	closed    bool
+}
+
+func (writer *memoryWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, os.ErrClosed
+	}
+
+	if writer.append {
+		writer.offset = len(writer.content)
+	}
+
+	end := writer.offset + len(p)
+	if end > len(writer.content) {
+		writer.content = append(writer.content, make([]byte, end-len(writer.content))...)
+	}
+
+	copy(writer.content[writer.offset:end], p)
+	writer.offset = end
+
+	return len(p), nil
+}
+
+func (writer *memoryWriter) Close() error {
+	if writer.closed {
+		return os.ErrClosed
+	}
+
+	writer.closed = true
+
+	writer.storage.lock.Lock()
+	defer writer.storage.lock.Unlock()
+
+	if !writer.storage.isOpen {
+		return ErrClosed
+	}
+
+	entry, ok := writer.storage.index[writer.reference]
+	if !ok {
+		return ErrNotFound
+	}
+
+	entry.content = writer.content
+	entry.hasContent = true
+	entry.updatedAt = time.Now().Round(0)
+
+	writer.node.size = int64(len(entry.content))
+	writer.node.updatedAt = entry.updatedAt
+
+	return nil
+}
+
+// Discard written content
+func (writer *memoryWriter) Abort() error {
+	if writer.closed {
+		return os.ErrClosed
+	}
+
+	writer.closed = true
+	writer.content = nil
+
+	return nil
+}
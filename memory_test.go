@@ -0,0 +1,322 @@
+package bloby
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryOpenClose(t *testing.T) {
+	storage := NewMemoryStorage()
+	assert.NotNil(t, storage)
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	err = storage.Open()
+	assert.Error(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	err = storage.Close()
+	assert.Error(t, err)
+
+	_, err = storage.Create("AAAAAAAA", nil)
+	assert.Error(t, err)
+}
+
+func TestMemoryCreate(t *testing.T) {
+	storage := NewMemoryStorage()
+	assert.NotNil(t, storage)
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	// Check interface implementation
+	storageCast, ok := (interface{}(storage)).(Storage)
+	assert.True(t, ok)
+	assert.NotNil(t, storageCast)
+
+	node1, err := storage.Create(
+		"AAAAAAAA",
+		map[string]interface{}{
+			"amount": 13,
+		},
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, node1)
+	assert.Equal(t, "AAAAAAAA", node1.GetName())
+
+	node2, err := storage.Create("BBBBBBBB", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, node2)
+	assert.Nil(t, node2.GetMetadata())
+
+	assert.NotEqual(t, node1.GetReference(), node2.GetReference())
+
+	// Metadata goes through JSON just like in FileStorage
+	node, err := storage.GetByName("AAAAAAAA")
+	assert.NoError(t, err)
+	assert.NotNil(t, node)
+	assert.Equal(t, map[string]interface{}{"amount": 13.0}, node.GetMetadata())
+
+	node, err = storage.GetByReference(node2.GetReference())
+	assert.NoError(t, err)
+	assert.NotNil(t, node)
+	assert.Equal(t, "BBBBBBBB", node.GetName())
+	assert.Nil(t, node.GetMetadata())
+
+	node, err = storage.GetByName("CCCCCCCC")
+	assert.NoError(t, err)
+	assert.Nil(t, node)
+
+	exists, err := storage.ExistsByName("CCCCCCCC")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = storage.ExistsByReference(node1.GetReference())
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// Persistency check
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	exists, err = storage.ExistsByName("AAAAAAAA")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestMemoryListDelete(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	names := []string{"a", "ab", "aab", "ba", "bab", "b", "", "a"}
+	var references []string
+
+	for _, name := range names {
+		node, err := storage.Create(name, nil)
+		assert.NoError(t, err)
+
+		references = append(references, node.GetReference())
+	}
+
+	nodes, err := storage.ListBy("", "")
+	assert.NoError(t, err)
+	CheckQueriedNodes(t, names, references, nodes)
+
+	// Prefix and postfix must not overlap
+	nodes, err = storage.ListBy("a", "b")
+	assert.NoError(t, err)
+	assert.True(t, CheckFullContains([]string{"ab", "aab"}, NodesToNames(nodes)))
+
+	nodes, err = storage.ListBy("a", "a")
+	assert.NoError(t, err)
+	assert.Empty(t, nodes)
+
+	refs, err := storage.ListReferences("b", "")
+	assert.NoError(t, err)
+	assert.True(t, CheckFullContains([]string{references[3], references[4], references[5]}, refs))
+
+	err = storage.Delete(references[0])
+	assert.NoError(t, err)
+
+	err = storage.DeleteBy("", "b")
+	assert.NoError(t, err)
+
+	nodes, err = storage.ListBy("", "")
+	assert.NoError(t, err)
+	CheckQueriedNodes(
+		t,
+		[]string{"ba", "", "a"},
+		[]string{references[3], references[6], references[7]},
+		nodes,
+	)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestMemoryMutate(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("AAAAAAAA", "metadata")
+	assert.NoError(t, err)
+
+	mutableNode, ok := node.(Mutable)
+	assert.True(t, ok)
+
+	err = mutableNode.SetName("BBBBBBBB")
+	assert.NoError(t, err)
+	assert.Equal(t, "BBBBBBBB", node.GetName())
+
+	err = mutableNode.SetMetadata(9.1)
+	assert.NoError(t, err)
+	assert.Equal(t, 9.1, node.GetMetadata())
+
+	nodeRequeried, err := storage.GetByName("BBBBBBBB")
+	assert.NoError(t, err)
+	assert.Equal(t, node.GetReference(), nodeRequeried.GetReference())
+	assert.Equal(t, 9.1, nodeRequeried.GetMetadata())
+
+	err = mutableNode.SetMetadata(nil)
+	assert.NoError(t, err)
+
+	nodeRequeried, err = storage.GetByReference(node.GetReference())
+	assert.NoError(t, err)
+	assert.Nil(t, nodeRequeried.GetMetadata())
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestMemoryFileIO(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	// No content yet
+	_, err = node.(Readable).GetReader()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = node.(FlagWritable).GetFlagWriter(os.O_WRONLY)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	writer, err := node.(Writable).GetWriter()
+	assert.NoError(t, err)
+
+	writer.Write([]byte("meow"))
+	writer.(io.Closer).Close()
+
+	// Append
+	writer, err = node.(FlagWritable).GetFlagWriter(os.O_WRONLY | os.O_APPEND)
+	assert.NoError(t, err)
+
+	writer.Write([]byte("-purr"))
+	writer.(io.Closer).Close()
+
+	// Overwrite head
+	writer, err = node.(FlagWritable).GetFlagWriter(os.O_WRONLY)
+	assert.NoError(t, err)
+
+	writer.Write([]byte("MEOW"))
+	writer.(io.Closer).Close()
+
+	_, err = node.(FlagWritable).GetFlagWriter(os.O_WRONLY | os.O_CREATE | os.O_EXCL)
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	// Aborted write is discarded
+	writer, err = node.(Writable).GetWriter()
+	assert.NoError(t, err)
+
+	writer.Write([]byte("woof"))
+	err = writer.(Abortable).Abort()
+	assert.NoError(t, err)
+
+	reader, err := node.(Readable).GetReader()
+	assert.NoError(t, err)
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("MEOW-purr"), content)
+
+	// Content is dropped with node
+	err = storage.Delete(node.GetReference())
+	assert.NoError(t, err)
+
+	_, err = node.(Readable).GetReader()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestMemorySeekReader(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("cats", nil)
+	assert.NoError(t, err)
+
+	writer, err := node.(CloseWritable).GetWriteCloser()
+	assert.NoError(t, err)
+
+	writer.Write([]byte("meow"))
+	err = writer.Close()
+	assert.NoError(t, err)
+
+	reader, err := node.(SeekReadable).GetSeekReader()
+	assert.NoError(t, err)
+
+	// Reader keeps content snapshot
+	writer, err = node.(CloseWritable).GetWriteCloser()
+	assert.NoError(t, err)
+
+	writer.Write([]byte("woof"))
+	err = writer.Close()
+	assert.NoError(t, err)
+
+	_, err = reader.Seek(1, io.SeekStart)
+	assert.NoError(t, err)
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("eow"), content)
+
+	err = reader.Close()
+	assert.NoError(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestMemoryContext(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	storageCast, ok := (interface{}(storage)).(StorageContext)
+	assert.True(t, ok)
+	assert.NotNil(t, storageCast)
+
+	node, err := storage.CreateContext(context.Background(), "cats", nil)
+	assert.NoError(t, err)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = storage.DeleteContext(cancelled, node.GetReference())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = node.(MutableContext).SetNameContext(cancelled, "dogs")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	exists, err := storage.ExistsByReferenceContext(context.Background(), node.GetReference())
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,290 @@
+package bloby
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Schema migration, upgrades schema by one version inside transaction
+type migration func(storage *FileStorage, tx *sql.Tx) error
+
+// Migrations applied in order, migration at index i upgrades schema from version i to version i + 1.
+//
+// Stores created before schema was versioned have version 0 and any subset of columns added by early migrations, so early migrations add missing columns only.
+var migrations = []migration{
+	migrateMetadataTable,
+	migrateContentAddressed,
+	migrateChecksums,
+	migrateSystemColumns,
+	migrateCodecs,
+	migrateSettings,
+}
+
+// Schema version supported by library
+var schemaVersion = len(migrations)
+
+func (storage *FileStorage) querySchemaVersion(db queryExecutor) (int, error) {
+	var version int
+
+	err := db.QueryRowContext(context.Background(), "pragma user_version").Scan(&version)
+
+	return version, err
+}
+
+// Apply pending migrations, fails with ErrSchemaTooNew if schema is newer than supported
+func (storage *FileStorage) migrate() error {
+	version, err := storage.querySchemaVersion(storage.db)
+	if err != nil {
+		return err
+	}
+
+	if version == schemaVersion {
+		return nil
+	}
+
+	if version > schemaVersion {
+		return fmt.Errorf("%w: version %d, supported %d", ErrSchemaTooNew, version, schemaVersion)
+	}
+
+	tx, err := storage.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Schema may be migrated by another process in shared lock mode
+	version, err = storage.querySchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	if version > schemaVersion {
+		return fmt.Errorf("%w: version %d, supported %d", ErrSchemaTooNew, version, schemaVersion)
+	}
+
+	for ; version < schemaVersion; version++ {
+		err = migrations[version](storage, tx)
+		if err != nil {
+			return fmt.Errorf("migrate schema to version %d: %w", version+1, err)
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("pragma user_version = %d", version))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Check whether table has column
+func hasColumn(tx *sql.Tx, table string, column string) (bool, error) {
+	rows, err := tx.Query("select name from pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return false, err
+		}
+
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// Add column unless it was added before schema was versioned
+func addColumn(tx *sql.Tx, table string, column string, definition string) error {
+	exists, err := hasColumn(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec("alter table " + table + " add column " + column + " " + definition)
+
+	return err
+}
+
+// Run statements in order
+func execAll(tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateMetadataTable(storage *FileStorage, tx *sql.Tx) error {
+	return execAll(
+		tx,
+		"create table if not exists metadata (name text, reference text, metadata text)",
+		"create index if not exists idx_metadata_name on metadata(name)",
+		"create index if not exists idx_metadata_reference on metadata(reference)",
+		"create index if not exists idx_metadata_name_reference on metadata(name, reference)",
+	)
+}
+
+func migrateContentAddressed(storage *FileStorage, tx *sql.Tx) error {
+	err := addColumn(tx, "metadata", "blob", "text")
+	if err != nil {
+		return err
+	}
+
+	return execAll(
+		tx,
+		"create index if not exists idx_metadata_blob on metadata(blob)",
+		"create table if not exists blobs (hash text primary key, refcount integer not null)",
+	)
+}
+
+func migrateChecksums(storage *FileStorage, tx *sql.Tx) error {
+	err := addColumn(tx, "metadata", "checksum", "text")
+	if err != nil {
+		return err
+	}
+
+	return addColumn(tx, "metadata", "size", "integer")
+}
+
+// Add system columns and record size and modification time of existing content
+func migrateSystemColumns(storage *FileStorage, tx *sql.Tx) error {
+	for _, column := range []struct {
+		name       string
+		definition string
+	}{
+		{"created_at", "integer not null default 0"},
+		{"updated_at", "integer not null default 0"},
+		{"content_type", "text not null default ''"},
+	} {
+		err := addColumn(tx, "metadata", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := execAll(
+		tx,
+		"create index if not exists idx_metadata_size_reference on metadata(coalesce(size, 0), reference)",
+		"create index if not exists idx_metadata_created_at_reference on metadata(created_at, reference)",
+		"create index if not exists idx_metadata_updated_at_reference on metadata(updated_at, reference)",
+		"create index if not exists idx_metadata_content_type on metadata(content_type)",
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("select reference, blob from metadata where size is null")
+	if err != nil {
+		return err
+	}
+
+	type legacyRow struct {
+		reference string
+		blob      sql.NullString
+	}
+
+	legacyRows := make([]legacyRow, 0)
+
+	for rows.Next() {
+		var row legacyRow
+
+		err = rows.Scan(&row.reference, &row.blob)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		legacyRows = append(legacyRows, row)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, row := range legacyRows {
+		path := ""
+		if !storage.options.ContentAddressed {
+			path = storage.getPathByReference(row.reference)
+		} else if row.blob.Valid {
+			path = storage.getPathByBlob(row.blob.String)
+		}
+
+		var size int64
+		var updatedAt int64
+
+		if path != "" {
+			info, err := os.Stat(path)
+			if err == nil {
+				size = info.Size()
+				updatedAt = info.ModTime().UnixNano()
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+
+		_, err = tx.Exec("update metadata set size = ?, updated_at = max(updated_at, ?) where reference = ?", size, updatedAt, row.reference)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateCodecs(storage *FileStorage, tx *sql.Tx) error {
+	return addColumn(tx, "metadata", "codec", "text not null default ''")
+}
+
+// Storage settings fixed on creation, such as content addressed mode
+func migrateSettings(storage *FileStorage, tx *sql.Tx) error {
+	return execAll(tx, "create table if not exists settings (name text primary key, value text not null)")
+}
+
+// Names of settings table entries
+const (
+	settingContentAddressed = "content_addressed"
+)
+
+// Query setting value, returns false if setting is not recorded or settings table does not exist yet
+func querySetting(db queryExecutor, name string) (string, bool, error) {
+	var exists bool
+
+	err := db.QueryRowContext(context.Background(), "select exists(select 1 from sqlite_master where type = 'table' and name = 'settings')").Scan(&exists)
+	if err != nil || !exists {
+		return "", false, err
+	}
+
+	var value string
+
+	err = db.QueryRowContext(context.Background(), "select value from settings where name = ?", name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// Record setting unless it is recorded already
+func recordSetting(db queryExecutor, name string, value string) error {
+	_, err := db.ExecContext(context.Background(), "insert or ignore into settings (name, value) values (?, ?)", name, value)
+
+	return err
+}
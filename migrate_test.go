@@ -0,0 +1,83 @@
+package bloby
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	testDirName := "test-file-storage-TestMigrate"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	// Store created before schema was versioned, with part of later columns added
+	assert.NoError(t, os.MkdirAll(testDirName, 0755))
+
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(testDirName, "metadata.db"))
+	assert.NoError(t, err)
+
+	reference := "0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	_, err = db.Exec("create table metadata (name text, reference text, metadata text)")
+	assert.NoError(t, err)
+	_, err = db.Exec("alter table metadata add column blob text")
+	assert.NoError(t, err)
+	_, err = db.Exec("insert into metadata (name, reference, metadata) values ('cats', ?, '\"meow\"')", reference)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	storage := NewFileStorage(testDirName)
+
+	assert.NoError(t, os.MkdirAll(storage.getDirByReference(reference), 0755))
+	assert.NoError(t, os.WriteFile(storage.getPathByReference(reference), []byte("meow"), 0644))
+
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	version, err := storage.querySchemaVersion(storage.db)
+	assert.NoError(t, err)
+	assert.Equal(t, schemaVersion, version)
+
+	node, err := storage.GetByName("cats")
+	assert.NoError(t, err)
+	assert.Equal(t, reference, node.GetReference())
+	assert.Equal(t, "meow", node.GetMetadata())
+	assert.Equal(t, int64(4), node.(*FileNode).GetSize())
+
+	_, err = node.(*FileNode).GetChecksum()
+	assert.ErrorIs(t, err, ErrNoChecksum)
+
+	_, err = storage.Create("more cats", nil)
+	assert.NoError(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Migrated store is opened as is
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	nodes, err := storage.ListBy("", "")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2)
+
+	// Store migrated by newer version of library
+	_, err = storage.db.Exec(fmt.Sprintf("pragma user_version = %d", schemaVersion+1))
+	assert.NoError(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	err = storage.Open()
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+
+	_, err = storage.GetByName("cats")
+	assert.ErrorIs(t, err, ErrClosed)
+}
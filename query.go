@@ -0,0 +1,350 @@
+package bloby
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Operator int
+
+const (
+	OpEqual Operator = iota
+	OpNotEqual
+	OpLess
+	OpLessOrEqual
+	OpGreater
+	OpGreaterOrEqual
+	// Path is present in metadata, including JSON null values
+	OpExists
+	OpNotExists
+	// Value at path is equal to one of Condition.Values
+	OpIn
+)
+
+// Condition on metadata field.
+//
+// Path addresses field of metadata JSON object with dot separated keys and array indices, for example `owner` or `tags[0]`.
+// Values must be strings, numbers or booleans. Nodes where path is missing match only OpNotExists.
+type Condition struct {
+	Path   string
+	Op     Operator
+	Value  interface{}
+	Values []interface{}
+}
+
+// Storage with metadata queries
+type Queryable interface {
+	Query(namePrefix string, namePostfix string, conditions ...Condition) ([]Node, error)
+	QueryContext(ctx context.Context, namePrefix string, namePostfix string, conditions ...Condition) ([]Node, error)
+}
+
+var conditionPathRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+\])*$`)
+
+func checkConditionPath(path string) error {
+	if !conditionPathRegexp.MatchString(path) {
+		return errors.New("invalid metadata path: " + strconv.Quote(path))
+	}
+
+	return nil
+}
+
+func checkConditionValue(value interface{}) error {
+	_, _, ok := conditionValue(value)
+	if !ok {
+		return errors.New("unsupported condition value type")
+	}
+
+	return nil
+}
+
+func checkConditions(conditions []Condition) error {
+	for _, condition := range conditions {
+		err := checkConditionPath(condition.Path)
+		if err != nil {
+			return err
+		}
+
+		switch condition.Op {
+		case OpEqual, OpNotEqual, OpLess, OpLessOrEqual, OpGreater, OpGreaterOrEqual:
+			err = checkConditionValue(condition.Value)
+			if err != nil {
+				return err
+			}
+		case OpExists, OpNotExists:
+		case OpIn:
+			for _, value := range condition.Values {
+				err = checkConditionValue(value)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			return errors.New("unknown condition operator")
+		}
+	}
+
+	return nil
+}
+
+// Convert condition value into number or string, booleans are represented as 1 and 0 as in SQLite JSON functions
+func conditionValue(value interface{}) (float64, string, bool) {
+	switch value := value.(type) {
+	case string:
+		return 0, value, true
+	case bool:
+		if value {
+			return 1, "", true
+		}
+		return 0, "", true
+	case int:
+		return float64(value), "", true
+	case int8:
+		return float64(value), "", true
+	case int16:
+		return float64(value), "", true
+	case int32:
+		return float64(value), "", true
+	case int64:
+		return float64(value), "", true
+	case uint:
+		return float64(value), "", true
+	case uint8:
+		return float64(value), "", true
+	case uint16:
+		return float64(value), "", true
+	case uint32:
+		return float64(value), "", true
+	case uint64:
+		return float64(value), "", true
+	case float32:
+		return float64(value), "", true
+	case float64:
+		return value, "", true
+	default:
+		return 0, "", false
+	}
+}
+
+// Value bound into SQLite query
+func conditionArgument(value interface{}) interface{} {
+	if value, ok := value.(bool); ok {
+		if value {
+			return 1
+		}
+		return 0
+	}
+
+	return value
+}
+
+// SQL expression extracting metadata path, must stay the same for expression indexes to be used
+func metadataPathExpression(path string) string {
+	return "json_extract(metadata, '$." + path + "')"
+}
+
+func metadataIndexName(path string) string {
+	return "idx_metadata_json_" + hex.EncodeToString([]byte(path))
+}
+
+// Build SQL condition joined with `and`, conditions must be checked
+func conditionsSQL(conditions []Condition) (string, []interface{}) {
+	parts := make([]string, 0, len(conditions))
+	args := make([]interface{}, 0)
+
+	for _, condition := range conditions {
+		expression := metadataPathExpression(condition.Path)
+
+		switch condition.Op {
+		case OpEqual:
+			parts = append(parts, expression+" = ?")
+			args = append(args, conditionArgument(condition.Value))
+		case OpNotEqual:
+			parts = append(parts, expression+" != ?")
+			args = append(args, conditionArgument(condition.Value))
+		case OpLess:
+			parts = append(parts, expression+" < ?")
+			args = append(args, conditionArgument(condition.Value))
+		case OpLessOrEqual:
+			parts = append(parts, expression+" <= ?")
+			args = append(args, conditionArgument(condition.Value))
+		case OpGreater:
+			parts = append(parts, expression+" > ?")
+			args = append(args, conditionArgument(condition.Value))
+		case OpGreaterOrEqual:
+			parts = append(parts, expression+" >= ?")
+			args = append(args, conditionArgument(condition.Value))
+		case OpExists:
+			parts = append(parts, "json_type(metadata, '$."+condition.Path+"') is not null")
+		case OpNotExists:
+			parts = append(parts, "json_type(metadata, '$."+condition.Path+"') is null")
+		case OpIn:
+			if len(condition.Values) == 0 {
+				parts = append(parts, "0")
+				continue
+			}
+
+			placeholders := strings.Repeat(", ?", len(condition.Values))[2:]
+			parts = append(parts, expression+" in ("+placeholders+")")
+
+			for _, value := range condition.Values {
+				args = append(args, conditionArgument(value))
+			}
+		}
+	}
+
+	return strings.Join(parts, " and "), args
+}
+
+// Resolve metadata path in decoded JSON value
+func lookupMetadataPath(metadata interface{}, path string) (interface{}, bool) {
+	value := metadata
+
+	for path != "" {
+		if path[0] == '[' {
+			end := strings.IndexByte(path, ']')
+			index, _ := strconv.Atoi(path[1:end])
+			path = path[end+1:]
+
+			array, ok := value.([]interface{})
+			if !ok || index >= len(array) {
+				return nil, false
+			}
+
+			value = array[index]
+			continue
+		}
+
+		path = strings.TrimPrefix(path, ".")
+		end := strings.IndexAny(path, ".[")
+		if end < 0 {
+			end = len(path)
+		}
+
+		key := path[:end]
+		path = path[end:]
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		value, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// Compare metadata value with condition value following SQLite ordering where numbers are less than text.
+// Returns false for JSON null, which compares as SQL NULL.
+func compareConditionValue(value interface{}, conditionValueRaw interface{}) (int, bool) {
+	var valueNumber float64
+	var valueText string
+	var valueIsText bool
+
+	switch value := value.(type) {
+	case nil:
+		return 0, false
+	case string:
+		valueText = value
+		valueIsText = true
+	case float64, bool:
+		valueNumber, _, _ = conditionValue(value)
+	default:
+		// Objects and arrays are extracted as JSON text
+		valueBytes, err := json.Marshal(value)
+		if err != nil {
+			return 0, false
+		}
+
+		valueText = string(valueBytes)
+		valueIsText = true
+	}
+
+	number, text, _ := conditionValue(conditionValueRaw)
+	_, isText := conditionValueRaw.(string)
+
+	switch {
+	case valueIsText && isText:
+		return strings.Compare(valueText, text), true
+	case valueIsText:
+		return 1, true
+	case isText:
+		return -1, true
+	case valueNumber < number:
+		return -1, true
+	case valueNumber > number:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+// Evaluate conditions against metadata in JSON form, conditions must be checked
+func matchConditions(metadataJson []byte, conditions []Condition) bool {
+	if len(conditions) == 0 {
+		return true
+	}
+
+	var metadata interface{}
+
+	if metadataJson != nil {
+		err := json.Unmarshal(metadataJson, &metadata)
+		if err != nil {
+			return false
+		}
+	}
+
+	for _, condition := range conditions {
+		value, exists := lookupMetadataPath(metadata, condition.Path)
+
+		var match bool
+
+		switch condition.Op {
+		case OpExists:
+			match = exists
+		case OpNotExists:
+			match = !exists
+		case OpIn:
+			for _, conditionValue := range condition.Values {
+				if result, ok := compareConditionValue(value, conditionValue); exists && ok && result == 0 {
+					match = true
+					break
+				}
+			}
+		default:
+			result, ok := compareConditionValue(value, condition.Value)
+			if !exists || !ok {
+				return false
+			}
+
+			switch condition.Op {
+			case OpEqual:
+				match = result == 0
+			case OpNotEqual:
+				match = result != 0
+			case OpLess:
+				match = result < 0
+			case OpLessOrEqual:
+				match = result <= 0
+			case OpGreater:
+				match = result > 0
+			case OpGreaterOrEqual:
+				match = result >= 0
+			}
+		}
+
+		if !match {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,50 @@
+package bloby
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionPath(t *testing.T) {
+	assert.NoError(t, checkConditionPath("owner"))
+	assert.NoError(t, checkConditionPath("owner.name"))
+	assert.NoError(t, checkConditionPath("tags[0]"))
+	assert.NoError(t, checkConditionPath("a_b.c[10].d"))
+
+	assert.Error(t, checkConditionPath(""))
+	assert.Error(t, checkConditionPath("$.owner"))
+	assert.Error(t, checkConditionPath("owner."))
+	assert.Error(t, checkConditionPath("[0]"))
+	assert.Error(t, checkConditionPath("tags[-1]"))
+	assert.Error(t, checkConditionPath("owner'"))
+}
+
+func TestLookupMetadataPath(t *testing.T) {
+	metadata := map[string]interface{}{
+		"owner": "alice",
+		"tags":  []interface{}{"a", map[string]interface{}{"b": 1.0}},
+		"empty": nil,
+	}
+
+	value, ok := lookupMetadataPath(metadata, "owner")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", value)
+
+	value, ok = lookupMetadataPath(metadata, "tags[1].b")
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, value)
+
+	value, ok = lookupMetadataPath(metadata, "empty")
+	assert.True(t, ok)
+	assert.Nil(t, value)
+
+	_, ok = lookupMetadataPath(metadata, "tags[2]")
+	assert.False(t, ok)
+
+	_, ok = lookupMetadataPath(metadata, "owner.name")
+	assert.False(t, ok)
+
+	_, ok = lookupMetadataPath("string", "owner")
+	assert.False(t, ok)
+}
@@ -0,0 +1,166 @@
+package bloby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Progress of key rotation, reported after each node
+type RotateProgress struct {
+	Reference string
+	// Node content or metadata was encrypted again, false if node was already encrypted with current key
+	Rotated bool
+	// Amount of processed nodes and amount of nodes listed on start
+	Done  int
+	Total int
+}
+
+type RotateOptions struct {
+	// Called after each processed node
+	Progress func(progress RotateProgress)
+}
+
+type RotateReport struct {
+	// Amount of nodes encrypted again
+	Rotated int
+	// Amount of nodes already encrypted with current key, without content or deleted during rotation
+	Skipped int
+}
+
+func (storage *EncryptedStorage) RotateKeys(options RotateOptions) (RotateReport, error) {
+	return storage.RotateKeysContext(context.Background(), options)
+}
+
+// Encrypt content and metadata of all nodes with current key of KeyProvider.
+//
+// Each node is replaced atomically and nodes already encrypted with current key are skipped, so interrupted rotation is resumed by running it again.
+// Previous keys must stay available until rotation completes. Unencrypted metadata is encrypted if EncryptMetadata is set.
+// Content or metadata written concurrently with rotation of the same node may be replaced by rotated copy of its previous value.
+func (storage *EncryptedStorage) RotateKeysContext(ctx context.Context, options RotateOptions) (RotateReport, error) {
+	checkEncryptedStorageIsNil(storage)
+
+	report := RotateReport{}
+
+	keyID, _, err := storage.currentKey()
+	if err != nil {
+		return report, err
+	}
+
+	references, err := storage.storage.ListReferences("", "")
+	if err != nil {
+		return report, err
+	}
+
+	for i, reference := range references {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		rotated, err := storage.rotateNode(reference, keyID)
+		if err != nil {
+			return report, fmt.Errorf("bloby: rotate %s: %w", reference, err)
+		}
+
+		if rotated {
+			report.Rotated++
+		} else {
+			report.Skipped++
+		}
+
+		if options.Progress != nil {
+			options.Progress(RotateProgress{
+				Reference: reference,
+				Rotated:   rotated,
+				Done:      i + 1,
+				Total:     len(references),
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// Encrypt node with given key unless it is encrypted with it already, deleted nodes are skipped
+func (storage *EncryptedStorage) rotateNode(reference string, keyID string) (bool, error) {
+	node, err := storage.GetByReference(reference)
+	if err != nil || node == nil {
+		return false, err
+	}
+
+	encryptedNode := node.(*EncryptedNode)
+	rotated := false
+
+	contentKeyID, err := encryptedNode.GetContentKeyID()
+	if err != nil {
+		return false, err
+	}
+
+	if contentKeyID != "" && contentKeyID != keyID {
+		// Node may be deleted after it was loaded
+		err = encryptedNode.rotateContent()
+		if errors.Is(err, ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		rotated = true
+	}
+
+	// Metadata is loaded again, so that metadata set during content rotation is not replaced by previous value
+	if rotated {
+		node, err = storage.GetByReference(reference)
+		if err != nil || node == nil {
+			return false, err
+		}
+
+		encryptedNode = node.(*EncryptedNode)
+	}
+
+	metadataKeyID := encryptedNode.metadataKeyID
+
+	if (metadataKeyID != "" || storage.options.EncryptMetadata) && metadataKeyID != keyID {
+		encrypted, err := storage.encryptMetadataWith(encryptedNode.metadata, reference)
+		if err != nil {
+			return false, err
+		}
+
+		err = encryptedNode.setMetadata(encryptedNode.metadata, encrypted)
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		rotated = true
+	}
+
+	return rotated, nil
+}
+
+// Encrypt content again with current key, content is replaced on Close of wrapped writer
+func (node *EncryptedNode) rotateContent() error {
+	reader, err := node.GetReader()
+	if err != nil {
+		return err
+	}
+	defer closeReader(reader)
+
+	writer, err := node.GetWriteCloser()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, reader)
+	if err != nil {
+		abortWriter(writer)
+		return err
+	}
+
+	return writer.Close()
+}
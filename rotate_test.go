@@ -0,0 +1,121 @@
+package bloby
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateKeys(t *testing.T) {
+	testDirName := "test-file-storage-TestRotateKeys"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 32)
+
+	fileStorage := NewFileStorage(testDirName)
+
+	storage := NewEncryptedStorage(fileStorage, NewStaticKeyProvider("1", map[string][]byte{"1": key1}))
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	content := bytes.Repeat([]byte("meow "), encryptionChunkSize/2)
+
+	for _, name := range []string{"cats", "more cats", "even more cats"} {
+		node, err := storage.Create(name, map[string]interface{}{"name": name})
+		assert.NoError(t, err)
+
+		writer, err := node.(*EncryptedNode).GetWriteCloser()
+		assert.NoError(t, err)
+		writer.Write(content)
+		assert.NoError(t, writer.Close())
+	}
+
+	// Node without content
+	_, err = storage.Create("empty", nil)
+	assert.NoError(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	storage = NewEncryptedStorageWithOptions(fileStorage, NewStaticKeyProvider("2", map[string][]byte{"1": key1, "2": key2}), EncryptedStorageOptions{EncryptMetadata: true})
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	// Interrupted rotation
+	ctx, cancel := context.WithCancel(context.Background())
+
+	report, err := storage.RotateKeysContext(ctx, RotateOptions{
+		Progress: func(progress RotateProgress) {
+			cancel()
+		},
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, report.Rotated+report.Skipped)
+
+	progress := make([]RotateProgress, 0)
+
+	report, err = storage.RotateKeys(RotateOptions{
+		Progress: func(p RotateProgress) {
+			progress = append(progress, p)
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Rotated)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Len(t, progress, 4)
+	assert.Equal(t, RotateProgress{Reference: progress[3].Reference, Rotated: progress[3].Rotated, Done: 4, Total: 4}, progress[3])
+
+	// Completed rotation is not repeated
+	report, err = storage.RotateKeys(RotateOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Rotated)
+	assert.Equal(t, 4, report.Skipped)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Previous key is no longer needed
+	storage = NewEncryptedStorage(fileStorage, NewStaticKeyProvider("2", map[string][]byte{"2": key2}))
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	nodes, err := storage.ListBy("", "")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 4)
+
+	for _, node := range nodes {
+		encryptedNode := node.(*EncryptedNode)
+		assert.Equal(t, "2", encryptedNode.GetMetadataKeyID())
+
+		if node.GetName() == "empty" {
+			assert.Nil(t, node.GetMetadata())
+			continue
+		}
+
+		assert.Equal(t, map[string]interface{}{"name": node.GetName()}, node.GetMetadata())
+
+		keyID, err := encryptedNode.GetContentKeyID()
+		assert.NoError(t, err)
+		assert.Equal(t, "2", keyID)
+
+		reader, err := encryptedNode.GetReader()
+		assert.NoError(t, err)
+
+		result, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(content, result))
+
+		reader.(io.Closer).Close()
+	}
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,42 @@
+package bloby
+
+import "time"
+
+// Node with system attributes maintained by storage
+type StatNode interface {
+	// Content size in bytes, 0 for nodes without content
+	GetSize() int64
+	// Zero time for nodes created before attributes were recorded
+	GetCreatedAt() time.Time
+	// Time of last change of name, metadata, content type or content
+	GetUpdatedAt() time.Time
+	// Empty string if content type is not set
+	GetContentType() string
+}
+
+type ContentTypeMutable interface {
+	SetContentType(contentType string) error
+}
+
+// Node with creation and modification time that can be restored, used by Import
+type TimesMutable interface {
+	// Zero time leaves attribute unchanged
+	SetTimes(createdAt time.Time, updatedAt time.Time) error
+}
+
+// Timestamps are stored as unix nanoseconds, 0 is used for unknown time
+func timeToUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func unixNanoToTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n)
+}
@@ -0,0 +1,1102 @@
+// Package storagetest provides conformance test suite for bloby.Storage implementations.
+package storagetest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrate16/bloby"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run conformance scenarios against storage implementation.
+//
+// factory must return new empty storage in closed state for each call.
+func RunConformance(t *testing.T, factory func() bloby.Storage) {
+	t.Run("OpenClose", func(t *testing.T) {
+		testOpenClose(t, factory())
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		testCreate(t, factory())
+	})
+
+	t.Run("List", func(t *testing.T) {
+		testList(t, factory())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		testDelete(t, factory())
+	})
+
+	t.Run("DeleteBy", func(t *testing.T) {
+		testDeleteBy(t, factory())
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		testRename(t, factory())
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		testMetadata(t, factory())
+	})
+
+	t.Run("FileIO", func(t *testing.T) {
+		testFileIO(t, factory())
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		testPages(t, factory())
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		testQuery(t, factory())
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		testTransaction(t, factory())
+	})
+
+	t.Run("CreateOrReplace", func(t *testing.T) {
+		testCreateOrReplace(t, factory())
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		testStat(t, factory())
+	})
+}
+
+// Check a fully contains b with repeats
+func checkFullContains(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	c := make([]bool, len(a))
+
+	for ax := range len(a) {
+		for bx := range len(b) {
+			if !c[bx] && a[ax] == b[bx] {
+				c[bx] = true
+				break
+			}
+		}
+	}
+
+	for index := range len(c) {
+		if !c[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchName(name string, namePrefix string, namePostfix string) bool {
+	return strings.HasPrefix(name, namePrefix) && strings.HasSuffix(name[len(namePrefix):], namePostfix)
+}
+
+func nodesToNames(nodes []bloby.Node) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.GetName())
+	}
+
+	return names
+}
+
+func nodesToReferences(nodes []bloby.Node) []string {
+	references := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		references = append(references, node.GetReference())
+	}
+
+	return references
+}
+
+func checkListed(t *testing.T, storage bloby.Storage, names []string, references []string) {
+	nodes, err := storage.ListBy("", "")
+	assert.NoError(t, err)
+	assert.True(t, checkFullContains(names, nodesToNames(nodes)), "listed names must match")
+	assert.True(t, checkFullContains(references, nodesToReferences(nodes)), "listed references must match")
+}
+
+func openStorage(t *testing.T, storage bloby.Storage) {
+	require.NotNil(t, storage)
+	require.NoError(t, storage.Open())
+
+	t.Cleanup(func() {
+		storage.Close()
+	})
+}
+
+func createNodes(t *testing.T, storage bloby.Storage, names []string) []string {
+	references := make([]string, 0, len(names))
+
+	for index, name := range names {
+		node, err := storage.Create(
+			name,
+			map[string]interface{}{
+				"name":  name,
+				"index": index,
+			},
+		)
+		require.NoError(t, err)
+		require.NotNil(t, node)
+		assert.Equal(t, name, node.GetName())
+		assert.NotNil(t, node.GetMetadata())
+
+		references = append(references, node.GetReference())
+	}
+
+	return references
+}
+
+func testOpenClose(t *testing.T, storage bloby.Storage) {
+	require.NotNil(t, storage)
+
+	// Closed storage rejects operations
+	_, err := storage.Create("AAAAAAAA", nil)
+	assert.ErrorIs(t, err, bloby.ErrClosed)
+
+	err = storage.Close()
+	assert.ErrorIs(t, err, bloby.ErrClosed)
+
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	err = storage.Open()
+	assert.ErrorIs(t, err, bloby.ErrAlreadyOpen)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	_, err = storage.ListBy("", "")
+	assert.ErrorIs(t, err, bloby.ErrClosed)
+
+	// Nodes of closed storage reject content access
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("AAAAAAAA", nil)
+	require.NoError(t, err)
+
+	closeWritable, ok := node.(bloby.CloseWritable)
+	if !ok {
+		assert.NoError(t, storage.Close())
+		t.Skip("node does not implement bloby.CloseWritable")
+	}
+
+	readable, ok := node.(bloby.Readable)
+	if !ok {
+		assert.NoError(t, storage.Close())
+		t.Skip("node does not implement bloby.Readable")
+	}
+
+	writer, err := closeWritable.GetWriteCloser()
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte("meow"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	writer, err = closeWritable.GetWriteCloser()
+	require.NoError(t, err)
+
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	// Write started before Close is not committed
+	_, err = writer.Write([]byte("purr"))
+	if err == nil {
+		err = writer.Close()
+	}
+	assert.ErrorIs(t, err, bloby.ErrClosed)
+
+	_, err = readable.GetReader()
+	assert.ErrorIs(t, err, bloby.ErrClosed)
+
+	_, err = closeWritable.GetWriteCloser()
+	assert.ErrorIs(t, err, bloby.ErrClosed)
+}
+
+func testCreate(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	node1, err := storage.Create(
+		"AAAAAAAA",
+		map[string]interface{}{
+			"size":   "1K",
+			"amount": 13,
+			"tags":   []string{"big", "tasty"},
+		},
+	)
+	require.NoError(t, err)
+	require.NotNil(t, node1)
+	assert.Equal(t, "AAAAAAAA", node1.GetName())
+	assert.NotNil(t, node1.GetMetadata())
+
+	node2, err := storage.Create("BBBBBBBB", nil)
+	require.NoError(t, err)
+	require.NotNil(t, node2)
+	assert.Equal(t, "BBBBBBBB", node2.GetName())
+	assert.Nil(t, node2.GetMetadata())
+
+	assert.NotEqual(t, node1.GetReference(), node2.GetReference())
+
+	node, err := storage.GetByName("AAAAAAAA")
+	assert.NoError(t, err)
+	require.NotNil(t, node)
+	assert.Equal(t, node1.GetReference(), node.GetReference())
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"size":   "1K",
+			"amount": 13.0,
+			"tags":   []interface{}{"big", "tasty"},
+		},
+		node.GetMetadata(),
+	)
+
+	node, err = storage.GetByReference(node2.GetReference())
+	assert.NoError(t, err)
+	require.NotNil(t, node)
+	assert.Equal(t, "BBBBBBBB", node.GetName())
+	assert.Nil(t, node.GetMetadata())
+
+	// Missing nodes
+	node, err = storage.GetByName("CCCCCCCC")
+	assert.NoError(t, err)
+	assert.Nil(t, node)
+
+	node, err = storage.GetByReference("NOEXISTENTREFERENCE")
+	assert.NoError(t, err)
+	assert.Nil(t, node)
+
+	exists, err := storage.ExistsByName("AAAAAAAA")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = storage.ExistsByName("CCCCCCCC")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = storage.ExistsByReference(node2.GetReference())
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = storage.ExistsByReference("NOEXISTENTREFERENCE")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Persistency check
+	err = storage.Close()
+	assert.NoError(t, err)
+
+	err = storage.Open()
+	assert.NoError(t, err)
+
+	exists, err = storage.ExistsByName("AAAAAAAA")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = storage.ExistsByReference(node2.GetReference())
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func testList(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	names := []string{
+		"a", "da", "ac", "ab", "dab", "acb", "ab", "dab", "acb", "aa", "daa", "aca",
+		"aab", "daab", "acab", "aba", "daba", "acba", "aaa", "daaa", "", " ", "b",
+	}
+	references := createNodes(t, storage, names)
+
+	pairs := [][]string{
+		{"", ""},
+		{"a", ""},
+		{"ab", ""},
+		{"", "b"},
+		{"a", "b"},
+		{"a", "a"},
+		{"zzz", ""},
+	}
+
+	for _, pair := range pairs {
+		var expectedNames []string
+		var expectedReferences []string
+
+		for index, name := range names {
+			if matchName(name, pair[0], pair[1]) {
+				expectedNames = append(expectedNames, name)
+				expectedReferences = append(expectedReferences, references[index])
+			}
+		}
+
+		nodes, err := storage.ListBy(pair[0], pair[1])
+		assert.NoError(t, err)
+		assert.NotNil(t, nodes)
+		assert.True(t, checkFullContains(expectedNames, nodesToNames(nodes)), "ListBy(%q, %q) names", pair[0], pair[1])
+		assert.True(t, checkFullContains(expectedReferences, nodesToReferences(nodes)), "ListBy(%q, %q) references", pair[0], pair[1])
+
+		listedReferences, err := storage.ListReferences(pair[0], pair[1])
+		assert.NoError(t, err)
+		assert.NotNil(t, listedReferences)
+		assert.True(t, checkFullContains(expectedReferences, listedReferences), "ListReferences(%q, %q)", pair[0], pair[1])
+	}
+
+	// Prefix and postfix follow SQL like: `_` and `%` are wildcards and ASCII letters match regardless of case
+	require.NoError(t, storage.DeleteBy("", ""))
+	createNodes(t, storage, []string{"Apple", "a_b", "axb", "b%c", "bxc", "Ärger", "är"})
+
+	patterns := []struct {
+		prefix   string
+		postfix  string
+		expected []string
+	}{
+		{"a", "", []string{"Apple", "a_b", "axb"}},
+		{"a_", "", []string{"Apple", "a_b", "axb"}},
+		{"", "_b", []string{"a_b", "axb"}},
+		{"", "B", []string{"a_b", "axb"}},
+		{"b%", "", []string{"b%c", "bxc"}},
+		{"ax", "", []string{"axb"}},
+		{"_r", "", []string{"Ärger", "är"}},
+		{"ä", "", []string{"är"}},
+	}
+
+	for _, pattern := range patterns {
+		nodes, err := storage.ListBy(pattern.prefix, pattern.postfix)
+		assert.NoError(t, err)
+		assert.True(t, checkFullContains(pattern.expected, nodesToNames(nodes)), "ListBy(%q, %q) names %v", pattern.prefix, pattern.postfix, nodesToNames(nodes))
+	}
+}
+
+func testDelete(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	names := []string{
+		"aaaaaaaa", "aaaaaaaa", "aaaaaaaa", "bbbbbbbb", "bbbbbbbb", "cccccccc",
+		"dddddddd", "dddddddd", "eeeeeeee", "", "", " ",
+	}
+	references := createNodes(t, storage, names)
+
+	deletions := []int{len(names) - 1, 0, 1, 5, 3, 2, 4, 1, 1, 0}
+
+	for _, index := range deletions {
+		err := storage.Delete(references[index])
+		assert.NoError(t, err)
+
+		exists, err := storage.ExistsByReference(references[index])
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		names = append(names[:index], names[index+1:]...)
+		references = append(references[:index], references[index+1:]...)
+
+		checkListed(t, storage, names, references)
+	}
+
+	// Missing node
+	err := storage.Delete("missing")
+	assert.ErrorIs(t, err, bloby.ErrNotFound)
+}
+
+func testDeleteBy(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	names := []string{
+		"aaaaaaaa", "aaaaaaaa", "bbbbbbbb", "cccccccc", "aaaabbbb", "aaaabbbb",
+		"ccccbbbb", "ddddbbbb", "gggggggg", "", "", " ",
+	}
+	references := createNodes(t, storage, names)
+
+	deletions := [][]string{
+		{"aa", "aaaaaa"},
+		{"ggggggg", "g"},
+		{"", "bb"},
+		{"", "a"},
+		{"", ""},
+	}
+
+	for _, pair := range deletions {
+		err := storage.DeleteBy(pair[0], pair[1])
+		assert.NoError(t, err)
+
+		newNames := make([]string, 0)
+		newReferences := make([]string, 0)
+
+		for index, name := range names {
+			if !matchName(name, pair[0], pair[1]) {
+				newNames = append(newNames, name)
+				newReferences = append(newReferences, references[index])
+			}
+		}
+
+		names = newNames
+		references = newReferences
+
+		checkListed(t, storage, names, references)
+	}
+}
+
+func testRename(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	node, err := storage.Create("AAAAAAAA", nil)
+	require.NoError(t, err)
+
+	mutableNode, ok := node.(bloby.Mutable)
+	if !ok {
+		t.Skip("node does not implement bloby.Mutable")
+	}
+
+	err = mutableNode.SetName("BBBBBBBB")
+	assert.NoError(t, err)
+	assert.Equal(t, "BBBBBBBB", node.GetName())
+
+	nodeRequeried, err := storage.GetByReference(node.GetReference())
+	assert.NoError(t, err)
+	require.NotNil(t, nodeRequeried)
+	assert.Equal(t, "BBBBBBBB", nodeRequeried.GetName())
+
+	nodeRequeried, err = storage.GetByName("BBBBBBBB")
+	assert.NoError(t, err)
+	require.NotNil(t, nodeRequeried)
+	assert.Equal(t, node.GetReference(), nodeRequeried.GetReference())
+
+	nodeRequeried, err = storage.GetByName("AAAAAAAA")
+	assert.NoError(t, err)
+	assert.Nil(t, nodeRequeried)
+
+	exists, err := storage.ExistsByName("AAAAAAAA")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Deleted node
+	err = storage.Delete(node.GetReference())
+	require.NoError(t, err)
+
+	err = mutableNode.SetName("CCCCCCCC")
+	assert.ErrorIs(t, err, bloby.ErrNotFound)
+}
+
+func testMetadata(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	node, err := storage.Create("AAAAAAAA", map[string]interface{}{"amount": 13})
+	require.NoError(t, err)
+
+	mutableNode, ok := node.(bloby.Mutable)
+	if !ok {
+		t.Skip("node does not implement bloby.Mutable")
+	}
+
+	values := []interface{}{"string metadata", nil, 9.1, nil, map[string]interface{}{"tags": []interface{}{"a"}}}
+
+	for _, value := range values {
+		err = mutableNode.SetMetadata(value)
+		assert.NoError(t, err)
+		assert.Equal(t, value, node.GetMetadata())
+
+		nodeRequeried, err := storage.GetByReference(node.GetReference())
+		assert.NoError(t, err)
+		require.NotNil(t, nodeRequeried)
+		assert.Equal(t, value, nodeRequeried.GetMetadata())
+	}
+}
+
+func testFileIO(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	node, err := storage.Create("cats", nil)
+	require.NoError(t, err)
+
+	writable, ok := node.(bloby.Writable)
+	if !ok {
+		t.Skip("node does not implement bloby.Writable")
+	}
+
+	readable, ok := node.(bloby.Readable)
+	if !ok {
+		t.Skip("node does not implement bloby.Readable")
+	}
+
+	write := func(writer io.Writer, err error, content string) {
+		require.NoError(t, err)
+
+		_, err = writer.Write([]byte(content))
+		assert.NoError(t, err)
+
+		if closeable, ok := writer.(io.Closer); ok {
+			assert.NoError(t, closeable.Close())
+		}
+	}
+
+	read := func() string {
+		reader, err := readable.GetReader()
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+
+		if closeable, ok := reader.(io.Closer); ok {
+			closeable.Close()
+		}
+
+		return string(content)
+	}
+
+	// Node without content
+	reader, err := readable.GetReader()
+	assert.Nil(t, reader)
+	assert.ErrorIs(t, err, bloby.ErrNotFound)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	writer, err := writable.GetWriter()
+	write(writer, err, "meow")
+	assert.Equal(t, "meow", read())
+
+	// Rewrite truncates content
+	writer, err = writable.GetWriter()
+	write(writer, err, "mew")
+	assert.Equal(t, "mew", read())
+
+	// Content is available through requeried node
+	nodeRequeried, err := storage.GetByReference(node.GetReference())
+	require.NoError(t, err)
+	require.NotNil(t, nodeRequeried)
+
+	reader, err = nodeRequeried.(bloby.Readable).GetReader()
+	require.NoError(t, err)
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "mew", string(content))
+
+	if closeable, ok := reader.(io.Closer); ok {
+		closeable.Close()
+	}
+
+	// Closeable writer
+	if closeWritable, ok := node.(bloby.CloseWritable); ok {
+		writer, err := closeWritable.GetWriteCloser()
+		write(writer, err, "meow meow")
+		assert.Equal(t, "meow meow", read())
+	}
+
+	// Random access reader
+	if seekReadable, ok := node.(bloby.SeekReadable); ok {
+		writer, err := writable.GetWriter()
+		write(writer, err, "0123456789")
+
+		reader, err := seekReadable.GetSeekReader()
+		require.NoError(t, err)
+		defer reader.Close()
+
+		offset, err := reader.Seek(3, io.SeekStart)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), offset)
+
+		buffer := make([]byte, 4)
+		_, err = io.ReadFull(reader, buffer)
+		assert.NoError(t, err)
+		assert.Equal(t, "3456", string(buffer))
+
+		_, err = reader.ReadAt(buffer[:2], 8)
+		assert.NoError(t, err)
+		assert.Equal(t, "89", string(buffer[:2]))
+
+		size, err := reader.Seek(0, io.SeekEnd)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), size)
+	}
+}
+
+func testPages(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	pageListable, ok := storage.(bloby.PageListable)
+	if !ok {
+		t.Skip("storage does not implement bloby.PageListable")
+	}
+
+	names := []string{"b", "a", "c", "a", "d", "ab", "e", "a", "f", "x"}
+	references := createNodes(t, storage, names)
+
+	for _, order := range []bloby.ListOrder{bloby.OrderByName, bloby.OrderByReference} {
+		for _, limit := range []int{0, 1, 2, 3, 9, 10, 100} {
+			options := bloby.ListOptions{
+				Order: order,
+				Limit: limit,
+			}
+
+			listedNames := make([]string, 0)
+			listedReferences := make([]string, 0)
+			pages := 0
+
+			for {
+				page, err := pageListable.ListPage(options)
+				require.NoError(t, err)
+
+				if limit > 0 {
+					assert.LessOrEqual(t, len(page.Nodes), limit)
+				}
+
+				listedNames = append(listedNames, nodesToNames(page.Nodes)...)
+				listedReferences = append(listedReferences, nodesToReferences(page.Nodes)...)
+				pages++
+
+				if page.Cursor == "" {
+					break
+				}
+
+				options.Cursor = page.Cursor
+				require.Less(t, pages, 100, "pagination does not terminate")
+			}
+
+			assert.True(t, checkFullContains(names, listedNames), "order %d limit %d names", order, limit)
+			assert.True(t, checkFullContains(references, listedReferences), "order %d limit %d references", order, limit)
+
+			// Check ordering
+			for index := 1; index < len(listedNames); index++ {
+				if order == bloby.OrderByName {
+					assert.True(
+						t,
+						listedNames[index-1] < listedNames[index] || (listedNames[index-1] == listedNames[index] && listedReferences[index-1] < listedReferences[index]),
+						"nodes must be ordered by name",
+					)
+				} else {
+					assert.Less(t, listedReferences[index-1], listedReferences[index], "nodes must be ordered by reference")
+				}
+			}
+		}
+	}
+
+	// Filtered walk
+	walked := make([]string, 0)
+	err := pageListable.Walk(
+		bloby.ListOptions{NamePrefix: "a", Limit: 2},
+		func(node bloby.Node) error {
+			walked = append(walked, node.GetName())
+			return nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "a", "a", "ab"}, walked)
+
+	// Callback error stops walk
+	stop := errors.New("stop")
+	walked = make([]string, 0)
+	err = pageListable.Walk(
+		bloby.ListOptions{},
+		func(node bloby.Node) error {
+			walked = append(walked, node.GetName())
+			if len(walked) == 3 {
+				return stop
+			}
+
+			return nil
+		},
+	)
+	assert.ErrorIs(t, err, stop)
+	assert.Len(t, walked, 3)
+
+	// Cursor of other order is rejected
+	page, err := pageListable.ListPage(bloby.ListOptions{Order: bloby.OrderByName, Limit: 1})
+	require.NoError(t, err)
+
+	_, err = pageListable.ListPage(bloby.ListOptions{Order: bloby.OrderByReference, Limit: 1, Cursor: page.Cursor})
+	assert.Error(t, err)
+}
+
+func testQuery(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	queryable, ok := storage.(bloby.Queryable)
+	if !ok {
+		t.Skip("storage does not implement bloby.Queryable")
+	}
+
+	metadatas := []interface{}{
+		map[string]interface{}{"owner": "alice", "type": "image", "size": 10, "tags": []string{"a", "b"}, "public": true},
+		map[string]interface{}{"owner": "bob", "type": "image", "size": 20, "public": false},
+		map[string]interface{}{"owner": "alice", "type": "text", "size": 5, "nested": map[string]interface{}{"level": 2}},
+		nil,
+		"string metadata",
+		map[string]interface{}{"owner": nil, "size": "big"},
+	}
+
+	names := []string{"n0", "n1", "n2", "n3", "n4", "x5"}
+
+	for index, name := range names {
+		_, err := storage.Create(name, metadatas[index])
+		require.NoError(t, err)
+	}
+
+	cases := []struct {
+		prefix     string
+		conditions []bloby.Condition
+		expected   []string
+	}{
+		{"", []bloby.Condition{{Path: "owner", Op: bloby.OpEqual, Value: "alice"}}, []string{"n0", "n2"}},
+		{"", []bloby.Condition{{Path: "owner", Op: bloby.OpNotEqual, Value: "alice"}}, []string{"n1"}},
+		{"", []bloby.Condition{{Path: "size", Op: bloby.OpGreater, Value: 5}}, []string{"n0", "n1", "x5"}},
+		{"", []bloby.Condition{{Path: "size", Op: bloby.OpGreaterOrEqual, Value: 5}, {Path: "size", Op: bloby.OpLess, Value: 20.0}}, []string{"n0", "n2"}},
+		{"", []bloby.Condition{{Path: "size", Op: bloby.OpLessOrEqual, Value: int64(10)}}, []string{"n0", "n2"}},
+		{"", []bloby.Condition{{Path: "owner", Op: bloby.OpExists}}, []string{"n0", "n1", "n2", "x5"}},
+		{"", []bloby.Condition{{Path: "owner", Op: bloby.OpNotExists}}, []string{"n3", "n4"}},
+		{"", []bloby.Condition{{Path: "type", Op: bloby.OpIn, Values: []interface{}{"image", "video"}}}, []string{"n0", "n1"}},
+		{"", []bloby.Condition{{Path: "type", Op: bloby.OpIn}}, []string{}},
+		{"", []bloby.Condition{{Path: "public", Op: bloby.OpEqual, Value: true}}, []string{"n0"}},
+		{"", []bloby.Condition{{Path: "public", Op: bloby.OpEqual, Value: false}}, []string{"n1"}},
+		{"", []bloby.Condition{{Path: "tags[1]", Op: bloby.OpEqual, Value: "b"}}, []string{"n0"}},
+		{"", []bloby.Condition{{Path: "nested.level", Op: bloby.OpGreaterOrEqual, Value: 2}}, []string{"n2"}},
+		{"x", []bloby.Condition{{Path: "size", Op: bloby.OpExists}}, []string{"x5"}},
+		{"n", nil, []string{"n0", "n1", "n2", "n3", "n4"}},
+	}
+
+	for _, testCase := range cases {
+		nodes, err := queryable.Query(testCase.prefix, "", testCase.conditions...)
+		assert.NoError(t, err)
+		assert.True(t, checkFullContains(testCase.expected, nodesToNames(nodes)), "%+v: got %v", testCase.conditions, nodesToNames(nodes))
+
+		if pageListable, ok := storage.(bloby.PageListable); ok {
+			page, err := pageListable.ListPage(bloby.ListOptions{NamePrefix: testCase.prefix, Where: testCase.conditions})
+			assert.NoError(t, err)
+			assert.True(t, checkFullContains(testCase.expected, nodesToNames(page.Nodes)), "page %+v: got %v", testCase.conditions, nodesToNames(page.Nodes))
+		}
+	}
+
+	// Invalid conditions
+	_, err := queryable.Query("", "", bloby.Condition{Path: "owner') or 1 or ('", Op: bloby.OpExists})
+	assert.Error(t, err)
+
+	_, err = queryable.Query("", "", bloby.Condition{Path: "owner", Op: bloby.OpEqual, Value: []string{"alice"}})
+	assert.Error(t, err)
+
+	_, err = queryable.Query("", "", bloby.Condition{Path: "owner", Op: bloby.Operator(-1)})
+	assert.Error(t, err)
+}
+
+func testTransaction(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	transactional, ok := storage.(bloby.Transactional)
+	if !ok {
+		t.Skip("storage does not implement bloby.Transactional")
+	}
+
+	current, err := storage.Create("current", map[string]interface{}{"version": 1})
+	require.NoError(t, err)
+
+	next, err := storage.Create("next", map[string]interface{}{"version": 2})
+	require.NoError(t, err)
+
+	if writable, ok := next.(bloby.Writable); ok {
+		writer, err := writable.GetWriter()
+		require.NoError(t, err)
+
+		_, err = writer.Write([]byte("meow"))
+		assert.NoError(t, err)
+
+		if closeable, ok := writer.(io.Closer); ok {
+			assert.NoError(t, closeable.Close())
+		}
+	}
+
+	// Replace node atomically
+	var created bloby.Node
+
+	err = transactional.Transaction(func(tx bloby.Tx) error {
+		err := tx.Delete(current.GetReference())
+		if err != nil {
+			return err
+		}
+
+		err = tx.SetName(next.GetReference(), "current")
+		if err != nil {
+			return err
+		}
+
+		err = tx.SetMetadata(next.GetReference(), map[string]interface{}{"version": 3})
+		if err != nil {
+			return err
+		}
+
+		exists, err := tx.ExistsByReference(current.GetReference())
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		node, err := tx.GetByName("current")
+		assert.NoError(t, err)
+		require.NotNil(t, node)
+		assert.Equal(t, next.GetReference(), node.GetReference())
+
+		created, err = tx.Create("log", nil)
+		return err
+	})
+	assert.NoError(t, err)
+
+	checkListed(t, storage, []string{"current", "log"}, []string{next.GetReference(), created.GetReference()})
+
+	node, err := storage.GetByName("current")
+	assert.NoError(t, err)
+	require.NotNil(t, node)
+	assert.Equal(t, map[string]interface{}{"version": float64(3)}, node.GetMetadata())
+
+	if readable, ok := node.(bloby.Readable); ok {
+		reader, err := readable.GetReader()
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "meow", string(content))
+
+		if closeable, ok := reader.(io.Closer); ok {
+			closeable.Close()
+		}
+	}
+
+	// Error rolls back all changes
+	failure := errors.New("failure")
+	var leakedTx bloby.Tx
+
+	err = transactional.Transaction(func(tx bloby.Tx) error {
+		leakedTx = tx
+
+		_, err := tx.Create("rolled back", nil)
+		assert.NoError(t, err)
+
+		assert.NoError(t, tx.SetName(next.GetReference(), "renamed"))
+		assert.NoError(t, tx.DeleteBy("", ""))
+
+		references, err := tx.ListReferences("", "")
+		assert.NoError(t, err)
+		assert.Empty(t, references)
+
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	checkListed(t, storage, []string{"current", "log"}, []string{next.GetReference(), created.GetReference()})
+
+	// Panic rolls back all changes
+	assert.Panics(t, func() {
+		transactional.Transaction(func(tx bloby.Tx) error {
+			tx.Delete(next.GetReference())
+			panic("failure")
+		})
+	})
+
+	checkListed(t, storage, []string{"current", "log"}, []string{next.GetReference(), created.GetReference()})
+
+	// Finished transaction can not be used
+	_, err = leakedTx.Create("leaked", nil)
+	assert.ErrorIs(t, err, bloby.ErrTxDone)
+
+	// Missing nodes
+	err = transactional.Transaction(func(tx bloby.Tx) error {
+		return tx.SetName("missing", "missing")
+	})
+	assert.ErrorIs(t, err, bloby.ErrNotFound)
+}
+
+func testCreateOrReplace(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	replaceable, ok := storage.(bloby.Replaceable)
+	if !ok {
+		t.Skip("storage does not implement bloby.Replaceable")
+	}
+
+	node1, err := replaceable.CreateOrReplace("cats", map[string]interface{}{"amount": 1})
+	require.NoError(t, err)
+	require.NotNil(t, node1)
+	assert.Equal(t, "cats", node1.GetName())
+
+	node2, err := replaceable.CreateOrReplace("cats", map[string]interface{}{"amount": 2})
+	require.NoError(t, err)
+	require.NotNil(t, node2)
+	assert.Equal(t, node1.GetReference(), node2.GetReference())
+	assert.Equal(t, map[string]interface{}{"amount": 2}, node2.GetMetadata())
+
+	node3, err := replaceable.CreateOrReplace("dogs", nil)
+	require.NoError(t, err)
+	require.NotNil(t, node3)
+	assert.NotEqual(t, node1.GetReference(), node3.GetReference())
+
+	checkListed(t, storage, []string{"cats", "dogs"}, []string{node1.GetReference(), node3.GetReference()})
+
+	node, err := storage.GetByName("cats")
+	assert.NoError(t, err)
+	require.NotNil(t, node)
+	assert.Equal(t, map[string]interface{}{"amount": float64(2)}, node.GetMetadata())
+
+	if transactional, ok := storage.(bloby.Transactional); ok {
+		err = transactional.Transaction(func(tx bloby.Tx) error {
+			node, err := tx.CreateOrReplace("dogs", map[string]interface{}{"amount": 3})
+			assert.NoError(t, err)
+			assert.Equal(t, node3.GetReference(), node.GetReference())
+
+			return nil
+		})
+		assert.NoError(t, err)
+
+		node, err = storage.GetByName("dogs")
+		assert.NoError(t, err)
+		require.NotNil(t, node)
+		assert.Equal(t, map[string]interface{}{"amount": float64(3)}, node.GetMetadata())
+	}
+}
+
+func testStat(t *testing.T, storage bloby.Storage) {
+	openStorage(t, storage)
+
+	node, err := storage.Create("cats", nil)
+	require.NoError(t, err)
+
+	stat, ok := node.(bloby.StatNode)
+	if !ok {
+		t.Skip("storage nodes do not implement bloby.StatNode")
+	}
+
+	writable, ok := node.(bloby.Writable)
+	if !ok {
+		t.Skip("node does not implement bloby.Writable")
+	}
+
+	mutable, ok := node.(bloby.Mutable)
+	if !ok {
+		t.Skip("node does not implement bloby.Mutable")
+	}
+
+	loadStat := func() bloby.StatNode {
+		loaded, err := storage.GetByReference(node.GetReference())
+		require.NoError(t, err)
+
+		stat, ok := loaded.(bloby.StatNode)
+		require.True(t, ok, "loaded node does not implement bloby.StatNode")
+
+		return stat
+	}
+
+	assert.Equal(t, int64(0), stat.GetSize())
+	assert.False(t, stat.GetCreatedAt().IsZero())
+	assert.Equal(t, stat.GetCreatedAt(), stat.GetUpdatedAt())
+	assert.Empty(t, stat.GetContentType())
+
+	createdAt := stat.GetCreatedAt()
+
+	// Writes update size and modification time
+	time.Sleep(time.Millisecond)
+
+	writer, err := writable.GetWriter()
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("meow meow"))
+	assert.NoError(t, err)
+	if closeable, ok := writer.(io.Closer); ok {
+		assert.NoError(t, closeable.Close())
+	}
+
+	assert.Equal(t, int64(9), stat.GetSize())
+	assert.True(t, stat.GetUpdatedAt().After(createdAt))
+
+	writtenAt := stat.GetUpdatedAt()
+
+	// Attributes are persisted
+	loaded := loadStat()
+	assert.Equal(t, int64(9), loaded.GetSize())
+	assert.True(t, loaded.GetCreatedAt().Equal(createdAt))
+	assert.True(t, loaded.GetUpdatedAt().Equal(writtenAt))
+
+	// Name, metadata and content type changes update modification time
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, mutable.SetName("more cats"))
+	assert.True(t, stat.GetUpdatedAt().After(writtenAt))
+
+	renamedAt := stat.GetUpdatedAt()
+
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, mutable.SetMetadata("meow"))
+	assert.True(t, stat.GetUpdatedAt().After(renamedAt))
+
+	if contentTypeMutable, ok := node.(bloby.ContentTypeMutable); ok {
+		assert.NoError(t, contentTypeMutable.SetContentType("text/plain"))
+		assert.Equal(t, "text/plain", stat.GetContentType())
+
+		loaded = loadStat()
+		assert.Equal(t, "text/plain", loaded.GetContentType())
+	}
+
+	assert.True(t, loaded.GetCreatedAt().Equal(createdAt))
+
+	// Restored times are persisted, zero time is left unchanged
+	if timesMutable, ok := node.(bloby.TimesMutable); ok {
+		restoredAt := createdAt.Add(-time.Hour)
+		assert.NoError(t, timesMutable.SetTimes(restoredAt, time.Time{}))
+		assert.True(t, stat.GetCreatedAt().Equal(restoredAt))
+
+		loaded = loadStat()
+		assert.True(t, loaded.GetCreatedAt().Equal(restoredAt))
+		assert.True(t, loaded.GetUpdatedAt().Equal(stat.GetUpdatedAt()))
+	}
+
+	pageListable, ok := storage.(bloby.PageListable)
+	if !ok {
+		return
+	}
+
+	// Filters and sort keys
+	small, err := storage.Create("small", nil)
+	require.NoError(t, err)
+
+	smallWritable, ok := small.(bloby.Writable)
+	require.True(t, ok, "node does not implement bloby.Writable")
+
+	smallStat, ok := small.(bloby.StatNode)
+	require.True(t, ok, "node does not implement bloby.StatNode")
+
+	writer, err = smallWritable.GetWriter()
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("purr"))
+	assert.NoError(t, err)
+	if closeable, ok := writer.(io.Closer); ok {
+		assert.NoError(t, closeable.Close())
+	}
+
+	time.Sleep(time.Millisecond)
+
+	empty, err := storage.Create("empty", nil)
+	require.NoError(t, err)
+
+	list := func(options bloby.ListOptions) []string {
+		references := make([]string, 0)
+
+		err := pageListable.Walk(options, func(node bloby.Node) error {
+			references = append(references, node.GetReference())
+			return nil
+		})
+		require.NoError(t, err)
+
+		return references
+	}
+
+	assert.Equal(t, []string{empty.GetReference(), small.GetReference(), node.GetReference()}, list(bloby.ListOptions{Order: bloby.OrderBySize, Limit: 1}))
+	assert.Equal(t, []string{node.GetReference(), small.GetReference(), empty.GetReference()}, list(bloby.ListOptions{Order: bloby.OrderBySize, Descending: true, Limit: 2}))
+	assert.Equal(t, []string{node.GetReference(), small.GetReference(), empty.GetReference()}, list(bloby.ListOptions{Order: bloby.OrderByCreatedAt}))
+	assert.Equal(t, []string{small.GetReference(), node.GetReference()}, list(bloby.ListOptions{Order: bloby.OrderBySize, MinSize: 1}))
+	assert.Equal(t, []string{empty.GetReference(), small.GetReference()}, list(bloby.ListOptions{Order: bloby.OrderBySize, MaxSize: 4}))
+	assert.Equal(t, []string{small.GetReference(), empty.GetReference()}, list(bloby.ListOptions{Order: bloby.OrderByCreatedAt, CreatedSince: smallStat.GetCreatedAt()}))
+	assert.Equal(t, []string{node.GetReference()}, list(bloby.ListOptions{Order: bloby.OrderByCreatedAt, CreatedBefore: smallStat.GetCreatedAt()}))
+
+	if _, ok := node.(bloby.ContentTypeMutable); ok {
+		assert.Equal(t, []string{node.GetReference()}, list(bloby.ListOptions{ContentType: "text/plain"}))
+	}
+}
@@ -0,0 +1,85 @@
+package storagetest_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrate16/bloby"
+	"github.com/bitrate16/bloby/storagetest"
+)
+
+func TestFileStorageConformance(t *testing.T) {
+	testDirName := t.TempDir()
+	count := 0
+
+	storagetest.RunConformance(t, func() bloby.Storage {
+		count++
+		return bloby.NewFileStorage(filepath.Join(testDirName, fmt.Sprint(count)))
+	})
+}
+
+func TestMemoryStorageConformance(t *testing.T) {
+	storagetest.RunConformance(t, func() bloby.Storage {
+		return bloby.NewMemoryStorage()
+	})
+}
+
+func TestContentAddressedFileStorageConformance(t *testing.T) {
+	testDirName := t.TempDir()
+	count := 0
+
+	storagetest.RunConformance(t, func() bloby.Storage {
+		count++
+		return bloby.NewFileStorageWithOptions(filepath.Join(testDirName, fmt.Sprint(count)), bloby.FileStorageOptions{ContentAddressed: true})
+	})
+}
+
+func TestSharedFileStorageConformance(t *testing.T) {
+	testDirName := t.TempDir()
+	count := 0
+
+	storagetest.RunConformance(t, func() bloby.Storage {
+		count++
+		return bloby.NewFileStorageWithOptions(filepath.Join(testDirName, fmt.Sprint(count)), bloby.FileStorageOptions{LockMode: bloby.LockShared})
+	})
+}
+
+func TestCompressedFileStorageConformance(t *testing.T) {
+	testDirName := t.TempDir()
+	count := 0
+
+	storagetest.RunConformance(t, func() bloby.Storage {
+		count++
+		return bloby.NewFileStorageWithOptions(filepath.Join(testDirName, fmt.Sprint(count)), bloby.FileStorageOptions{Compression: bloby.CodecGzip})
+	})
+}
+
+func TestCompressedContentAddressedFileStorageConformance(t *testing.T) {
+	testDirName := t.TempDir()
+	count := 0
+
+	storagetest.RunConformance(t, func() bloby.Storage {
+		count++
+		return bloby.NewFileStorageWithOptions(filepath.Join(testDirName, fmt.Sprint(count)), bloby.FileStorageOptions{ContentAddressed: true, Compression: bloby.CodecGzip})
+	})
+}
+
+func TestEncryptedFileStorageConformance(t *testing.T) {
+	testDirName := t.TempDir()
+	count := 0
+	keys := bloby.NewStaticKeyProvider("1", map[string][]byte{"1": make([]byte, 32)})
+
+	storagetest.RunConformance(t, func() bloby.Storage {
+		count++
+		return bloby.NewEncryptedStorageWithOptions(bloby.NewFileStorage(filepath.Join(testDirName, fmt.Sprint(count))), keys, bloby.EncryptedStorageOptions{EncryptMetadata: true})
+	})
+}
+
+func TestEncryptedMemoryStorageConformance(t *testing.T) {
+	keys := bloby.NewStaticKeyProvider("1", map[string][]byte{"1": make([]byte, 32)})
+
+	storagetest.RunConformance(t, func() bloby.Storage {
+		return bloby.NewEncryptedStorageWithOptions(bloby.NewMemoryStorage(), keys, bloby.EncryptedStorageOptions{EncryptMetadata: true})
+	})
+}
@@ -0,0 +1,29 @@
+package bloby
+
+import "context"
+
+// Storage operations executed in single transaction.
+//
+// Nodes returned by Tx must not be used until transaction is finished, nodes created in rolled back transaction do not exist.
+type Tx interface {
+	GetByReference(reference string) (Node, error)
+	GetByName(name string) (Node, error)
+	Create(name string, metadata interface{}) (Node, error)
+	CreateOrReplace(name string, metadata interface{}) (Node, error)
+	Delete(reference string) error
+	DeleteBy(namePrefix string, namePostfix string) error
+	ExistsByName(name string) (bool, error)
+	ExistsByReference(reference string) (bool, error)
+	ListBy(namePrefix string, namePostfix string) ([]Node, error)
+	ListReferences(namePrefix string, namePostfix string) ([]string, error)
+	SetName(reference string, name string) error
+	SetMetadata(reference string, metadata interface{}) error
+}
+
+// Storage with transactions.
+//
+// Changes made through tx are committed if fn returns nil and rolled back if fn returns error or panics.
+type Transactional interface {
+	Transaction(fn func(tx Tx) error) error
+	TransactionContext(ctx context.Context, fn func(tx Tx) error) error
+}
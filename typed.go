@@ -0,0 +1,289 @@
+package bloby
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+func checkTypedStorageIsNil[M any](storage *TypedStorage[M]) {
+	if storage == nil {
+		panic("storage is nil")
+	}
+}
+
+func checkTypedNodeIsNil[M any](node *TypedNode[M]) {
+	if node == nil {
+		panic("node is nil")
+	}
+}
+
+// Convert metadata returned by storage into M, JSON decoded values are converted through JSON round trip
+func decodeMetadata[M any](metadata interface{}) (M, error) {
+	var result M
+
+	if metadata == nil {
+		return result, nil
+	}
+
+	if typed, ok := metadata.(M); ok {
+		return typed, nil
+	}
+
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal(metadataBytes, &result)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Storage wrapper with metadata of type M.
+//
+// Metadata of loaded nodes is decoded into M, nodes with metadata not convertible into M produce errors.
+type TypedStorage[M any] struct {
+	storage Storage
+}
+
+func NewTypedStorage[M any](storage Storage) *TypedStorage[M] {
+	if storage == nil {
+		panic("storage is nil")
+	}
+
+	return &TypedStorage[M]{
+		storage: storage,
+	}
+}
+
+func (storage *TypedStorage[M]) wrapNode(node Node) (*TypedNode[M], error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	metadata, err := decodeMetadata[M](node.GetMetadata())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedNode[M]{
+		node:     node,
+		metadata: metadata,
+	}, nil
+}
+
+func (storage *TypedStorage[M]) wrapNodes(nodes []Node) ([]*TypedNode[M], error) {
+	typedNodes := make([]*TypedNode[M], 0, len(nodes))
+
+	for _, node := range nodes {
+		typedNode, err := storage.wrapNode(node)
+		if err != nil {
+			return nil, err
+		}
+
+		typedNodes = append(typedNodes, typedNode)
+	}
+
+	return typedNodes, nil
+}
+
+// Get wrapped storage
+func (storage *TypedStorage[M]) Unwrap() Storage {
+	checkTypedStorageIsNil(storage)
+
+	return storage.storage
+}
+
+func (storage *TypedStorage[M]) GetByReference(reference string) (*TypedNode[M], error) {
+	checkTypedStorageIsNil(storage)
+
+	node, err := storage.storage.GetByReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.wrapNode(node)
+}
+
+func (storage *TypedStorage[M]) GetByName(name string) (*TypedNode[M], error) {
+	checkTypedStorageIsNil(storage)
+
+	node, err := storage.storage.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.wrapNode(node)
+}
+
+func (storage *TypedStorage[M]) Create(name string, metadata M) (*TypedNode[M], error) {
+	checkTypedStorageIsNil(storage)
+
+	node, err := storage.storage.Create(name, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedNode[M]{
+		node:     node,
+		metadata: metadata,
+	}, nil
+}
+
+func (storage *TypedStorage[M]) CreateOrReplace(name string, metadata M) (*TypedNode[M], error) {
+	checkTypedStorageIsNil(storage)
+
+	replaceable, ok := storage.storage.(Replaceable)
+	if !ok {
+		return nil, fmt.Errorf("storage is not replaceable: %w", errors.ErrUnsupported)
+	}
+
+	node, err := replaceable.CreateOrReplace(name, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedNode[M]{
+		node:     node,
+		metadata: metadata,
+	}, nil
+}
+
+func (storage *TypedStorage[M]) Delete(reference string) error {
+	checkTypedStorageIsNil(storage)
+
+	return storage.storage.Delete(reference)
+}
+
+func (storage *TypedStorage[M]) DeleteBy(namePrefix string, namePostfix string) error {
+	checkTypedStorageIsNil(storage)
+
+	return storage.storage.DeleteBy(namePrefix, namePostfix)
+}
+
+func (storage *TypedStorage[M]) ExistsByName(name string) (bool, error) {
+	checkTypedStorageIsNil(storage)
+
+	return storage.storage.ExistsByName(name)
+}
+
+func (storage *TypedStorage[M]) ExistsByReference(reference string) (bool, error) {
+	checkTypedStorageIsNil(storage)
+
+	return storage.storage.ExistsByReference(reference)
+}
+
+func (storage *TypedStorage[M]) ListBy(namePrefix string, namePostfix string) ([]*TypedNode[M], error) {
+	checkTypedStorageIsNil(storage)
+
+	nodes, err := storage.storage.ListBy(namePrefix, namePostfix)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.wrapNodes(nodes)
+}
+
+func (storage *TypedStorage[M]) ListReferences(namePrefix string, namePostfix string) ([]string, error) {
+	checkTypedStorageIsNil(storage)
+
+	return storage.storage.ListReferences(namePrefix, namePostfix)
+}
+
+func (storage *TypedStorage[M]) Open() error {
+	checkTypedStorageIsNil(storage)
+
+	return storage.storage.Open()
+}
+
+func (storage *TypedStorage[M]) Close() error {
+	checkTypedStorageIsNil(storage)
+
+	return storage.storage.Close()
+}
+
+type TypedNode[M any] struct {
+	node     Node
+	metadata M
+}
+
+// Get wrapped node
+func (node *TypedNode[M]) Unwrap() Node {
+	checkTypedNodeIsNil(node)
+
+	return node.node
+}
+
+func (node *TypedNode[M]) GetReference() string {
+	checkTypedNodeIsNil(node)
+
+	return node.node.GetReference()
+}
+
+func (node *TypedNode[M]) GetName() string {
+	checkTypedNodeIsNil(node)
+
+	return node.node.GetName()
+}
+
+func (node *TypedNode[M]) GetMetadata() M {
+	checkTypedNodeIsNil(node)
+
+	return node.metadata
+}
+
+func (node *TypedNode[M]) SetName(name string) error {
+	checkTypedNodeIsNil(node)
+
+	mutable, ok := node.node.(Mutable)
+	if !ok {
+		return fmt.Errorf("node is not mutable: %w", errors.ErrUnsupported)
+	}
+
+	return mutable.SetName(name)
+}
+
+func (node *TypedNode[M]) SetMetadata(metadata M) error {
+	checkTypedNodeIsNil(node)
+
+	mutable, ok := node.node.(Mutable)
+	if !ok {
+		return fmt.Errorf("node is not mutable: %w", errors.ErrUnsupported)
+	}
+
+	err := mutable.SetMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	node.metadata = metadata
+
+	return nil
+}
+
+func (node *TypedNode[M]) GetReader() (io.Reader, error) {
+	checkTypedNodeIsNil(node)
+
+	readable, ok := node.node.(Readable)
+	if !ok {
+		return nil, fmt.Errorf("node is not readable: %w", errors.ErrUnsupported)
+	}
+
+	return readable.GetReader()
+}
+
+func (node *TypedNode[M]) GetWriter() (io.Writer, error) {
+	checkTypedNodeIsNil(node)
+
+	writable, ok := node.node.(Writable)
+	if !ok {
+		return nil, fmt.Errorf("node is not writable: %w", errors.ErrUnsupported)
+	}
+
+	return writable.GetWriter()
+}
@@ -0,0 +1,132 @@
+package bloby
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type typedTestMetadata struct {
+	Owner string   `json:"owner"`
+	Size  int64    `json:"size"`
+	Tags  []string `json:"tags"`
+}
+
+func TestTypedStorage(t *testing.T) {
+	testDirName := "test-file-storage-TestTypedStorage"
+
+	t.Cleanup(func() {
+		os.RemoveAll(testDirName)
+	})
+
+	storage := NewTypedStorage[typedTestMetadata](NewFileStorage(testDirName))
+	assert.NotNil(t, storage)
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	metadata := typedTestMetadata{
+		Owner: "alice",
+		Size:  13,
+		Tags:  []string{"big", "tasty"},
+	}
+
+	node, err := storage.Create("AAAAAAAA", metadata)
+	assert.NoError(t, err)
+	assert.NotNil(t, node)
+	assert.Equal(t, metadata, node.GetMetadata())
+
+	// Type is kept after reload
+	nodeRequeried, err := storage.GetByName("AAAAAAAA")
+	assert.NoError(t, err)
+	assert.NotNil(t, nodeRequeried)
+	assert.Equal(t, metadata, nodeRequeried.GetMetadata())
+
+	nodeRequeried, err = storage.GetByReference(node.GetReference())
+	assert.NoError(t, err)
+	assert.Equal(t, metadata, nodeRequeried.GetMetadata())
+
+	// Missing nodes
+	nodeRequeried, err = storage.GetByName("BBBBBBBB")
+	assert.NoError(t, err)
+	assert.Nil(t, nodeRequeried)
+
+	// Mutation
+	metadata.Size = 42
+	err = node.SetMetadata(metadata)
+	assert.NoError(t, err)
+
+	err = node.SetName("BBBBBBBB")
+	assert.NoError(t, err)
+
+	nodes, err := storage.ListBy("BB", "")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, "BBBBBBBB", nodes[0].GetName())
+	assert.Equal(t, metadata, nodes[0].GetMetadata())
+
+	// Content
+	writer, err := node.GetWriter()
+	assert.NoError(t, err)
+
+	writer.Write([]byte("meow"))
+	writer.(io.Closer).Close()
+
+	reader, err := nodes[0].GetReader()
+	assert.NoError(t, err)
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("meow"), content)
+	reader.(io.Closer).Close()
+
+	// Metadata not convertible into type
+	_, err = storage.Unwrap().Create("CCCCCCCC", "string metadata")
+	assert.NoError(t, err)
+
+	_, err = storage.GetByName("CCCCCCCC")
+	assert.Error(t, err)
+
+	// Missing metadata decodes into zero value
+	_, err = storage.Unwrap().Create("DDDDDDDD", nil)
+	assert.NoError(t, err)
+
+	nodeRequeried, err = storage.GetByName("DDDDDDDD")
+	assert.NoError(t, err)
+	assert.Equal(t, typedTestMetadata{}, nodeRequeried.GetMetadata())
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+func TestTypedStoragePointer(t *testing.T) {
+	storage := NewTypedStorage[*typedTestMetadata](NewMemoryStorage())
+
+	err := storage.Open()
+	assert.NoError(t, err)
+
+	node, err := storage.Create("AAAAAAAA", &typedTestMetadata{Owner: "bob"})
+	assert.NoError(t, err)
+
+	nodeRequeried, err := storage.GetByReference(node.GetReference())
+	assert.NoError(t, err)
+	assert.Equal(t, &typedTestMetadata{Owner: "bob"}, nodeRequeried.GetMetadata())
+
+	node, err = storage.Create("BBBBBBBB", nil)
+	assert.NoError(t, err)
+
+	nodeRequeried, err = storage.GetByReference(node.GetReference())
+	assert.NoError(t, err)
+	assert.Nil(t, nodeRequeried.GetMetadata())
+
+	// Replace keeps reference
+	nodeReplaced, err := storage.CreateOrReplace("BBBBBBBB", &typedTestMetadata{Owner: "carol"})
+	assert.NoError(t, err)
+	assert.Equal(t, node.GetReference(), nodeReplaced.GetReference())
+	assert.Equal(t, &typedTestMetadata{Owner: "carol"}, nodeReplaced.GetMetadata())
+
+	err = storage.Close()
+	assert.NoError(t, err)
+}